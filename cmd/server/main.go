@@ -43,7 +43,7 @@ func main() {
 		cancel()
 	}()
 
-	if err := application.Run(ctx); err != nil {
+	if err := application.RunCommand(ctx, os.Args[1:]); err != nil {
 		log.Error("Application failed to run: %v", err)
 		os.Exit(1)
 	}
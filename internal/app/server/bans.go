@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"time"
+
+	"GWD/internal/banwatch"
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/deployer"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/firewall/server/nftables"
+	"GWD/internal/logger"
+	"GWD/internal/system"
+)
+
+const banwatchServiceName = "gwd-banwatch.service"
+
+// BanService manages the timed ban sets of the firewall and the nginx log
+// watcher that feeds them.
+type BanService struct {
+	logger     logger.Logger
+	sysConfig  *system.Config
+	watcher    deployer.Component
+	configPath string
+}
+
+// NewBanService constructs a BanService for the given system configuration.
+func NewBanService(cfg *system.Config, log logger.Logger) *BanService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &BanService{
+		logger:     log,
+		sysConfig:  cfg,
+		watcher:    deployer.NewBanWatcher(selfExecutable()),
+		configPath: banwatch.DefaultConfigPath,
+	}
+}
+
+// Settings returns the watcher rules, whitelist and ban length.
+func (s *BanService) Settings() (*banwatch.Config, error) {
+	return banwatch.LoadConfig(s.configPath)
+}
+
+// Bans lists the addresses currently held in the ban sets.
+func (s *BanService) Bans() ([]nftables.Ban, error) {
+	return nftables.ListBans(nil)
+}
+
+// Ban adds address to the ban set; minutes <= 0 uses the configured length.
+func (s *BanService) Ban(address string, minutes int) error {
+	addr, err := parseBanAddress("bans.Ban", address)
+	if err != nil {
+		return err
+	}
+	cfg, err := banwatch.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Whitelisted(addr) {
+		return banServiceError("bans.Ban", "address is whitelisted").WithField("address", address)
+	}
+	if minutes <= 0 {
+		minutes = cfg.BanMinutes
+	}
+	if err := nftables.BanAddress(nil, addr, time.Duration(minutes)*time.Minute); err != nil {
+		return err
+	}
+	s.logger.Info("Banned %s for %d minutes", addr, minutes)
+	return nil
+}
+
+// Unban removes address from the ban set.
+func (s *BanService) Unban(address string) error {
+	addr, err := parseBanAddress("bans.Unban", address)
+	if err != nil {
+		return err
+	}
+	removed, err := nftables.UnbanAddress(nil, addr)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return banServiceError("bans.Unban", "address is not banned").WithField("address", address)
+	}
+	s.logger.Info("Unbanned %s", addr)
+	return nil
+}
+
+// Allow whitelists an address or CIDR and lifts any ban it covers.
+func (s *BanService) Allow(entry string) error {
+	cfg, err := banwatch.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Allow(entry); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	s.syncRateLimitExemptions(cfg)
+
+	if bans, err := nftables.ListBans(nil); err == nil {
+		for _, ban := range bans {
+			if cfg.Whitelisted(ban.Address) {
+				if _, err := nftables.UnbanAddress(nil, ban.Address); err != nil {
+					s.logger.Warn("Failed to unban whitelisted %s: %v", ban.Address, err)
+				}
+			}
+		}
+	}
+	return s.restartWatcher()
+}
+
+// Unallow removes entry from the whitelist.
+func (s *BanService) Unallow(entry string) error {
+	cfg, err := banwatch.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if !cfg.Unallow(entry) {
+		return banServiceError("bans.Unallow", "entry is not whitelisted").WithField("entry", entry)
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	s.syncRateLimitExemptions(cfg)
+	return s.restartWatcher()
+}
+
+// syncRateLimitExemptions mirrors the whitelist into the applied firewall so
+// whitelisted sources escape the per-source limits without a re-apply.
+func (s *BanService) syncRateLimitExemptions(cfg *banwatch.Config) {
+	if err := nftables.SetRateLimitExemptions(nil, cfg.WhitelistCIDRs()); err != nil {
+		s.logger.Warn("Failed to update the rate limit exemptions: %v", err)
+	}
+}
+
+// SetWatching enables or disables the nginx log watcher service.
+func (s *BanService) SetWatching(enabled bool) error {
+	cfg, err := banwatch.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cfg.Enabled = enabled
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	if !enabled {
+		if system.UnitExists(banwatchServiceName) {
+			return system.Systemctl("bans.SetWatching", "disable", "--now", banwatchServiceName)
+		}
+		return nil
+	}
+	if err := s.watcher.Validate(); err != nil {
+		if err := s.watcher.Install(); err != nil {
+			return err
+		}
+		if err := system.Systemctl("bans.SetWatching", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	return system.Systemctl("bans.SetWatching", "enable", "--now", banwatchServiceName)
+}
+
+// Watch tails the nginx logs and bans offenders until ctx is cancelled. It
+// is the entry point of gwd-banwatch.service.
+func (s *BanService) Watch(ctx context.Context) error {
+	cfg, err := banwatch.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+
+	var wsPaths []string
+	if inbounds, err := configserver.VtruiInbounds(); err == nil {
+		for _, inbound := range inbounds {
+			if inbound.Transport != configserver.VtruiTransportGRPC {
+				wsPaths = append(wsPaths, inbound.Path)
+			}
+		}
+	} else {
+		s.logger.Warn("Failed to load vtrui inbounds, WebSocket probe rules are disabled: %v", err)
+	}
+
+	watcher, err := banwatch.NewWatcher(cfg, wsPaths, func(addr netip.Addr, timeout time.Duration) error {
+		return nftables.BanAddress(nil, addr, timeout)
+	}, s.logger)
+	if err != nil {
+		return err
+	}
+	return watcher.Run(ctx)
+}
+
+// Watching reports whether the watcher service is running.
+func (s *BanService) Watching() bool {
+	return system.UnitActive(banwatchServiceName)
+}
+
+// restartWatcher makes a running watcher pick up the new configuration.
+func (s *BanService) restartWatcher() error {
+	if !system.UnitActive(banwatchServiceName) {
+		return nil
+	}
+	return system.Systemctl("bans.restartWatcher", "restart", banwatchServiceName)
+}
+
+func parseBanAddress(operation, address string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return netip.Addr{}, banServiceError(operation, "invalid IP address").WithField("address", address)
+	}
+	return addr.Unmap(), nil
+}
+
+func banServiceError(operation, message string) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryValidation, apperrors.CodeValidationGeneric, message, nil).
+		WithModule("bans").
+		WithOperation(operation)
+}
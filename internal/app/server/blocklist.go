@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+
+	"GWD/internal/blocklist"
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/deployer"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/logger"
+	"GWD/internal/system"
+)
+
+const blocklistTimerName = "gwd-blocklist.timer"
+
+// BlocklistService compiles DNS blocklists into the local resolver and keeps
+// them fresh with a daily timer that only runs while sources are configured.
+type BlocklistService struct {
+	logger     logger.Logger
+	sysConfig  *system.Config
+	timer      deployer.Component
+	configPath string
+}
+
+// NewBlocklistService constructs a BlocklistService for the given system configuration.
+func NewBlocklistService(cfg *system.Config, log logger.Logger) *BlocklistService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &BlocklistService{
+		logger:     log,
+		sysConfig:  cfg,
+		timer:      deployer.NewBlocklistUpdater(selfExecutable()),
+		configPath: blocklist.DefaultConfigPath,
+	}
+}
+
+// Blocklist returns the configured sources, allowlist and last refresh statistics.
+func (s *BlocklistService) Blocklist() (*blocklist.Config, error) {
+	return blocklist.LoadConfig(s.configPath)
+}
+
+// AddSource adds an http(s) URL or local file and refreshes the blocklist.
+func (s *BlocklistService) AddSource(ctx context.Context, source string) error {
+	cfg, err := blocklist.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.AddSource(source); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	if err := s.ensureTimer(); err != nil {
+		return err
+	}
+	s.logger.Info("Added DNS blocklist source %s", source)
+	return s.refresh(ctx, cfg)
+}
+
+// RemoveSource drops a source; removing the last one clears the blocklist and
+// stops the refresh timer.
+func (s *BlocklistService) RemoveSource(ctx context.Context, source string) error {
+	cfg, err := blocklist.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if !cfg.RemoveSource(source) {
+		return blocklistServiceError("blocklist.RemoveSource", "blocklist source not found").WithField("source", source)
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	s.logger.Info("Removed DNS blocklist source %s", source)
+
+	if len(cfg.Sources) > 0 {
+		return s.refresh(ctx, cfg)
+	}
+	if system.UnitExists(blocklistTimerName) {
+		if err := system.Systemctl("blocklist.RemoveSource", "disable", "--now", blocklistTimerName); err != nil {
+			return err
+		}
+	}
+	cfg.Stats = blocklist.Stats{}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	if err := configserver.WriteDNSBlocklist(nil, nil); err != nil {
+		return err
+	}
+	return s.reloadResolver()
+}
+
+// Allow exempts domain (and its subdomains) from blocking.
+func (s *BlocklistService) Allow(ctx context.Context, domain string) error {
+	cfg, err := blocklist.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Allow(domain); err != nil {
+		return err
+	}
+	return s.saveAndRefresh(ctx, cfg)
+}
+
+// Unallow removes domain from the allowlist.
+func (s *BlocklistService) Unallow(ctx context.Context, domain string) error {
+	cfg, err := blocklist.LoadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if !cfg.Unallow(domain) {
+		return blocklistServiceError("blocklist.Unallow", "domain is not allowlisted").WithField("domain", domain)
+	}
+	return s.saveAndRefresh(ctx, cfg)
+}
+
+// Refresh downloads every source, rewrites the resolver blocklist and reloads
+// the resolver.
+func (s *BlocklistService) Refresh(ctx context.Context) (blocklist.Stats, error) {
+	cfg, err := blocklist.LoadConfig(s.configPath)
+	if err != nil {
+		return blocklist.Stats{}, err
+	}
+	if len(cfg.Sources) == 0 {
+		s.logger.Info("No DNS blocklist sources configured")
+		return cfg.Stats, nil
+	}
+	if err := s.refresh(ctx, cfg); err != nil {
+		return cfg.Stats, err
+	}
+	return cfg.Stats, nil
+}
+
+func (s *BlocklistService) saveAndRefresh(ctx context.Context, cfg *blocklist.Config) error {
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	if len(cfg.Sources) == 0 {
+		return nil
+	}
+	return s.refresh(ctx, cfg)
+}
+
+func (s *BlocklistService) refresh(ctx context.Context, cfg *blocklist.Config) error {
+	result, err := blocklist.Compile(ctx, cfg, nil)
+	for _, source := range result.Stats.Sources {
+		if source.Error != "" {
+			s.logger.Warn("Blocklist source %s failed: %s", source.Source, source.Error)
+		}
+	}
+	if err != nil {
+		// Keep the previous blocklist when nothing could be loaded.
+		return err
+	}
+
+	if err := configserver.WriteDNSBlocklist(result.Blocked, result.Allowed); err != nil {
+		return err
+	}
+	cfg.Stats = result.Stats
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	s.logger.Info("DNS blocklist updated: %d domains blocked", result.Stats.Blocked)
+	return s.reloadResolver()
+}
+
+// ensureTimer installs and enables the daily refresh timer.
+func (s *BlocklistService) ensureTimer() error {
+	if err := s.timer.Validate(); err != nil {
+		if err := s.timer.Install(); err != nil {
+			return err
+		}
+		if err := system.Systemctl("blocklist.ensureTimer", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	return system.Systemctl("blocklist.ensureTimer", "enable", "--now", blocklistTimerName)
+}
+
+// reloadResolver makes the running resolver pick up the new include file.
+func (s *BlocklistService) reloadResolver() error {
+	resolver := configserver.DNSResolverUnbound
+	if profile, err := LoadInstallProfile(s.sysConfig); err == nil && profile.Resolver != "" {
+		resolver = profile.Resolver
+	}
+
+	unit := configserver.DNSResolverUnit(resolver)
+	if !system.UnitActive(unit) {
+		s.logger.Info("%s is not running; the blocklist applies on next start", resolver)
+		return nil
+	}
+	if resolver == configserver.DNSResolverUnbound {
+		return system.Systemctl("blocklist.reloadResolver", "reload", unit)
+	}
+	return system.Systemctl("blocklist.reloadResolver", "restart", unit)
+}
+
+func blocklistServiceError(operation, message string) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryValidation, apperrors.CodeValidationGeneric, message, nil).
+		WithModule("blocklist").
+		WithOperation(operation)
+}
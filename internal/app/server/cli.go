@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// cliCommand describes a non-interactive subcommand.
+type cliCommand struct {
+	Name    string
+	Usage   string
+	Summary string
+	Run     func(ctx context.Context, args []string) error
+}
+
+func (a *App) cliCommands() []cliCommand {
+	return []cliCommand{
+		{
+			Name:    "user",
+			Usage:   "user <list|add|remove|rename> [args]",
+			Summary: "Manage vtrui client accounts",
+			Run:     a.runUserCommand,
+		},
+		{
+			Name:    "node-info",
+			Usage:   "node-info",
+			Summary: "Show share links and QR codes for every user",
+			Run:     a.runNodeInfoCommand,
+		},
+		{
+			Name:    "traffic",
+			Usage:   "traffic <report|collect|quota|resume> [args]",
+			Summary: "Per-user traffic report and monthly quotas",
+			Run:     a.runTrafficCommand,
+		},
+		{
+			Name:    "dns",
+			Usage:   "dns <show|unbound|doh|blocklist> [args]",
+			Summary: "Show or change the local DNS resolver settings",
+			Run:     a.runDNSCommand,
+		},
+		{
+			Name:    "firewall",
+			Usage:   "firewall <apply|confirm|revert|status|show|restore|persist|bans|ban|unban|whitelist|watch|geoip> [args]",
+			Summary: "Apply the nftables firewall and manage banned addresses",
+			Run:     a.runFirewallCommand,
+		},
+	}
+}
+
+// RunCommand executes a CLI subcommand instead of the interactive menu.
+func (a *App) RunCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return a.Run(ctx)
+	}
+
+	name := strings.TrimSpace(args[0])
+	if name == "help" || name == "-h" || name == "--help" {
+		a.printUsage()
+		return nil
+	}
+
+	for _, cmd := range a.cliCommands() {
+		if cmd.Name == name {
+			return cmd.Run(ctx, args[1:])
+		}
+	}
+
+	a.printUsage()
+	return cliUsageError(fmt.Sprintf("unknown command %q", name))
+}
+
+func (a *App) printUsage() {
+	commands := a.cliCommands()
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+
+	a.console.WriteLine("Usage: server [command]")
+	a.console.WriteLine("")
+	a.console.WriteLine("Without a command the interactive menu is started.")
+	a.console.WriteLine("")
+	a.console.WriteLine("Commands:")
+	for _, cmd := range commands {
+		a.console.WriteLine("  %-40s %s", cmd.Usage, cmd.Summary)
+	}
+}
+
+func cliUsageError(message string) error {
+	return apperrors.New(
+		apperrors.ErrCategoryValidation,
+		apperrors.CodeValidationGeneric,
+		message,
+		nil,
+	).
+		WithModule("cli").
+		WithOperation("cli.RunCommand")
+}
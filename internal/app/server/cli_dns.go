@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"GWD/internal/blocklist"
+	configserver "GWD/internal/configurator/server"
+)
+
+func (a *App) runDNSCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return cliUsageError("usage: dns <show|unbound|doh|blocklist> [args]")
+	}
+
+	switch args[0] {
+	case "show":
+		resolver, opts, err := a.dns.Resolver()
+		if err != nil {
+			return err
+		}
+		a.printDNSSettings(resolver, opts)
+		doh, err := a.dns.DoH()
+		if err != nil {
+			return err
+		}
+		a.printDoHSettings(doh)
+		return nil
+	case "unbound":
+		_, current, err := a.dns.Resolver()
+		if err != nil {
+			return err
+		}
+		fs := flag.NewFlagSet("dns unbound", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		mode := fs.String("mode", current.Mode, "forward or recursive")
+		upstreams := fs.String("upstreams", strings.Join(current.Upstreams, ","), "comma separated IP[@port][#tls-name] list; empty for defaults")
+		tls := fs.Bool("tls", current.TLS, "forward over DNS-over-TLS")
+		ipv6 := fs.Bool("ipv6", current.IPv6, "query upstream servers over IPv6")
+		dnssec := fs.Bool("dnssec", !current.DisableDNSSEC, "validate DNSSEC")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError("usage: dns unbound [-mode forward|recursive] [-upstreams list] [-tls] [-ipv6] [-dnssec]")
+		}
+
+		opts := configserver.UnboundOptions{
+			Mode:          *mode,
+			Upstreams:     splitCSV(*upstreams),
+			TLS:           *tls,
+			IPv6:          *ipv6,
+			DisableDNSSEC: !*dnssec,
+		}
+		upstreamsSet := false
+		fs.Visit(func(f *flag.Flag) { upstreamsSet = upstreamsSet || f.Name == "upstreams" })
+		if *tls != current.TLS && !upstreamsSet {
+			// Toggling DoT without new upstreams falls back to that mode's defaults.
+			opts.Upstreams = nil
+		}
+		if err := a.dns.UpdateUnbound(opts); err != nil {
+			return err
+		}
+		resolver, opts, err := a.dns.Resolver()
+		if err != nil {
+			return err
+		}
+		a.printDNSSettings(resolver, opts)
+		return nil
+	case "doh":
+		current, err := a.dns.DoH()
+		if err != nil {
+			return err
+		}
+		fs := flag.NewFlagSet("dns doh", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		paths := fs.String("paths", strings.Join(current.Paths, ","), "comma separated public DoH paths")
+		upstreams := fs.String("upstreams", strings.Join(current.Upstreams, ","), "comma separated udp:|tcp:|tcp-tls:host:port list; empty for the local resolver")
+		timeout := fs.Int("timeout", current.Timeout, "upstream timeout in seconds")
+		tries := fs.Int("tries", current.Tries, "upstream attempts per query")
+		ecs := fs.String("ecs", current.ECS, "EDNS client subnet mode: anonymized or precise")
+		ecsNonGlobal := fs.Bool("ecs-non-global", current.ECSAllowNonGlobalIP, "send ECS for private client addresses")
+		logClientIP := fs.Bool("log-client-ip", current.LogClientIP, "log queries with the client IP")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError("usage: dns doh [-paths list] [-upstreams list] [-timeout s] [-tries n] [-ecs anonymized|precise] [-ecs-non-global] [-log-client-ip]")
+		}
+
+		opts := configserver.DoHOptions{
+			Paths:               splitCSV(*paths),
+			Upstreams:           splitCSV(*upstreams),
+			Timeout:             *timeout,
+			Tries:               *tries,
+			ECS:                 *ecs,
+			ECSAllowNonGlobalIP: *ecsNonGlobal,
+			LogClientIP:         *logClientIP,
+		}
+		if err := a.dns.UpdateDoH(opts); err != nil {
+			return err
+		}
+		doh, err := a.dns.DoH()
+		if err != nil {
+			return err
+		}
+		a.printDoHSettings(doh)
+		return nil
+	case "blocklist":
+		return a.runBlocklistCommand(ctx, args[1:])
+	default:
+		return cliUsageError("unknown dns subcommand " + args[0])
+	}
+}
+
+func (a *App) runBlocklistCommand(ctx context.Context, args []string) error {
+	const usage = "usage: dns blocklist <show|add|remove|allow|unallow|refresh> [source|domain]"
+	if len(args) == 0 {
+		return cliUsageError(usage)
+	}
+
+	switch args[0] {
+	case "show":
+		cfg, err := a.blocklist.Blocklist()
+		if err != nil {
+			return err
+		}
+		a.printBlocklist(cfg)
+		return nil
+	case "refresh":
+		if len(args) != 1 {
+			return cliUsageError(usage)
+		}
+		_, err := a.blocklist.Refresh(ctx)
+		return err
+	case "add", "remove", "allow", "unallow":
+		if len(args) != 2 {
+			return cliUsageError(usage)
+		}
+		switch args[0] {
+		case "add":
+			return a.blocklist.AddSource(ctx, args[1])
+		case "remove":
+			return a.blocklist.RemoveSource(ctx, args[1])
+		case "allow":
+			return a.blocklist.Allow(ctx, args[1])
+		default:
+			return a.blocklist.Unallow(ctx, args[1])
+		}
+	default:
+		return cliUsageError("unknown dns blocklist subcommand " + args[0])
+	}
+}
+
+func (a *App) printBlocklist(cfg *blocklist.Config) {
+	if len(cfg.Sources) == 0 {
+		a.console.WriteLine("No DNS blocklist sources configured")
+	}
+	for _, source := range cfg.Stats.Sources {
+		status := fmt.Sprintf("%d domains", source.Domains)
+		if source.Error != "" {
+			status = "failed: " + source.Error
+		}
+		a.console.WriteLine("%-60s  %s", source.Source, status)
+	}
+	if len(cfg.Allowlist) > 0 {
+		a.console.WriteLine("Allowlist: %s", strings.Join(cfg.Allowlist, ", "))
+	}
+	if !cfg.Stats.UpdatedAt.IsZero() {
+		a.console.WriteLine("Blocked domains: %d (updated %s)", cfg.Stats.Blocked, cfg.Stats.UpdatedAt.Format("2006-01-02 15:04"))
+	}
+}
+
+func (a *App) printDNSSettings(resolver string, opts configserver.UnboundOptions) {
+	a.console.WriteLine("Resolver:  %s", resolver)
+	a.console.WriteLine("Mode:      %s", opts.Mode)
+	if opts.Mode == configserver.UnboundModeForward {
+		a.console.WriteLine("Upstreams: %s", strings.Join(opts.Upstreams, ", "))
+		a.console.WriteLine("DoT:       %s", yesNo(opts.TLS))
+	}
+	a.console.WriteLine("IPv6:      %s", yesNo(opts.IPv6))
+	a.console.WriteLine("DNSSEC:    %s", yesNo(!opts.DisableDNSSEC))
+	a.console.WriteLine("Host DNS:  %s", strings.Join(configserver.DNSStack(), ", "))
+}
+
+func (a *App) printDoHSettings(opts configserver.DoHOptions) {
+	a.console.WriteLine("DoH paths: %s", strings.Join(opts.Paths, ", "))
+	a.console.WriteLine("DoH up:    %s", strings.Join(opts.Upstreams, ", "))
+	a.console.WriteLine("DoH limit: %ds x %d tries", opts.Timeout, opts.Tries)
+	a.console.WriteLine("DoH ECS:   %s (non-global IPs: %s)", opts.ECS, yesNo(opts.ECSAllowNonGlobalIP))
+	a.console.WriteLine("DoH log:   client IPs %s", yesNo(opts.LogClientIP))
+}
+
+func splitCSV(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
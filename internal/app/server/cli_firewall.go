@@ -0,0 +1,346 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"GWD/internal/banwatch"
+	"GWD/internal/firewall/server/nftables"
+)
+
+func (a *App) runFirewallCommand(ctx context.Context, args []string) error {
+	const usage = "usage: firewall <apply|confirm|revert|status|show|restore|persist|bans|ban|unban|whitelist|watch|geoip> [args]"
+	if len(args) == 0 {
+		return cliUsageError(usage)
+	}
+
+	switch args[0] {
+	case "apply", "confirm", "revert", "status", "restore", "persist":
+		if len(args) != 1 {
+			return cliUsageError(usage)
+		}
+	}
+
+	switch args[0] {
+	case "apply":
+		fw, err := a.firewall.ApplyProfile()
+		if err != nil {
+			return err
+		}
+		a.printFirewallConfirmHint(fw)
+		return nil
+	case "confirm":
+		return a.firewall.Confirm()
+	case "revert":
+		return a.firewall.Revert()
+	case "status":
+		if a.firewall.Pending() {
+			a.console.WriteLine("Firewall change pending: run \"firewall confirm\" to keep it")
+		} else {
+			a.console.WriteLine("No firewall change pending")
+		}
+		return nil
+	case "restore":
+		return a.firewall.Restore()
+	case "persist":
+		return a.firewall.Persist(ctx)
+	case "show":
+		fs := flag.NewFlagSet("firewall show", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		asJSON := fs.Bool("json", false, "print the report as JSON")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError("usage: firewall show [-json]")
+		}
+		report, err := a.firewall.Inspect()
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			a.console.WriteLine("%s", data)
+			return nil
+		}
+		a.printFirewallReport(report)
+		return nil
+	case "bans":
+		if len(args) != 1 {
+			return cliUsageError("usage: firewall bans")
+		}
+		bans, err := a.bans.Bans()
+		if err != nil {
+			return err
+		}
+		a.printBans(bans)
+		return nil
+	case "ban":
+		fs := flag.NewFlagSet("firewall ban", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		minutes := fs.Int("minutes", 0, "ban length in minutes; 0 for the configured default")
+		if len(args) < 2 {
+			return cliUsageError("usage: firewall ban <ip> [-minutes n]")
+		}
+		if err := fs.Parse(args[2:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError("usage: firewall ban <ip> [-minutes n]")
+		}
+		return a.bans.Ban(args[1], *minutes)
+	case "unban":
+		if len(args) != 2 {
+			return cliUsageError("usage: firewall unban <ip>")
+		}
+		return a.bans.Unban(args[1])
+	case "whitelist":
+		return a.runBanWhitelistCommand(args[1:])
+	case "watch":
+		return a.runBanWatchCommand(ctx, args[1:])
+	case "geoip":
+		return a.runGeoIPCommand(args[1:])
+	default:
+		return cliUsageError("unknown firewall subcommand " + args[0])
+	}
+}
+
+func (a *App) runGeoIPCommand(args []string) error {
+	const usage = "usage: firewall geoip <show|set|remove|refresh> [args]"
+	const setUsage = "usage: firewall geoip set <name> -action allow|deny -countries CC,CC [-tcp ports] [-udp ports] [-database dir]"
+	if len(args) == 0 {
+		return cliUsageError(usage)
+	}
+
+	switch args[0] {
+	case "show":
+		if len(args) != 1 {
+			return cliUsageError(usage)
+		}
+		profile, err := LoadInstallProfile(a.config)
+		if err != nil {
+			return err
+		}
+		a.printGeoIPRules(profile.Firewall)
+		return nil
+	case "refresh":
+		if len(args) != 1 {
+			return cliUsageError(usage)
+		}
+		return a.firewall.RefreshGeoIP()
+	case "set":
+		if len(args) < 2 {
+			return cliUsageError(setUsage)
+		}
+		fs := flag.NewFlagSet("firewall geoip set", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		action := fs.String("action", "", "allow or deny")
+		countries := fs.String("countries", "", "comma separated ISO country codes")
+		tcp := fs.String("tcp", "", "comma separated TCP ports; empty with deny for all ports")
+		udp := fs.String("udp", "", "comma separated UDP ports")
+		database := fs.String("database", "", "GeoIP database directory")
+		if err := fs.Parse(args[2:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError(setUsage)
+		}
+		tcpPorts, err := parsePortList(*tcp)
+		if err != nil {
+			return err
+		}
+		udpPorts, err := parsePortList(*udp)
+		if err != nil {
+			return err
+		}
+		fw, err := a.firewall.SetGeoIPRule(GeoIPRule{
+			Name:      args[1],
+			Action:    *action,
+			Countries: splitCSV(*countries),
+			TCPPorts:  tcpPorts,
+			UDPPorts:  udpPorts,
+		}, *database)
+		if err != nil {
+			return err
+		}
+		a.printFirewallConfirmHint(fw)
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return cliUsageError("usage: firewall geoip remove <name>")
+		}
+		fw, err := a.firewall.RemoveGeoIPRule(args[1])
+		if err != nil {
+			return err
+		}
+		a.printFirewallConfirmHint(fw)
+		return nil
+	default:
+		return cliUsageError(usage)
+	}
+}
+
+func (a *App) runBanWhitelistCommand(args []string) error {
+	const usage = "usage: firewall whitelist [add|remove <ip|cidr>]"
+	switch {
+	case len(args) == 0:
+		cfg, err := a.bans.Settings()
+		if err != nil {
+			return err
+		}
+		a.console.WriteLine("Whitelist: %s", joinOrNone(cfg.Whitelist))
+		return nil
+	case len(args) != 2:
+		return cliUsageError(usage)
+	case args[0] == "add":
+		return a.bans.Allow(args[1])
+	case args[0] == "remove":
+		return a.bans.Unallow(args[1])
+	default:
+		return cliUsageError(usage)
+	}
+}
+
+// runBanWatchCommand runs the nginx log watcher in the foreground, as
+// gwd-banwatch.service does, or toggles that service with "on"/"off".
+func (a *App) runBanWatchCommand(ctx context.Context, args []string) error {
+	const usage = "usage: firewall watch [on|off|status]"
+	if len(args) > 1 {
+		return cliUsageError(usage)
+	}
+	if len(args) == 0 {
+		return a.bans.Watch(ctx)
+	}
+
+	switch args[0] {
+	case "on":
+		return a.bans.SetWatching(true)
+	case "off":
+		return a.bans.SetWatching(false)
+	case "status":
+		cfg, err := a.bans.Settings()
+		if err != nil {
+			return err
+		}
+		a.printBanWatchSettings(cfg, a.bans.Watching())
+		return nil
+	default:
+		return cliUsageError(usage)
+	}
+}
+
+func (a *App) printFirewallConfirmHint(fw FirewallConfig) {
+	a.console.WriteLine("Firewall rules applied. From a NEW SSH session run \"firewall confirm\" within %d seconds,", fw.ConfirmTimeout)
+	a.console.WriteLine("otherwise the previous rules are restored automatically.")
+}
+
+// printFirewallReport prints the report in nft list style; long sets are cut
+// short, "firewall show -json" has every element.
+func (a *App) printFirewallReport(report *nftables.Report) {
+	if len(report.Chains) == 0 && len(report.Sets) == 0 {
+		a.console.WriteLine("Firewall table %s is not loaded", report.Table)
+		return
+	}
+	a.console.WriteLine("table inet %s", report.Table)
+	for _, chain := range report.Chains {
+		if chain.Hook != "" {
+			a.console.WriteLine("chain %s (type %s hook %s priority %d; policy %s)", chain.Name, chain.Type, chain.Hook, chain.Priority, chain.Policy)
+		} else {
+			a.console.WriteLine("chain %s", chain.Name)
+		}
+		for _, rule := range chain.Rules {
+			a.console.WriteLine("  %s  # handle %d, %d packets, %d bytes", rule.Rule, rule.Handle, rule.Packets, rule.Bytes)
+		}
+	}
+	for _, set := range report.Sets {
+		a.console.WriteLine("set %s (%s%s): %d elements", set.Name, set.Type, flagSuffix(set.Flags), set.Count)
+		for idx, element := range set.Elements {
+			if idx == maxReportElements {
+				a.console.WriteLine("  ... %d more", set.Count-idx)
+				break
+			}
+			a.console.WriteLine("  %s", element)
+		}
+	}
+	for _, ft := range report.Flowtables {
+		a.console.WriteLine("flowtable %s devices: %s", ft.Name, joinOrNone(ft.Devices))
+	}
+}
+
+// maxReportElements caps the elements printed per set.
+const maxReportElements = 20
+
+func flagSuffix(flags []string) string {
+	if len(flags) == 0 {
+		return ""
+	}
+	return "; flags " + strings.Join(flags, ",")
+}
+
+func (a *App) printGeoIPRules(fw FirewallConfig) {
+	if len(fw.GeoIPRules) == 0 {
+		a.console.WriteLine("No GeoIP rules configured")
+		return
+	}
+	a.console.WriteLine("Database: %s", fw.GeoIPDatabase)
+	a.console.WriteLine("%-16s  %-6s  %-24s  %s", "NAME", "ACTION", "COUNTRIES", "PORTS")
+	for _, rule := range fw.GeoIPRules {
+		var ports []string
+		for _, port := range rule.TCPPorts {
+			ports = append(ports, strconv.Itoa(port)+"/tcp")
+		}
+		for _, port := range rule.UDPPorts {
+			ports = append(ports, strconv.Itoa(port)+"/udp")
+		}
+		portList := "all"
+		if len(ports) > 0 {
+			portList = strings.Join(ports, ",")
+		}
+		a.console.WriteLine("%-16s  %-6s  %-24s  %s", rule.Name, rule.Action, strings.Join(rule.Countries, ","), portList)
+	}
+}
+
+// parsePortList parses a comma separated port list.
+func parsePortList(value string) ([]int, error) {
+	var ports []int
+	for _, item := range splitCSV(value) {
+		port, err := strconv.Atoi(item)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, cliUsageError("invalid port " + item)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func (a *App) printBans(bans []nftables.Ban) {
+	if len(bans) == 0 {
+		a.console.WriteLine("No banned addresses")
+		return
+	}
+	a.console.WriteLine("%-40s  %s", "ADDRESS", "EXPIRES IN")
+	for _, ban := range bans {
+		a.console.WriteLine("%-40s  %s", ban.Address, ban.Expires.Truncate(time.Second))
+	}
+}
+
+func (a *App) printBanWatchSettings(cfg *banwatch.Config, running bool) {
+	a.console.WriteLine("Log watcher:   %s (running: %s)", yesNo(cfg.Enabled), yesNo(running))
+	a.console.WriteLine("Access log:    %s", cfg.AccessLog)
+	a.console.WriteLine("Error log:     %s", cfg.ErrorLog)
+	a.console.WriteLine("Ban length:    %d minutes", cfg.BanMinutes)
+	a.console.WriteLine("Whitelist:     %s", joinOrNone(cfg.Whitelist))
+	for _, rule := range cfg.Rules {
+		state := ""
+		if rule.Disabled {
+			state = " (disabled)"
+		}
+		a.console.WriteLine("Rule %-14s %d hits in %ds on the %s log%s", rule.Name+":", rule.Threshold, rule.WindowSeconds, rule.Log, state)
+	}
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+
+	ui "GWD/internal/ui/server"
+)
+
+func (a *App) runNodeInfoCommand(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return cliUsageError("usage: node-info")
+	}
+	return a.printNodeInfo()
+}
+
+func (a *App) printNodeInfo() error {
+	infos, err := a.nodeInfo.NodeInfo()
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		a.console.WriteLine("No vtrui users configured; add one with \"user add\"")
+		return nil
+	}
+
+	printer := ui.NewPrinter()
+	for _, info := range infos {
+		printer.PrintNodeInfo(info)
+	}
+	return nil
+}
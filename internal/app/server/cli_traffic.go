@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"io"
+	"strconv"
+
+	"GWD/internal/traffic"
+)
+
+const bytesPerGiB = 1 << 30
+
+func (a *App) runTrafficCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return cliUsageError("usage: traffic <report|collect|quota|resume> [args]")
+	}
+
+	switch args[0] {
+	case "report":
+		fs := flag.NewFlagSet("traffic report", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		month := fs.String("month", "", "month to report as YYYY-MM (default: current)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return cliUsageError("usage: traffic report [-month YYYY-MM]")
+		}
+		rows, err := a.traffic.Report(*month)
+		if err != nil {
+			return err
+		}
+		a.printTrafficReport(rows)
+		return nil
+	case "collect":
+		return a.traffic.Collect(ctx)
+	case "quota":
+		if len(args) != 3 {
+			return cliUsageError("usage: traffic quota <email> <GiB|0>")
+		}
+		gib, err := strconv.ParseFloat(args[2], 64)
+		if err != nil || gib < 0 {
+			return cliUsageError("quota must be a non-negative number of GiB")
+		}
+		return a.traffic.SetQuota(args[1], int64(gib*bytesPerGiB))
+	case "resume":
+		if len(args) != 2 {
+			return cliUsageError("usage: traffic resume <email>")
+		}
+		return a.traffic.ResumeUser(args[1])
+	default:
+		return cliUsageError("unknown traffic subcommand " + args[0])
+	}
+}
+
+func (a *App) printTrafficReport(rows []traffic.UserReport) {
+	if len(rows) == 0 {
+		a.console.WriteLine("No traffic recorded")
+		return
+	}
+	a.console.WriteLine("%-24s  %12s  %12s  %12s  %12s  %s", "EMAIL", "UPLINK", "DOWNLINK", "TOTAL", "QUOTA", "STATUS")
+	for _, row := range rows {
+		a.console.WriteLine("%-24s  %12s  %12s  %12s  %12s  %s", row.Email,
+			traffic.FormatBytes(row.Usage.Uplink),
+			traffic.FormatBytes(row.Usage.Downlink),
+			traffic.FormatBytes(row.Usage.Total()),
+			quotaLabel(row.Quota),
+			suspendedLabel(row.Suspended),
+		)
+	}
+}
+
+func quotaLabel(quota int64) string {
+	if quota <= 0 {
+		return "-"
+	}
+	return traffic.FormatBytes(quota)
+}
+
+func suspendedLabel(suspended bool) string {
+	if suspended {
+		return "suspended"
+	}
+	return "active"
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"io"
+
+	configserver "GWD/internal/configurator/server"
+)
+
+func (a *App) runUserCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return cliUsageError("usage: user <list|add|remove|rename> [args]")
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		users, err := a.users.ListUsers()
+		if err != nil {
+			return err
+		}
+		a.printUsers(users)
+		return nil
+	case "add":
+		fs := flag.NewFlagSet("user add", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		email := fs.String("email", "", "email tag for the new user (default: derived from the UUID)")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return cliUsageError("usage: user add [-email tag]")
+		}
+		user, err := a.users.AddUser(*email)
+		if err != nil {
+			return err
+		}
+		a.printUsers([]configserver.VtruiUser{user})
+		return nil
+	case "remove", "rm", "del":
+		if len(args) != 2 {
+			return cliUsageError("usage: user remove <uuid|email>")
+		}
+		_, err := a.users.RemoveUser(args[1])
+		return err
+	case "rename":
+		if len(args) != 3 {
+			return cliUsageError("usage: user rename <uuid|email> <new-email>")
+		}
+		user, err := a.users.RenameUser(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		a.printUsers([]configserver.VtruiUser{user})
+		return nil
+	default:
+		return cliUsageError("unknown user subcommand " + args[0])
+	}
+}
+
+func (a *App) printUsers(users []configserver.VtruiUser) {
+	if len(users) == 0 {
+		a.console.WriteLine("No vtrui users configured")
+		return
+	}
+	a.console.WriteLine("%-36s  %s", "UUID", "EMAIL")
+	for _, user := range users {
+		a.console.WriteLine("%-36s  %s", user.ID, user.Email)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"strings"
 
+	configserver "GWD/internal/configurator/server"
 	apperrors "GWD/internal/errors"
 )
 
@@ -18,16 +19,31 @@ const (
 
 // TLSConfig captures certificate automation configuration.
 type TLSConfig struct {
-	Provider TLSProvider
-	APIKey   string
-	Email    string
+	Provider TLSProvider `json:"provider"`
+	APIKey   string      `json:"-"`
+	Email    string      `json:"email,omitempty"`
 }
 
 // InstallConfig stores the domain level installation inputs.
 type InstallConfig struct {
-	Domain string
-	Port   int
-	TLS    *TLSConfig
+	Domain string     `json:"domain"`
+	Port   int        `json:"port"`
+	TLS    *TLSConfig `json:"tls"`
+
+	// Inbounds selects the vtrui protocols/transports published through nginx.
+	Inbounds []configserver.VtruiInboundSpec `json:"inbounds"`
+
+	// Resolver selects the local DNS resolver backend (unbound or smartdns).
+	Resolver string `json:"resolver,omitempty"`
+
+	// Unbound holds the upstream, DoT and DNSSEC settings used with unbound.
+	Unbound configserver.UnboundOptions `json:"unbound"`
+
+	// DoH holds the doh-server settings and the public paths nginx serves.
+	DoH configserver.DoHOptions `json:"doh"`
+
+	// Firewall controls the gwd nftables table applied at the end of install.
+	Firewall FirewallConfig `json:"firewall"`
 }
 
 // Validate performs basic domain and TLS validation.
@@ -61,6 +77,37 @@ func (cfg *InstallConfig) Validate() error {
 		)
 	}
 
+	inbounds, err := configserver.NormalizeVtruiInbounds(cfg.Inbounds)
+	if err != nil {
+		return err
+	}
+	cfg.Inbounds = inbounds
+
+	resolver, err := configserver.NormalizeDNSResolver(cfg.Resolver)
+	if err != nil {
+		return err
+	}
+	cfg.Resolver = resolver
+
+	unbound, err := configserver.NormalizeUnboundOptions(cfg.Unbound)
+	if err != nil {
+		return err
+	}
+	cfg.Unbound = unbound
+
+	doh, err := configserver.NormalizeDoHOptions(cfg.DoH)
+	if err != nil {
+		return err
+	}
+	if err := configserver.ValidateDoHPaths(doh, cfg.Inbounds); err != nil {
+		return err
+	}
+	cfg.DoH = doh
+
+	if err := cfg.Firewall.normalize(); err != nil {
+		return err
+	}
+
 	if cfg.TLS == nil {
 		return apperrors.New(
 			apperrors.ErrCategoryValidation,
@@ -3,6 +3,7 @@ package server
 import (
 	"strconv"
 
+	configserver "GWD/internal/configurator/server"
 	apperrors "GWD/internal/errors"
 	menu "GWD/internal/menu/server"
 )
@@ -30,8 +31,11 @@ func InstallConfigFromDomainInfo(info *menu.DomainInfo) (*InstallConfig, error)
 	}
 
 	cfg := &InstallConfig{
-		Domain: info.Domain,
-		Port:   port,
+		Domain:   info.Domain,
+		Port:     port,
+		Inbounds: info.Inbounds,
+		Resolver: info.Resolver,
+		DoH:      configserver.DoHOptions{Paths: info.DoHPaths},
 	}
 
 	tlsCfg := &TLSConfig{}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/logger"
+	"GWD/internal/system"
+)
+
+// DNSService manages the local resolver settings stored in the install profile.
+type DNSService struct {
+	logger    logger.Logger
+	sysConfig *system.Config
+}
+
+// NewDNSService constructs a DNSService for the given system configuration.
+func NewDNSService(cfg *system.Config, log logger.Logger) *DNSService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &DNSService{logger: log, sysConfig: cfg}
+}
+
+// Resolver returns the selected resolver backend and the unbound settings.
+func (s *DNSService) Resolver() (string, configserver.UnboundOptions, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return "", configserver.UnboundOptions{}, err
+	}
+	opts, err := configserver.NormalizeUnboundOptions(profile.Unbound)
+	if err != nil {
+		return "", configserver.UnboundOptions{}, err
+	}
+	return profile.Resolver, opts, nil
+}
+
+// UpdateUnbound re-renders unbound.conf from opts, stores them in the install
+// profile and restarts unbound when it is the active resolver.
+func (s *DNSService) UpdateUnbound(opts configserver.UnboundOptions) error {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return err
+	}
+	opts, err = configserver.NormalizeUnboundOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	if profile.Resolver == configserver.DNSResolverUnbound {
+		if err := configserver.EnsureUnboundConfig(opts); err != nil {
+			return err
+		}
+	}
+	profile.Unbound = opts
+	if err := SaveInstallProfile(s.sysConfig, profile); err != nil {
+		return err
+	}
+
+	if profile.Resolver != configserver.DNSResolverUnbound {
+		s.logger.Warn("Saved unbound settings; they apply once unbound is the selected resolver (current: %s)", profile.Resolver)
+		return nil
+	}
+	s.logger.Info("Updated unbound configuration (%s mode)", opts.Mode)
+	unit := configserver.DNSResolverUnit(configserver.DNSResolverUnbound)
+	if err := system.Systemctl("dns.UpdateUnbound", "daemon-reload"); err != nil {
+		return err
+	}
+	return system.Systemctl("dns.UpdateUnbound", "restart", unit)
+}
+
+// DoH returns the doh-server settings from the install profile.
+func (s *DNSService) DoH() (configserver.DoHOptions, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return configserver.DoHOptions{}, err
+	}
+	return configserver.NormalizeDoHOptions(profile.DoH)
+}
+
+// UpdateDoH re-renders doh-server.conf and the nginx DoH locations from opts,
+// stores them in the install profile and restarts doh-server and nginx.
+func (s *DNSService) UpdateDoH(opts configserver.DoHOptions) error {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return err
+	}
+	opts, err = configserver.NormalizeDoHOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := configserver.ValidateDoHPaths(opts, profile.Inbounds); err != nil {
+		return err
+	}
+
+	profile.DoH = opts
+	if err := configserver.EnsureDoHConfig(opts); err != nil {
+		return err
+	}
+	if err := configserver.EnsureNginxConfig(nginxOptions(profile)); err != nil {
+		return err
+	}
+	if err := SaveInstallProfile(s.sysConfig, profile); err != nil {
+		return err
+	}
+
+	s.logger.Info("Updated DoH configuration (paths: %s)", strings.Join(opts.Paths, ", "))
+	if err := system.Systemctl("dns.UpdateDoH", "restart", "doh-server.service"); err != nil {
+		return err
+	}
+	return system.Systemctl("dns.UpdateDoH", "reload", "nginx.service")
+}
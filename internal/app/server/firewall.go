@@ -0,0 +1,851 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"GWD/internal/banwatch"
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/deployer"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/firewall/server/nftables"
+	"GWD/internal/logger"
+	"GWD/internal/system"
+)
+
+const (
+	firewallStateDirName   = "firewall"
+	firewallPreviousFile   = "previous.nft"
+	firewallPendingFile    = "pending"
+	firewallSSHPortsFile   = "ssh-ports.json"
+	firewallRevertUnit     = "gwd-firewall-revert"
+	firewallGeoIPTimerName = "gwd-geoip.timer"
+	firewallPersistUnit    = "gwd-firewall.service"
+	firewallRestoreUnit    = "gwd-firewall-restore.service"
+	firewallDevicePoll     = 15 * time.Second
+	defaultGeoIPDatabase   = "/opt/GWD/geoip"
+	defaultConfirmTimeout  = 120
+	minConfirmTimeout      = 30
+	maxConfirmTimeout      = 3600
+)
+
+// FirewallConfig selects how the gwd nftables table is built from the
+// install profile.
+type FirewallConfig struct {
+	Disabled         bool     `json:"disabled,omitempty"`
+	LanCIDRs         []string `json:"lan_cidrs,omitempty"`
+	FlowtableDevices []string `json:"flowtable_devices,omitempty"`
+	BypassIfaces     []string `json:"bypass_ifaces,omitempty"`
+	// AllowAllInput keeps the input chain policy at accept instead of the
+	// allow-list built from the configured services.
+	AllowAllInput bool  `json:"allow_all_input,omitempty"`
+	ExtraTCPPorts []int `json:"extra_tcp_ports,omitempty"`
+	ExtraUDPPorts []int `json:"extra_udp_ports,omitempty"`
+	// RateLimit meters new connections per source to the allowed ports,
+	// exempting the LAN and the ban whitelist; it has no effect with
+	// AllowAllInput. Zero values use the nftables defaults.
+	RateLimit         bool `json:"rate_limit,omitempty"`
+	NewConnRate       int  `json:"new_conn_rate,omitempty"`
+	MaxConnsPerSource int  `json:"max_conns_per_source,omitempty"`
+	BanMinutes        int  `json:"ban_minutes,omitempty"`
+	// GeoIPDatabase is a MaxMind Country CSV directory or a directory of
+	// per-country CIDR lists; GeoIPRules restrict ports by source country.
+	GeoIPDatabase string      `json:"geoip_database,omitempty"`
+	GeoIPRules    []GeoIPRule `json:"geoip_rules,omitempty"`
+	// MSSClampIfaces lists output interfaces (e.g. wg0, ppp0) whose
+	// forwarded TCP SYNs get their MSS clamped to MSSClamp, or to the route
+	// MTU when it is zero.
+	MSSClampIfaces []string `json:"mss_clamp_ifaces,omitempty"`
+	MSSClamp       int      `json:"mss_clamp,omitempty"`
+	// NAT: Masquerade covers traffic from the LAN CIDRs, MasqueradeIfaces
+	// traffic arriving on those interfaces (e.g. wg0); DNATForwards send
+	// public ports to internal hosts, with Hairpin for LAN clients.
+	Masquerade       bool          `json:"masquerade,omitempty"`
+	MasqueradeIfaces []string      `json:"masquerade_ifaces,omitempty"`
+	DNATForwards     []DNATForward `json:"dnat_forwards,omitempty"`
+	Hairpin          bool          `json:"hairpin,omitempty"`
+	// ConfirmTimeout is how many seconds an applied ruleset stays in place
+	// without "firewall confirm" before the previous one is restored.
+	ConfirmTimeout int `json:"confirm_timeout,omitempty"`
+}
+
+// GeoIPRule allows (or denies) a port group by source country. A deny rule
+// without ports blocks the countries entirely.
+type GeoIPRule struct {
+	Name      string   `json:"name"`
+	Action    string   `json:"action"`
+	Countries []string `json:"countries"`
+	TCPPorts  []int    `json:"tcp_ports,omitempty"`
+	UDPPorts  []int    `json:"udp_ports,omitempty"`
+}
+
+// DNATForward forwards a public port to an internal host in the kernel,
+// unlike the HAProxy port forwards which proxy TCP in user space.
+type DNATForward struct {
+	Protocol   string `json:"protocol"`
+	Port       int    `json:"port"`
+	Address    string `json:"address"`
+	TargetPort int    `json:"target_port,omitempty"`
+	InIface    string `json:"in_iface,omitempty"`
+}
+
+// mssClampConfig converts the profile MSS clamping settings.
+func (f *FirewallConfig) mssClampConfig() nftables.MSSClampConfig {
+	return nftables.MSSClampConfig{
+		Ifaces: append([]string{}, f.MSSClampIfaces...),
+		MSS:    uint16(f.MSSClamp),
+	}
+}
+
+// natConfig converts the profile NAT settings into the nftables
+// representation; addresses were checked by normalize.
+func (f *FirewallConfig) natConfig() nftables.NATConfig {
+	cfg := nftables.NATConfig{
+		Masquerade:       f.Masquerade,
+		MasqueradeIfaces: append([]string{}, f.MasqueradeIfaces...),
+		Hairpin:          f.Hairpin,
+	}
+	for _, fwd := range f.DNATForwards {
+		addr, _ := netip.ParseAddr(strings.TrimSpace(fwd.Address))
+		cfg.Forwards = append(cfg.Forwards, nftables.PortForward{
+			Protocol:   fwd.Protocol,
+			Port:       uint16(fwd.Port),
+			Address:    addr,
+			TargetPort: uint16(fwd.TargetPort),
+			InIface:    fwd.InIface,
+		})
+	}
+	return cfg
+}
+
+// geoIPConfig converts the profile rules into the nftables representation.
+func (f *FirewallConfig) geoIPConfig() nftables.GeoIPConfig {
+	cfg := nftables.GeoIPConfig{Database: f.GeoIPDatabase}
+	for _, rule := range f.GeoIPRules {
+		cfg.Rules = append(cfg.Rules, nftables.GeoIPRule{
+			Name:      rule.Name,
+			Action:    rule.Action,
+			Countries: append([]string{}, rule.Countries...),
+			TCPPorts:  toPorts(rule.TCPPorts),
+			UDPPorts:  toPorts(rule.UDPPorts),
+		})
+	}
+	return cfg
+}
+
+// normalize fills in defaults and validates CIDRs and the confirm timeout.
+func (f *FirewallConfig) normalize() error {
+	if f.ConfirmTimeout == 0 {
+		f.ConfirmTimeout = defaultConfirmTimeout
+	}
+	if f.ConfirmTimeout < minConfirmTimeout || f.ConfirmTimeout > maxConfirmTimeout {
+		return firewallServiceError("firewall.normalize", "firewall confirm timeout must be between 30 and 3600 seconds", nil,
+			apperrors.Metadata{"confirm_timeout": f.ConfirmTimeout})
+	}
+	if f.NewConnRate < 0 || f.MaxConnsPerSource < 0 || f.BanMinutes < 0 {
+		return firewallServiceError("firewall.normalize", "firewall rate limits must not be negative", nil, nil)
+	}
+	for _, port := range append(append([]int{}, f.ExtraTCPPorts...), f.ExtraUDPPorts...) {
+		if port < 1 || port > 65535 {
+			return firewallServiceError("firewall.normalize", "firewall port must be between 1 and 65535", nil, apperrors.Metadata{"port": port})
+		}
+	}
+	for _, cidr := range f.LanCIDRs {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+			return firewallServiceError("firewall.normalize", "invalid firewall LAN CIDR", err, apperrors.Metadata{"cidr": cidr})
+		}
+	}
+	if f.MSSClamp < 0 || f.MSSClamp > 65535 {
+		return firewallServiceError("firewall.normalize", "MSS clamp value must be between 536 and 65535", nil, apperrors.Metadata{"mss_clamp": f.MSSClamp})
+	}
+	if err := f.mssClampConfig().Validate(); err != nil {
+		return err
+	}
+	for _, fwd := range f.DNATForwards {
+		for _, port := range []int{fwd.Port, fwd.TargetPort} {
+			if port < 0 || port > 65535 {
+				return firewallServiceError("firewall.normalize", "firewall port must be between 1 and 65535", nil, apperrors.Metadata{"port": port})
+			}
+		}
+		if _, err := netip.ParseAddr(strings.TrimSpace(fwd.Address)); err != nil {
+			return firewallServiceError("firewall.normalize", "invalid DNAT forward address", err, apperrors.Metadata{"address": fwd.Address})
+		}
+	}
+	if err := f.natConfig().Validate(); err != nil {
+		return err
+	}
+	if len(f.GeoIPRules) > 0 && f.GeoIPDatabase == "" {
+		f.GeoIPDatabase = defaultGeoIPDatabase
+	}
+	for idx, rule := range f.GeoIPRules {
+		for _, port := range append(append([]int{}, rule.TCPPorts...), rule.UDPPorts...) {
+			if port < 1 || port > 65535 {
+				return firewallServiceError("firewall.normalize", "firewall port must be between 1 and 65535", nil, apperrors.Metadata{"port": port})
+			}
+		}
+		for i, country := range rule.Countries {
+			rule.Countries[i] = strings.ToUpper(strings.TrimSpace(country))
+		}
+		f.GeoIPRules[idx].Action = strings.ToLower(strings.TrimSpace(rule.Action))
+	}
+	return f.geoIPConfig().Validate()
+}
+
+// firewallNFTablesConfig translates the profile settings into an
+// nftables.Config. The input allow-list opens the given SSH ports, HTTP, the
+// nginx port over TCP and UDP (QUIC) and every HAProxy forward.
+func firewallNFTablesConfig(profile *InstallConfig, ssh []int) (*nftables.Config, error) {
+	fw := profile.Firewall
+	cfg := nftables.DefaultConfig()
+	if len(fw.LanCIDRs) > 0 {
+		cfg.LanCIDRs = append([]string{}, fw.LanCIDRs...)
+	}
+	cfg.FlowtableDeviceExplicit = append([]string{}, fw.FlowtableDevices...)
+	cfg.InputBypassIfaces = append(cfg.InputBypassIfaces, fw.BypassIfaces...)
+	cfg.ForwardBypassIfaces = append(cfg.ForwardBypassIfaces, fw.BypassIfaces...)
+	if fw.RateLimit {
+		watch, err := banwatch.LoadConfig(banwatch.DefaultConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.ExemptCIDRs = watch.WhitelistCIDRs()
+		if fw.NewConnRate > 0 {
+			cfg.RateLimit.NewConnRate = uint32(fw.NewConnRate)
+			cfg.RateLimit.NewConnBurst = uint32(fw.NewConnRate) * 2
+		}
+		if fw.MaxConnsPerSource > 0 {
+			cfg.RateLimit.MaxConnsPerSource = uint32(fw.MaxConnsPerSource)
+		}
+		if fw.BanMinutes > 0 {
+			cfg.RateLimit.BanTimeout = time.Duration(fw.BanMinutes) * time.Minute
+		}
+	}
+	cfg.GeoIP = fw.geoIPConfig()
+	cfg.NAT = fw.natConfig()
+	cfg.MSSClamp = fw.mssClampConfig()
+	if fw.AllowAllInput {
+		return cfg, nil
+	}
+
+	tcp := append(append([]int{}, ssh...), 80, profile.Port)
+	tcp = append(tcp, fw.ExtraTCPPorts...)
+	udp := append([]int{profile.Port}, fw.ExtraUDPPorts...)
+
+	forwards, err := configserver.LoadPortForwards()
+	if err != nil {
+		return nil, err
+	}
+	for _, fwd := range forwards {
+		tcp = append(tcp, fwd.ListenPort)
+	}
+
+	cfg.InputDefaultDrop = true
+	cfg.AllowedTCPPorts = toPorts(tcp)
+	cfg.AllowedUDPPorts = toPorts(udp)
+	if cfg.RateLimit.Enabled {
+		cfg.RateLimit.TCPPorts = append([]uint16{}, cfg.AllowedTCPPorts...)
+		cfg.RateLimit.UDPPorts = append([]uint16{}, cfg.AllowedUDPPorts...)
+	}
+	return cfg, nil
+}
+
+// sshdPorts returns the ports sshd listens on according to "sshd -T".
+func sshdPorts() ([]int, error) {
+	output, err := exec.Command("sshd", "-T").CombinedOutput()
+	if err != nil {
+		return nil, firewallServiceError("firewall.sshdPorts", "failed to read the sshd configuration with \"sshd -T\"", err,
+			apperrors.Metadata{"output": strings.TrimSpace(string(output))})
+	}
+	var ports []int
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || key != "port" {
+			continue
+		}
+		if port, err := strconv.Atoi(value); err == nil && port > 0 && port <= 65535 {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, firewallServiceError("firewall.sshdPorts", "\"sshd -T\" reported no listening port", nil, nil)
+	}
+	return ports, nil
+}
+
+func toPorts(values []int) []uint16 {
+	ports := make([]uint16, 0, len(values))
+	for _, value := range values {
+		if value > 0 && value <= 65535 {
+			ports = append(ports, uint16(value))
+		}
+	}
+	return ports
+}
+
+// FirewallService applies the gwd nftables table commit-confirm style: the
+// previous table is saved and a systemd timer restores it unless the
+// operator confirms connectivity in time. The timer lives outside this
+// process, so a dropped SSH session cannot leave the host locked out.
+type FirewallService struct {
+	logger     logger.Logger
+	sysConfig  *system.Config
+	geoIPTimer deployer.Component
+	restorer   deployer.Component
+	persister  deployer.Component
+}
+
+// NewFirewallService constructs a FirewallService for the given system configuration.
+func NewFirewallService(cfg *system.Config, log logger.Logger) *FirewallService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &FirewallService{
+		logger:     log,
+		sysConfig:  cfg,
+		geoIPTimer: deployer.NewGeoIPUpdater(selfExecutable()),
+		restorer:   deployer.NewFirewallRestorer(selfExecutable()),
+		persister:  deployer.NewFirewallPersister(selfExecutable()),
+	}
+}
+
+// Apply saves the current table, arms the revert timer and programs the
+// ruleset described by the profile. A failed apply is rolled back immediately.
+// It refuses to run while an earlier change awaits confirmation: saving the
+// unconfirmed table as the revert target would make it stick.
+func (s *FirewallService) Apply(profile *InstallConfig) error {
+	if s.Pending() {
+		return firewallServiceError("firewall.Apply", "a firewall change is still waiting for confirmation; run \"firewall confirm\" or \"firewall revert\" first", nil, nil)
+	}
+
+	fw := profile.Firewall
+	if err := fw.normalize(); err != nil {
+		return err
+	}
+	profile.Firewall = fw
+	// The allow-list is the only way back in; never guess the SSH port here.
+	ssh, err := sshdPorts()
+	if err != nil {
+		return err
+	}
+	nfCfg, err := firewallNFTablesConfig(profile, ssh)
+	if err != nil {
+		return err
+	}
+
+	previous, err := nftables.SaveTable(nfCfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stateDir(), 0o700); err != nil {
+		return firewallServiceError("firewall.Apply", "failed to create firewall state directory", err, apperrors.Metadata{"path": s.stateDir()})
+	}
+	if err := os.WriteFile(s.previousPath(), previous, 0o600); err != nil {
+		return firewallServiceError("firewall.Apply", "failed to save previous firewall ruleset", err, apperrors.Metadata{"path": s.previousPath()})
+	}
+	if err := s.armRevert(time.Duration(fw.ConfirmTimeout) * time.Second); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.pendingPath(), []byte(strconv.FormatInt(time.Now().Unix(), 10)+"\n"), 0o600); err != nil {
+		s.disarmRevert()
+		return firewallServiceError("firewall.Apply", "failed to record pending firewall change", err, apperrors.Metadata{"path": s.pendingPath()})
+	}
+
+	if err := nftables.Ensure(nfCfg); err != nil {
+		if revertErr := s.Revert(); revertErr != nil {
+			s.logger.Warn("Failed to restore previous firewall ruleset: %v", revertErr)
+		}
+		return err
+	}
+	if err := s.saveSSHPorts(ssh); err != nil {
+		return err
+	}
+	s.logger.Info("Applied firewall ruleset; it reverts in %ds unless confirmed", fw.ConfirmTimeout)
+	return nil
+}
+
+// ApplyProfile applies the firewall settings stored in the install profile.
+func (s *FirewallService) ApplyProfile() (FirewallConfig, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return FirewallConfig{}, err
+	}
+	if profile.Firewall.Disabled {
+		return profile.Firewall, firewallServiceError("firewall.ApplyProfile", "firewall is disabled in the install profile", nil, nil)
+	}
+	if err := s.Apply(profile); err != nil {
+		return FirewallConfig{}, err
+	}
+	return profile.Firewall, nil
+}
+
+// Refresh re-programs an already applied firewall after the configured
+// services changed, e.g. a port forward was added. Only the allow-list
+// changes, so no confirmation is needed. It fails while the last change is
+// unconfirmed, since that ruleset may be the one that was reverted for
+// locking out SSH.
+func (s *FirewallService) Refresh() error {
+	return s.refresh(s.sshPorts)
+}
+
+// refresh re-programs the applied firewall with the SSH ports sshPorts
+// returns.
+func (s *FirewallService) refresh(sshPorts func() ([]int, error)) error {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return err
+	}
+	if profile.Firewall.Disabled {
+		return nil
+	}
+	if _, err := os.Stat(s.previousPath()); errors.Is(err, os.ErrNotExist) {
+		// Never applied on this host.
+		return nil
+	}
+	if err := s.checkConfirmed("firewall.Refresh"); err != nil {
+		return err
+	}
+	if err := profile.Firewall.normalize(); err != nil {
+		return err
+	}
+	ssh, err := sshPorts()
+	if err != nil {
+		return err
+	}
+	nfCfg, err := firewallNFTablesConfig(profile, ssh)
+	if err != nil {
+		return err
+	}
+	return nftables.Ensure(nfCfg)
+}
+
+// Inspect reads back the chains, rules with their counters, sets and
+// flowtable devices of the applied firewall.
+func (s *FirewallService) Inspect() (*nftables.Report, error) {
+	return nftables.Inspect(nil)
+}
+
+// SetGeoIPRule adds or replaces the rule with the same name and applies the
+// firewall commit-confirm style, since an allow rule can lock out SSH.
+func (s *FirewallService) SetGeoIPRule(rule GeoIPRule, database string) (FirewallConfig, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return FirewallConfig{}, err
+	}
+	fw := &profile.Firewall
+	if database != "" {
+		fw.GeoIPDatabase = database
+	}
+	replaced := false
+	for idx := range fw.GeoIPRules {
+		if fw.GeoIPRules[idx].Name == rule.Name {
+			fw.GeoIPRules[idx] = rule
+			replaced = true
+		}
+	}
+	if !replaced {
+		fw.GeoIPRules = append(fw.GeoIPRules, rule)
+	}
+	return s.applyGeoIPChange(profile)
+}
+
+// RemoveGeoIPRule drops a rule by name and applies the firewall.
+func (s *FirewallService) RemoveGeoIPRule(name string) (FirewallConfig, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return FirewallConfig{}, err
+	}
+	fw := &profile.Firewall
+	kept := fw.GeoIPRules[:0]
+	for _, rule := range fw.GeoIPRules {
+		if rule.Name != name {
+			kept = append(kept, rule)
+		}
+	}
+	if len(kept) == len(fw.GeoIPRules) {
+		return FirewallConfig{}, firewallServiceError("firewall.RemoveGeoIPRule", "GeoIP rule not found", nil, apperrors.Metadata{"rule": name})
+	}
+	fw.GeoIPRules = kept
+	return s.applyGeoIPChange(profile)
+}
+
+// RefreshGeoIP reloads the GeoIP database into the applied country sets. It
+// is run by gwd-geoip.timer after the database files were updated.
+func (s *FirewallService) RefreshGeoIP() error {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return err
+	}
+	if profile.Firewall.Disabled || len(profile.Firewall.GeoIPRules) == 0 {
+		s.logger.Info("No GeoIP rules configured")
+		return nil
+	}
+	if err := profile.Firewall.normalize(); err != nil {
+		return err
+	}
+	ssh, err := s.sshPorts()
+	if err != nil {
+		return err
+	}
+	nfCfg, err := firewallNFTablesConfig(profile, ssh)
+	if err != nil {
+		return err
+	}
+	if err := nftables.RefreshGeoIP(nfCfg); err != nil {
+		return err
+	}
+	s.logger.Info("GeoIP sets refreshed from %s", profile.Firewall.GeoIPDatabase)
+	return nil
+}
+
+func (s *FirewallService) applyGeoIPChange(profile *InstallConfig) (FirewallConfig, error) {
+	if profile.Firewall.Disabled {
+		return FirewallConfig{}, firewallServiceError("firewall.applyGeoIPChange", "firewall is disabled in the install profile", nil, nil)
+	}
+	if err := profile.Firewall.normalize(); err != nil {
+		return FirewallConfig{}, err
+	}
+	if err := s.Apply(profile); err != nil {
+		return FirewallConfig{}, err
+	}
+	if err := SaveInstallProfile(s.sysConfig, profile); err != nil {
+		return FirewallConfig{}, err
+	}
+	if err := s.ensureGeoIPTimer(len(profile.Firewall.GeoIPRules) > 0); err != nil {
+		return FirewallConfig{}, err
+	}
+	return profile.Firewall, nil
+}
+
+// ensureGeoIPTimer keeps the daily refresh timer enabled while rules exist.
+func (s *FirewallService) ensureGeoIPTimer(enabled bool) error {
+	if !enabled {
+		if system.UnitExists(firewallGeoIPTimerName) {
+			return system.Systemctl("firewall.ensureGeoIPTimer", "disable", "--now", firewallGeoIPTimerName)
+		}
+		return nil
+	}
+	if err := s.geoIPTimer.Validate(); err != nil {
+		if err := s.geoIPTimer.Install(); err != nil {
+			return err
+		}
+		if err := system.Systemctl("firewall.ensureGeoIPTimer", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	return system.Systemctl("firewall.ensureGeoIPTimer", "enable", "--now", firewallGeoIPTimerName)
+}
+
+// Confirm keeps the applied ruleset and cancels the pending revert.
+func (s *FirewallService) Confirm() error {
+	if _, err := os.Stat(s.pendingPath()); errors.Is(err, os.ErrNotExist) {
+		return firewallServiceError("firewall.Confirm", "no firewall change is waiting for confirmation", nil, nil)
+	}
+	if !s.Pending() {
+		return firewallServiceError("firewall.Confirm", "the confirmation window has passed; the previous firewall ruleset was restored", nil, nil)
+	}
+	s.disarmRevert()
+	if err := os.Remove(s.pendingPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return firewallServiceError("firewall.Confirm", "failed to clear pending firewall change", err, apperrors.Metadata{"path": s.pendingPath()})
+	}
+	s.logger.Info("Firewall ruleset confirmed")
+	return s.ensurePersistence()
+}
+
+// ensurePersistence installs and enables gwd-firewall-restore.service, which
+// re-applies the confirmed ruleset before the network comes up after a
+// reboot, and gwd-firewall.service, which follows flowtable device changes.
+func (s *FirewallService) ensurePersistence() error {
+	var stale []deployer.Component
+	if err := s.restorer.Validate(); err != nil {
+		// Hosts set up before the restore unit existed carry a persister
+		// unit that restored the ruleset itself; rewrite both.
+		stale = append(stale, s.restorer, s.persister)
+	} else if err := s.persister.Validate(); err != nil {
+		stale = append(stale, s.persister)
+	}
+	for _, component := range stale {
+		if err := component.Install(); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		if err := system.Systemctl("firewall.ensurePersistence", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	if err := system.Systemctl("firewall.ensurePersistence", "enable", firewallRestoreUnit); err != nil {
+		return err
+	}
+	return system.Systemctl("firewall.ensurePersistence", "enable", "--now", firewallPersistUnit)
+}
+
+// Persist re-applies the firewall once the network is up, so interfaces that
+// appeared after gwd-firewall-restore.service ran join the flowtable, then
+// re-programs it whenever the flowtable devices change, e.g. when a
+// WireGuard interface comes up. It runs until ctx is cancelled.
+func (s *FirewallService) Persist(ctx context.Context) error {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return err
+	}
+	if profile.Firewall.Disabled {
+		s.logger.Info("Firewall disabled in install profile; nothing to restore")
+		return nil
+	}
+	if err := profile.Firewall.normalize(); err != nil {
+		return err
+	}
+	ssh, err := s.sshPorts()
+	if err != nil {
+		return err
+	}
+	nfCfg, err := firewallNFTablesConfig(profile, ssh)
+	if err != nil {
+		return err
+	}
+
+	if !s.unconfirmed() {
+		if err := s.Refresh(); err != nil {
+			return err
+		}
+	}
+	devices, err := nftables.FlowtableDevices(nfCfg)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(firewallDevicePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := nftables.FlowtableDevices(nfCfg)
+		if err != nil {
+			s.logger.Warn("Failed to detect flowtable devices: %v", err)
+			continue
+		}
+		if strings.Join(current, ",") == strings.Join(devices, ",") {
+			continue
+		}
+		if s.unconfirmed() {
+			// Refresh refuses until the change is confirmed.
+			continue
+		}
+		s.logger.Info("Flowtable devices changed to %s; re-applying firewall", strings.Join(current, ", "))
+		if err := s.Refresh(); err != nil {
+			s.logger.Warn("Failed to re-apply firewall: %v", err)
+			continue
+		}
+		devices = current
+	}
+}
+
+// Restore programs the confirmed ruleset; gwd-firewall-restore.service runs
+// it before network-pre.target. ssh.service has not run yet, so "sshd -T"
+// cannot be trusted and the SSH ports recorded by Apply are used instead.
+// A change that was still waiting for confirmation when the host went down
+// is rolled back instead, since its revert timer did not survive the reboot.
+func (s *FirewallService) Restore() error {
+	if _, err := os.Stat(s.previousPath()); errors.Is(err, os.ErrNotExist) {
+		s.logger.Info("Firewall was never applied on this host; nothing to restore")
+		return nil
+	}
+	if s.unconfirmed() {
+		s.logger.Warn("Last firewall change was never confirmed; restoring the previous ruleset")
+		return s.Revert()
+	}
+	ssh, err := s.loadSSHPorts()
+	if err != nil {
+		return err
+	}
+	if len(ssh) == 0 {
+		// Applied before the ports were recorded; gwd-firewall.service
+		// applies it once sshd is up.
+		s.logger.Warn("No SSH ports recorded by the last firewall apply; leaving the restore to gwd-firewall.service")
+		return nil
+	}
+	if err := s.refresh(func() ([]int, error) { return ssh, nil }); err != nil {
+		return err
+	}
+	s.logger.Info("Firewall ruleset restored")
+	return nil
+}
+
+// checkConfirmed fails while the last applied change is unconfirmed, since
+// Refresh would otherwise make it stick. Callers that change what Refresh
+// programs check it before saving anything.
+func (s *FirewallService) checkConfirmed(operation string) error {
+	if s.unconfirmed() {
+		return firewallServiceError(operation, "the last firewall change is unconfirmed; confirm it, or re-apply and confirm, first", nil, nil)
+	}
+	return nil
+}
+
+// sshPorts returns the SSH ports to keep open when the ruleset is rebuilt.
+// When "sshd -T" fails it keeps the ports of the last Apply rather than
+// guessing, and fails when there are none.
+func (s *FirewallService) sshPorts() ([]int, error) {
+	ports, err := sshdPorts()
+	if err == nil {
+		return ports, nil
+	}
+	stored, loadErr := s.loadSSHPorts()
+	if loadErr != nil || len(stored) == 0 {
+		return nil, err
+	}
+	s.logger.Warn("Keeping SSH ports %v from the last firewall apply: %v", stored, err)
+	return stored, nil
+}
+
+// saveSSHPorts records the SSH ports an Apply opened.
+func (s *FirewallService) saveSSHPorts(ports []int) error {
+	data, err := json.Marshal(ports)
+	if err != nil {
+		return firewallServiceError("firewall.saveSSHPorts", "failed to encode SSH ports", err, nil)
+	}
+	if err := system.WriteFileAtomic(s.sshPortsPath(), append(data, '\n'), 0o600); err != nil {
+		return firewallServiceError("firewall.saveSSHPorts", "failed to record SSH ports", err, apperrors.Metadata{"path": s.sshPortsPath()})
+	}
+	return nil
+}
+
+// loadSSHPorts returns the SSH ports recorded by the last Apply, or none.
+func (s *FirewallService) loadSSHPorts() ([]int, error) {
+	data, err := os.ReadFile(s.sshPortsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, firewallServiceError("firewall.loadSSHPorts", "failed to read recorded SSH ports", err, apperrors.Metadata{"path": s.sshPortsPath()})
+	}
+	var ports []int
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return nil, firewallServiceError("firewall.loadSSHPorts", "failed to parse recorded SSH ports", err, apperrors.Metadata{"path": s.sshPortsPath()})
+	}
+	return ports, nil
+}
+
+// unconfirmed reports whether the last applied change was never confirmed,
+// either because it is still pending or because it was reverted.
+func (s *FirewallService) unconfirmed() bool {
+	_, err := os.Stat(s.pendingPath())
+	return err == nil
+}
+
+// Revert restores the ruleset saved by the last Apply right away.
+func (s *FirewallService) Revert() error {
+	previous, err := os.ReadFile(s.previousPath())
+	if err != nil {
+		return firewallServiceError("firewall.Revert", "no saved firewall ruleset to restore", err, apperrors.Metadata{"path": s.previousPath()})
+	}
+	s.disarmRevert()
+	if err := nftables.RestoreTable(previous); err != nil {
+		return err
+	}
+	s.logger.Info("Restored previous firewall ruleset")
+	return nil
+}
+
+// Pending reports whether an applied ruleset is still waiting for confirmation.
+func (s *FirewallService) Pending() bool {
+	return system.UnitActive(firewallRevertUnit + ".timer")
+}
+
+// WaitForConfirmation blocks until "firewall confirm" is run, the revert
+// timer fires or timeout passes. Anything but a confirmation is an error.
+func (s *FirewallService) WaitForConfirmation(ctx context.Context, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			if err := s.Revert(); err != nil {
+				return err
+			}
+			return firewallServiceError("firewall.WaitForConfirmation", "firewall change was not confirmed in time; previous ruleset restored", nil,
+				apperrors.Metadata{"timeout": timeout.String()})
+		case <-ticker.C:
+			if _, err := os.Stat(s.pendingPath()); errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if !s.Pending() {
+				return firewallServiceError("firewall.WaitForConfirmation", "firewall change was not confirmed in time; previous ruleset restored", nil,
+					apperrors.Metadata{"timeout": timeout.String()})
+			}
+		}
+	}
+}
+
+// armRevert schedules "nft -f previous.nft" as a transient systemd timer.
+func (s *FirewallService) armRevert(after time.Duration) error {
+	s.disarmRevert()
+
+	nft, err := exec.LookPath("nft")
+	if err != nil {
+		return firewallServiceError("firewall.armRevert", "nft binary not found", err, nil)
+	}
+	args := []string{
+		"--unit=" + firewallRevertUnit,
+		"--description=Revert unconfirmed GWD firewall change",
+		"--on-active=" + strconv.Itoa(int(after.Seconds())),
+		"--timer-property=AccuracySec=1s",
+		nft, "-f", s.previousPath(),
+	}
+	if output, err := exec.Command("systemd-run", args...).CombinedOutput(); err != nil {
+		return firewallServiceError("firewall.armRevert", "failed to schedule firewall revert", err, apperrors.Metadata{
+			"output": strings.TrimSpace(string(output)),
+		})
+	}
+	return nil
+}
+
+func (s *FirewallService) disarmRevert() {
+	_ = system.Systemctl("firewall.disarmRevert", "stop", firewallRevertUnit+".timer")
+	_ = system.Systemctl("firewall.disarmRevert", "reset-failed", firewallRevertUnit+".service")
+}
+
+func (s *FirewallService) stateDir() string {
+	workingDir := "/opt/GWD"
+	if s.sysConfig != nil && s.sysConfig.WorkingDir != "" {
+		workingDir = s.sysConfig.WorkingDir
+	}
+	return filepath.Join(workingDir, firewallStateDirName)
+}
+
+func (s *FirewallService) previousPath() string {
+	return filepath.Join(s.stateDir(), firewallPreviousFile)
+}
+
+func (s *FirewallService) sshPortsPath() string {
+	return filepath.Join(s.stateDir(), firewallSSHPortsFile)
+}
+
+func (s *FirewallService) pendingPath() string {
+	return filepath.Join(s.stateDir(), firewallPendingFile)
+}
+
+func firewallServiceError(operation, message string, err error, metadata apperrors.Metadata) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryFirewall, apperrors.CodeFirewallGeneric, message, err).
+		WithModule("firewall").
+		WithOperation(operation).
+		WithFields(metadata)
+}
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	configserver "GWD/internal/configurator/server"
 	"GWD/internal/deployer"
@@ -32,17 +32,19 @@ type Installer struct {
 	pkgManager *dpkg.Manager
 	repository *serverdownloader.Downloader
 	doh        deployer.Component
+	smartdns   deployer.Component
 	nginx      deployer.Component
 	vtrui      deployer.Component
 	tcsss      deployer.Component
+	traffic    deployer.Component
+	firewall   *FirewallService
 }
 
 const (
-	defaultWebSocketPath = "/ws"
-	defaultNginxConfDir  = "/etc/nginx/conf.d"
-	defaultCertPath      = "/var/www/ssl/de_GWD.cer"
-	defaultKeyPath       = "/var/www/ssl/de_GWD.key"
-	defaultDHParamPath   = "/var/www/ssl/dhparam.pem"
+	defaultNginxConfDir = "/etc/nginx/conf.d"
+	defaultCertPath     = "/var/www/ssl/de_GWD.cer"
+	defaultKeyPath      = "/var/www/ssl/de_GWD.key"
+	defaultDHParamPath  = "/var/www/ssl/dhparam.pem"
 )
 
 // NewInstaller creates a new Installer instance. Package manager is constructed here
@@ -61,9 +63,12 @@ func NewInstaller(
 		pkgManager: dpkg.NewManager(nil),
 		repository: repo,
 		doh:        deployer.NewDoH(cfg.GetRepoDir()),
+		smartdns:   deployer.NewSmartDNS(cfg.GetRepoDir()),
 		nginx:      deployer.NewNginx(cfg.GetRepoDir()),
 		vtrui:      deployer.NewVtrui(cfg.GetRepoDir()),
 		tcsss:      deployer.NewTcsss(cfg.GetRepoDir()),
+		traffic:    deployer.NewTrafficCollector(selfExecutable()),
+		firewall:   NewFirewallService(cfg, console.Logger()),
 	}
 }
 
@@ -103,6 +108,12 @@ func (i *Installer) InstallGWD(cfg *InstallConfig) error {
 			Category:  apperrors.ErrCategorySystem,
 			Fn:        i.createWorkingDirectories,
 		},
+		{
+			Name:      "Save install profile",
+			Operation: "installer.saveInstallProfile",
+			Category:  apperrors.ErrCategoryConfig,
+			Fn:        func() error { return SaveInstallProfile(i.sysConfig, cfg) },
+		},
 		{
 			Name:      "Check runtime environment",
 			Operation: "installer.validateEnvironment",
@@ -121,18 +132,20 @@ func (i *Installer) InstallGWD(cfg *InstallConfig) error {
 		{"Install system dependencies", "installer.installDependencies", apperrors.ErrCategoryDependency, i.pkgManager.InstallDependencies},
 		{"Set timezone to Asia/Shanghai", "installer.configureTimezone", apperrors.ErrCategorySystem, configserver.EnsureTimezoneShanghai},
 		{"Configure rng-tools and chrony", "installer.configureEntropyAndTime", apperrors.ErrCategorySystem, i.configureEntropyAndTime},
-		{"Configure unbound", "installer.configureUnbound", apperrors.ErrCategorySystem, i.configureUnbound},
-		{"Configure resolvconf", "installer.configureResolvconf", apperrors.ErrCategorySystem, configserver.EnsureResolvconfConfig},
 		{"Synchronize system time", "installer.syncTime", apperrors.ErrCategorySystem, i.syncSystemTime},
 		{"Download repository files", "installer.downloadRepository", apperrors.ErrCategoryDependency, i.repository.DownloadAll},
+		{"Configure DNS resolver", "installer.configureResolver", apperrors.ErrCategorySystem, i.configureResolver},
+		{"Configure resolvconf", "installer.configureResolvconf", apperrors.ErrCategorySystem, configserver.EnsureResolvconfConfig},
 		{"Generate SSL certificate", "installer.generateSSLCertificate", apperrors.ErrCategoryDeployment, func() error { return i.generateSSLCertificate(cfg) }},
 		{"Install tcsss", "installer.installTcsss", apperrors.ErrCategoryDeployment, i.installTcsss},
 		{"Install DoH server", "installer.installDoH", apperrors.ErrCategoryDeployment, i.installDOHServer},
 		{"Install vtrui", "installer.installVtrui", apperrors.ErrCategoryDeployment, i.installVtrui},
+		{"Install traffic collector", "installer.installTrafficCollector", apperrors.ErrCategoryDeployment, i.installTrafficCollector},
 		{"Install Nginx", "installer.installNginx", apperrors.ErrCategoryDeployment, i.installNginx},
 		{"Start system services", "installer.startSystemServices", apperrors.ErrCategoryDeployment, i.startSystemServices},
 		{"Configure SSL certificate", "installer.configureTLS", apperrors.ErrCategoryDeployment, func() error { return i.configureTLS(cfg) }},
 		{"Configure Nginx Web", "installer.configureNginxWeb", apperrors.ErrCategoryDeployment, i.configureNginxWeb},
+		{"Configure firewall", "installer.configureFirewall", apperrors.ErrCategoryFirewall, func() error { return i.configureFirewall(ctx) }},
 		{"Post-installation configuration", "installer.postInstall", apperrors.ErrCategoryDeployment, i.postInstallConfiguration},
 	}
 
@@ -262,6 +275,13 @@ func (i *Installer) syncSystemTime() error {
 // installDOHServer installs the DoH (DNS-over-HTTPS) server
 func (i *Installer) installDOHServer() error {
 	i.logger.Info("Configuring DoH server...")
+	var opts configserver.DoHOptions
+	if i.installConfig != nil {
+		opts = i.installConfig.DoH
+	}
+	if err := configserver.EnsureDoHConfig(opts); err != nil {
+		return i.wrapError(apperrors.ErrCategoryConfig, "installer.installDoH", "DoH configuration failed", err, nil)
+	}
 	if err := i.doh.Install(); err != nil {
 		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.installDoH", "DoH deployment failed", err, nil)
 	}
@@ -308,9 +328,46 @@ func (i *Installer) installVtrui() error {
 	if err := i.vtrui.Validate(); err != nil {
 		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.installVtrui", "vtrui validation failed", err, nil)
 	}
+	var inbounds []configserver.VtruiInboundSpec
+	if i.installConfig != nil {
+		inbounds = i.installConfig.Inbounds
+	}
+	if err := configserver.EnsureVtruiConfig(inbounds); err != nil {
+		return i.wrapError(apperrors.ErrCategoryConfig, "installer.installVtrui", "vtrui configuration failed", err, nil)
+	}
+	user, created, err := configserver.EnsureDefaultVtruiUser()
+	if err != nil {
+		return i.wrapError(apperrors.ErrCategoryConfig, "installer.installVtrui", "failed to provision vtrui user", err, nil)
+	}
+	if created {
+		i.logger.Info("Created vtrui user %s (%s)", user.Label(), user.ID)
+	}
 	return nil
 }
 
+// installTrafficCollector installs the timer that accumulates vtrui user statistics
+func (i *Installer) installTrafficCollector() error {
+	if err := i.traffic.Install(); err != nil {
+		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.installTrafficCollector", "traffic collector deployment failed", err, nil)
+	}
+	if err := i.traffic.Validate(); err != nil {
+		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.installTrafficCollector", "traffic collector validation failed", err, nil)
+	}
+	return nil
+}
+
+// selfExecutable returns the absolute path of the running GWD binary so
+// systemd units can invoke its CLI commands.
+func selfExecutable() string {
+	if path, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+		return path
+	}
+	return os.Args[0]
+}
+
 func (i *Installer) configureEntropyAndTime() error {
 	i.logger.Info("Configuring rng-tools and chrony...")
 	if err := configserver.EnsureEntropyAndTimeConfigured(); err != nil {
@@ -333,9 +390,72 @@ func (i *Installer) configureEntropyAndTime() error {
 	return nil
 }
 
+// configureResolver sets up the local resolver selected in the install
+// profile and disables the other backend so only one binds 127.0.0.1:53.
+func (i *Installer) configureResolver() error {
+	resolver := configserver.DNSResolverUnbound
+	if i.installConfig != nil && i.installConfig.Resolver != "" {
+		resolver = i.installConfig.Resolver
+	}
+
+	for _, other := range configserver.DNSResolvers() {
+		if other == resolver {
+			continue
+		}
+		if err := i.disableResolver(other); err != nil {
+			return err
+		}
+	}
+
+	switch resolver {
+	case configserver.DNSResolverSmartDNS:
+		return i.configureSmartDNS()
+	default:
+		return i.configureUnbound()
+	}
+}
+
+// disableResolver stops and disables an unselected resolver backend.
+func (i *Installer) disableResolver(name string) error {
+	unit := configserver.DNSResolverUnit(name)
+	if !system.UnitExists(unit) {
+		return nil
+	}
+	i.logger.Info("Disabling %s...", name)
+	if err := system.Systemctl("installer.disableResolver", "disable", "--now", unit); err != nil {
+		return i.wrapError(apperrors.ErrCategorySystem, "installer.disableResolver", "failed to disable DNS resolver", err, apperrors.Metadata{"service": unit})
+	}
+	return nil
+}
+
+func (i *Installer) configureSmartDNS() error {
+	i.logger.Info("Configuring SmartDNS service...")
+	if err := i.smartdns.Install(); err != nil {
+		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.configureSmartDNS", "SmartDNS deployment failed", err, nil)
+	}
+	if err := i.smartdns.Validate(); err != nil {
+		return i.wrapError(apperrors.ErrCategoryDeployment, "installer.configureSmartDNS", "SmartDNS validation failed", err, nil)
+	}
+	if err := configserver.EnsureSmartDNSConfig(); err != nil {
+		return err
+	}
+
+	if err := i.systemctlDaemonReload(); err != nil {
+		return err
+	}
+	if err := i.systemctlEnable("smartdns"); err != nil {
+		return err
+	}
+	return i.systemctlRestart("smartdns")
+}
+
 func (i *Installer) configureUnbound() error {
 	i.logger.Info("Configuring unbound service...")
-	if err := configserver.EnsureUnboundConfig(); err != nil {
+	var opts configserver.UnboundOptions
+	if i.installConfig != nil {
+		opts = i.installConfig.Unbound
+	}
+	if err := configserver.EnsureUnboundConfig(opts); err != nil {
 		return err
 	}
 
@@ -407,6 +527,7 @@ func (i *Installer) startSystemServices() error {
 		{"tcsss.service", "TCSSS"},
 		{"nginx.service", "Nginx"},
 		{"vtrui.service", "Vtrui"},
+		{"gwd-traffic.timer", "Traffic collector"},
 	}
 
 	for _, svc := range services {
@@ -479,51 +600,26 @@ func (i *Installer) applyServiceAction(candidates []string, action func(string)
 
 // systemctlDaemonReload reloads systemd daemon configuration.
 func (i *Installer) systemctlDaemonReload() error {
-	cmd := exec.Command("systemctl", "daemon-reload")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return i.wrapError(
-			apperrors.ErrCategorySystem,
-			"installer.systemctlDaemonReload",
-			"failed to reload systemd daemon",
-			err,
-			apperrors.Metadata{"output": string(output)},
-		)
+	if err := system.Systemctl("installer.systemctlDaemonReload", "daemon-reload"); err != nil {
+		return i.wrapError(apperrors.ErrCategorySystem, "installer.systemctlDaemonReload", "failed to reload systemd daemon", err, nil)
 	}
 	return nil
 }
 
 // systemctlRestart restarts a systemd service.
 func (i *Installer) systemctlRestart(serviceName string) error {
-	cmd := exec.Command("systemctl", "restart", serviceName)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return i.wrapError(
-			apperrors.ErrCategorySystem,
-			"installer.systemctlRestart",
-			"failed to restart service",
-			err,
-			apperrors.Metadata{
-				"service": serviceName,
-				"output":  string(output),
-			},
-		)
+	if err := system.Systemctl("installer.systemctlRestart", "restart", serviceName); err != nil {
+		return i.wrapError(apperrors.ErrCategorySystem, "installer.systemctlRestart", "failed to restart service", err,
+			apperrors.Metadata{"service": serviceName})
 	}
 	return nil
 }
 
 // systemctlEnable enables a systemd service.
 func (i *Installer) systemctlEnable(serviceName string) error {
-	cmd := exec.Command("systemctl", "enable", serviceName)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return i.wrapError(
-			apperrors.ErrCategorySystem,
-			"installer.systemctlEnable",
-			"failed to enable service",
-			err,
-			apperrors.Metadata{
-				"service": serviceName,
-				"output":  string(output),
-			},
-		)
+	if err := system.Systemctl("installer.systemctlEnable", "enable", serviceName); err != nil {
+		return i.wrapError(apperrors.ErrCategorySystem, "installer.systemctlEnable", "failed to enable service", err,
+			apperrors.Metadata{"service": serviceName})
 	}
 	return nil
 }
@@ -576,6 +672,51 @@ func (i *Installer) configureTLS(cfg *InstallConfig) error {
 	}
 }
 
+// configureFirewall applies the gwd nftables table and waits for the
+// operator to confirm from a new SSH session; otherwise the previous ruleset
+// is restored.
+func (i *Installer) configureFirewall(ctx context.Context) error {
+	if i.installConfig == nil {
+		return i.wrapError(apperrors.ErrCategoryConfig, "installer.configureFirewall", "install configuration not available", nil, nil)
+	}
+	fw := i.installConfig.Firewall
+	if fw.Disabled {
+		i.logger.Info("Firewall disabled in install profile; skipping")
+		return nil
+	}
+	if err := fw.normalize(); err != nil {
+		return err
+	}
+
+	i.logger.Info("Applying firewall rules...")
+	if err := i.firewall.Apply(i.installConfig); err != nil {
+		return i.wrapError(apperrors.ErrCategoryFirewall, "installer.configureFirewall", "failed to apply firewall rules", err, nil)
+	}
+
+	i.console.WriteLine("Firewall rules applied. Open a NEW SSH session to this host and run \"firewall confirm\" within %d seconds,", fw.ConfirmTimeout)
+	i.console.WriteLine("otherwise the previous rules are restored automatically.")
+	if err := i.firewall.WaitForConfirmation(ctx, time.Duration(fw.ConfirmTimeout)*time.Second); err != nil {
+		return i.wrapError(apperrors.ErrCategoryFirewall, "installer.configureFirewall", "firewall rules were not confirmed", err,
+			apperrors.Metadata{"confirm_timeout": fw.ConfirmTimeout})
+	}
+	i.logger.Info("Firewall rules confirmed")
+	return nil
+}
+
+// nginxOptions derives the nginx site settings from an install profile.
+func nginxOptions(cfg *InstallConfig) configserver.NginxOptions {
+	return configserver.NginxOptions{
+		Port:        cfg.Port,
+		Domain:      strings.TrimSpace(cfg.Domain),
+		ConfigDir:   defaultNginxConfDir,
+		Inbounds:    cfg.Inbounds,
+		DoH:         cfg.DoH,
+		CertFile:    defaultCertPath,
+		KeyFile:     defaultKeyPath,
+		DHParamFile: defaultDHParamPath,
+	}
+}
+
 // configureNginxWeb configures Nginx Web service
 func (i *Installer) configureNginxWeb() error {
 	cfg := i.installConfig
@@ -592,15 +733,7 @@ func (i *Installer) configureNginxWeb() error {
 	domain := strings.TrimSpace(cfg.Domain)
 	i.logger.Info("Configuring Nginx web service for %s...", domain)
 
-	options := configserver.NginxOptions{
-		Port:        cfg.Port,
-		Domain:      domain,
-		ConfigDir:   defaultNginxConfDir,
-		WSPath:      defaultWebSocketPath,
-		CertFile:    defaultCertPath,
-		KeyFile:     defaultKeyPath,
-		DHParamFile: defaultDHParamPath,
-	}
+	options := nginxOptions(cfg)
 
 	if err := configserver.EnsureNginxConfig(options); err != nil {
 		return i.wrapError(
@@ -609,9 +742,9 @@ func (i *Installer) configureNginxWeb() error {
 			"failed to configure Nginx web service",
 			err,
 			apperrors.Metadata{
-				"domain":  domain,
-				"port":    cfg.Port,
-				"ws_path": options.WSPath,
+				"domain":   domain,
+				"port":     cfg.Port,
+				"inbounds": len(options.Inbounds),
 			},
 		)
 	}
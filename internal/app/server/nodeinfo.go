@@ -0,0 +1,64 @@
+package server
+
+import (
+	"strconv"
+
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/system"
+	ui "GWD/internal/ui/server"
+)
+
+// NodeInfoService assembles client connection details from the install
+// profile, the vtrui inbounds and the configured users.
+type NodeInfoService struct {
+	sysConfig *system.Config
+}
+
+// NewNodeInfoService constructs a NodeInfoService.
+func NewNodeInfoService(cfg *system.Config) *NodeInfoService {
+	return &NodeInfoService{sysConfig: cfg}
+}
+
+// NodeInfo returns one entry per user and inbound, each carrying a share link.
+func (s *NodeInfoService) NodeInfo() ([]ui.NodeInfo, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := configserver.VtruiShareEndpoints(profile.Domain, profile.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	doh, err := configserver.NormalizeDoHOptions(profile.DoH)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := configserver.ListVtruiUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ui.NodeInfo, 0, len(users)*len(endpoints))
+	for _, user := range users {
+		for _, endpoint := range endpoints {
+			link, err := endpoint.ShareLink(user)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, ui.NodeInfo{
+				Domain:    profile.Domain,
+				Port:      strconv.Itoa(profile.Port),
+				UUID:      user.ID,
+				Path:      endpoint.Path,
+				DoHPaths:  doh.Paths,
+				User:      user.Email,
+				Protocol:  endpoint.String(),
+				ShareLink: link,
+			})
+		}
+	}
+	return infos, nil
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/deployer"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/logger"
+	dpkg "GWD/internal/pkgmgr"
+	"GWD/internal/system"
+)
+
+const haproxyServiceName = "haproxy.service"
+
+// PortForwardService manages HAProxy TCP port forwards. HAProxy is installed
+// on the first forward and stopped again when the last one is removed.
+type PortForwardService struct {
+	logger     logger.Logger
+	sysConfig  *system.Config
+	pkgManager *dpkg.Manager
+	haproxy    deployer.Component
+	firewall   *FirewallService
+}
+
+// NewPortForwardService constructs a PortForwardService for the given system configuration.
+func NewPortForwardService(cfg *system.Config, log logger.Logger) *PortForwardService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &PortForwardService{
+		logger:     log,
+		sysConfig:  cfg,
+		pkgManager: dpkg.NewManager(nil),
+		haproxy:    deployer.NewHAProxy(cfg.GetRepoDir()),
+		firewall:   NewFirewallService(cfg, log),
+	}
+}
+
+// ListForwards returns the configured port forwards.
+func (s *PortForwardService) ListForwards() ([]configserver.PortForward, error) {
+	return configserver.LoadPortForwards()
+}
+
+// AddForward validates and adds fwd, then (re)starts HAProxy.
+func (s *PortForwardService) AddForward(fwd configserver.PortForward) (configserver.PortForward, error) {
+	forwards, err := configserver.LoadPortForwards()
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+	forwards = append(forwards, fwd)
+
+	reserved, err := s.reservedPorts()
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+	// Reject bad input before HAProxy is installed on first use.
+	if _, err := configserver.NormalizePortForwards(forwards, reserved); err != nil {
+		return configserver.PortForward{}, err
+	}
+	// The firewall must be able to open the port once the forward is saved.
+	if err := s.firewall.checkConfirmed("portforward.AddForward"); err != nil {
+		return configserver.PortForward{}, err
+	}
+	if err := s.ensureHAProxy(); err != nil {
+		return configserver.PortForward{}, err
+	}
+
+	saved, err := configserver.SavePortForwards(forwards, reserved)
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+	for _, candidate := range saved {
+		if candidate.ListenPort == fwd.ListenPort {
+			fwd = candidate
+			break
+		}
+	}
+
+	s.logger.Info("Forwarding TCP port %d to %s", fwd.ListenPort, fwd.TargetAddress())
+	return fwd, s.applyForwards(len(saved))
+}
+
+// RemoveForward deletes the forward matching ref (name or listen port).
+func (s *PortForwardService) RemoveForward(ref string) (configserver.PortForward, error) {
+	forwards, err := configserver.LoadPortForwards()
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+
+	ref = strings.TrimSpace(ref)
+	idx := -1
+	for i, fwd := range forwards {
+		if fwd.Name == ref || strconv.Itoa(fwd.ListenPort) == ref {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return configserver.PortForward{}, apperrors.New(
+			apperrors.ErrCategoryValidation,
+			apperrors.CodeValidationGeneric,
+			"port forward not found",
+			nil,
+		).
+			WithModule("portforward").
+			WithOperation("portforward.RemoveForward").
+			WithField("forward", ref)
+	}
+
+	removed := forwards[idx]
+	reserved, err := s.reservedPorts()
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+	if err := s.firewall.checkConfirmed("portforward.RemoveForward"); err != nil {
+		return configserver.PortForward{}, err
+	}
+	saved, err := configserver.SavePortForwards(append(forwards[:idx], forwards[idx+1:]...), reserved)
+	if err != nil {
+		return configserver.PortForward{}, err
+	}
+
+	s.logger.Info("Removed port forward %s", removed.Name)
+	return removed, s.applyForwards(len(saved))
+}
+
+// reservedPorts returns the ports the install profile gives to nginx and to
+// firewall DNAT forwards; HAProxy cannot listen on them.
+func (s *PortForwardService) reservedPorts() (map[int]string, error) {
+	profile, err := LoadInstallProfile(s.sysConfig)
+	if err != nil {
+		return nil, err
+	}
+	reserved := map[int]string{profile.Port: "nginx"}
+	for _, fwd := range profile.Firewall.DNATForwards {
+		if !strings.EqualFold(strings.TrimSpace(fwd.Protocol), "udp") {
+			reserved[fwd.Port] = "firewall DNAT forward"
+		}
+	}
+	return reserved, nil
+}
+
+// ensureHAProxy installs the package and the GWD drop-in on first use.
+func (s *PortForwardService) ensureHAProxy() error {
+	if err := s.haproxy.Validate(); err == nil {
+		return nil
+	}
+
+	s.logger.Info("Installing HAProxy...")
+	if err := s.pkgManager.EnsurePackages("haproxy"); err != nil {
+		return err
+	}
+	if err := s.haproxy.Install(); err != nil {
+		return err
+	}
+	if err := s.haproxy.Validate(); err != nil {
+		return err
+	}
+	return system.Systemctl("portforward.ensureHAProxy", "daemon-reload")
+}
+
+// applyForwards opens the forwarded ports in the firewall and restarts
+// HAProxy with the new configuration, or stops it when no forwards remain.
+func (s *PortForwardService) applyForwards(count int) error {
+	if err := s.firewall.Refresh(); err != nil {
+		return err
+	}
+	if count == 0 {
+		if !system.UnitActive(haproxyServiceName) {
+			return nil
+		}
+		s.logger.Info("No port forwards left; stopping HAProxy")
+		return system.Systemctl("portforward.applyForwards", "disable", "--now", haproxyServiceName)
+	}
+
+	if err := system.Systemctl("portforward.applyForwards", "enable", haproxyServiceName); err != nil {
+		return err
+	}
+	if system.UnitActive(haproxyServiceName) {
+		return system.Systemctl("portforward.applyForwards", "reload", haproxyServiceName)
+	}
+	return system.Systemctl("portforward.applyForwards", "start", haproxyServiceName)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const installProfileName = "install.json"
+
+// installProfilePath returns the location of the persisted install profile.
+func installProfilePath(sysCfg *system.Config) string {
+	workingDir := "/opt/GWD"
+	if sysCfg != nil && sysCfg.WorkingDir != "" {
+		workingDir = sysCfg.WorkingDir
+	}
+	return filepath.Join(workingDir, installProfileName)
+}
+
+// SaveInstallProfile persists the non-secret install inputs so later menu and
+// CLI operations can reuse them.
+func SaveInstallProfile(sysCfg *system.Config, cfg *InstallConfig) error {
+	path := installProfilePath(sysCfg)
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return profileError("profile.SaveInstallProfile", "failed to encode install profile", err, path)
+	}
+	data = append(data, '\n')
+
+	if err := system.WriteFileAtomic(path, data, 0o600); err != nil {
+		return profileError("profile.SaveInstallProfile", "failed to write install profile", err, path)
+	}
+	return nil
+}
+
+// LoadInstallProfile reads the profile saved by the last installation.
+func LoadInstallProfile(sysCfg *system.Config) (*InstallConfig, error) {
+	path := installProfilePath(sysCfg)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, profileError("profile.LoadInstallProfile", "GWD is not installed yet (install profile missing)", err, path)
+		}
+		return nil, profileError("profile.LoadInstallProfile", "failed to read install profile", err, path)
+	}
+
+	cfg := &InstallConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, profileError("profile.LoadInstallProfile", "failed to parse install profile", err, path)
+	}
+	if len(cfg.Inbounds) == 0 {
+		cfg.Inbounds = configserver.DefaultVtruiInbounds()
+	}
+	if cfg.Resolver == "" {
+		cfg.Resolver = configserver.DNSResolverUnbound
+	}
+	return cfg, nil
+}
+
+func profileError(operation, message string, err error, path string) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryConfig, apperrors.CodeConfigGeneric, message, err).
+		WithModule("profile").
+		WithOperation(operation).
+		WithField("path", path)
+}
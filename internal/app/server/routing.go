@@ -0,0 +1,38 @@
+package server
+
+import (
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/logger"
+)
+
+// RoutingService manages the vtrui routing policy and restarts vtrui so changes take effect.
+type RoutingService struct {
+	logger logger.Logger
+}
+
+// NewRoutingService constructs a RoutingService bound to the provided logger.
+func NewRoutingService(log logger.Logger) *RoutingService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &RoutingService{logger: log}
+}
+
+// RoutingPolicy returns the stored routing policy.
+func (s *RoutingService) RoutingPolicy() (configserver.VtruiRoutingPolicy, error) {
+	return configserver.LoadVtruiRouting()
+}
+
+// OutboundTags lists the outbounds that domain rules may target.
+func (s *RoutingService) OutboundTags() ([]string, error) {
+	return configserver.VtruiOutboundTags()
+}
+
+// UpdateRouting validates and stores policy, then re-renders config.json.
+func (s *RoutingService) UpdateRouting(policy configserver.VtruiRoutingPolicy) error {
+	if err := configserver.SaveVtruiRouting(policy); err != nil {
+		return err
+	}
+	s.logger.Info("Updated vtrui routing rules")
+	return reloadVtrui(s.logger, "routing.reloadVtrui")
+}
@@ -15,6 +15,16 @@ type App struct {
 	console   *ui.Console
 	menu      *menu.Menu
 	installer *Installer
+	users     *UserService
+	nodeInfo  *NodeInfoService
+	routing   *RoutingService
+	warp      *WarpService
+	forwards  *PortForwardService
+	traffic   *TrafficService
+	dns       *DNSService
+	blocklist *BlocklistService
+	firewall  *FirewallService
+	bans      *BanService
 }
 
 func NewServer(cfg *system.Config, log *logger.ColoredLogger) (*App, error) {
@@ -40,7 +50,26 @@ func NewServer(cfg *system.Config, log *logger.ColoredLogger) (*App, error) {
 	validator := NewEnvironmentValidator(cfg, log)
 
 	app.installer = NewInstaller(cfg, console, repo, validator)
+	app.users = NewUserService(log)
+	app.nodeInfo = NewNodeInfoService(cfg)
+	app.routing = NewRoutingService(log)
+	app.warp = NewWarpService(log)
+	app.forwards = NewPortForwardService(cfg, log)
+	app.traffic = NewTrafficService(log)
+	app.dns = NewDNSService(cfg, log)
+	app.blocklist = NewBlocklistService(cfg, log)
+	app.firewall = NewFirewallService(cfg, log)
+	app.bans = NewBanService(cfg, log)
 	app.menu.SetInstallHandler(app.InstallGWD)
+	app.menu.SetUserManager(app.users)
+	app.menu.SetNodeInfoProvider(app.nodeInfo)
+	app.menu.SetRoutingManager(app.routing)
+	app.menu.SetWarpManager(app.warp)
+	app.menu.SetPortForwardManager(app.forwards)
+	app.menu.SetTrafficManager(app.traffic)
+	app.menu.SetBlocklistManager(app.blocklist)
+	app.menu.SetBanManager(app.bans)
+	app.menu.SetFirewallInspector(app.firewall)
 
 	return app, nil
 }
@@ -55,5 +84,11 @@ func (a *App) InstallGWD(domainConfig *menu.DomainInfo) error {
 	if err != nil {
 		return err
 	}
-	return a.installer.InstallGWD(cfg)
+	if err := a.installer.InstallGWD(cfg); err != nil {
+		return err
+	}
+	if err := a.printNodeInfo(); err != nil {
+		a.console.Logger().Warn("Failed to show node information: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/logger"
+	"GWD/internal/traffic"
+)
+
+// TrafficService accumulates per-user vtrui traffic and enforces monthly quotas.
+type TrafficService struct {
+	logger    logger.Logger
+	client    *traffic.Client
+	storePath string
+}
+
+// NewTrafficService constructs a TrafficService using the default store under /opt/GWD.
+func NewTrafficService(log logger.Logger) *TrafficService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &TrafficService{
+		logger:    log,
+		client:    traffic.NewClient(),
+		storePath: traffic.DefaultStorePath,
+	}
+}
+
+// Collect closes the month if needed, adds the counters vtrui accumulated
+// since the previous run and suspends users who reached their quota. The
+// counters are read, saved and only then reset, so a failed save loses
+// nothing.
+func (s *TrafficService) Collect(ctx context.Context) error {
+	store, err := traffic.LoadStore(s.storePath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	store.Rollover(now)
+	changed := s.resumeExpired(store)
+
+	counters, queryErr := s.client.QueryUsers(ctx, false)
+	if queryErr == nil {
+		store.Absorb(counters, now)
+	}
+
+	changed = s.enforceQuotas(store) || changed
+
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if queryErr == nil {
+		queryErr = s.resetCounters(ctx, store)
+	}
+	if changed {
+		if err := reloadVtrui(s.logger, "traffic.reloadVtrui"); err != nil {
+			return err
+		}
+	}
+	return queryErr
+}
+
+// resetCounters zeroes the saved counters in vtrui, absorbing whatever
+// arrived since they were read. Should the second save fail, the stored
+// pending counters exceed vtrui's and the next run treats it as a restart.
+func (s *TrafficService) resetCounters(ctx context.Context, store *traffic.Store) error {
+	counters, err := s.client.QueryUsers(ctx, true)
+	if err != nil {
+		return err
+	}
+	store.Absorb(counters, time.Now())
+	store.ClearPending()
+	return store.Save()
+}
+
+// Report returns usage rows for period ("" for the current month).
+func (s *TrafficService) Report(period string) ([]traffic.UserReport, error) {
+	store, err := traffic.LoadStore(s.storePath)
+	if err != nil {
+		return nil, err
+	}
+	store.Rollover(time.Now())
+	return store.Report(period), nil
+}
+
+// Periods lists the months with recorded traffic, newest first.
+func (s *TrafficService) Periods() ([]string, error) {
+	store, err := traffic.LoadStore(s.storePath)
+	if err != nil {
+		return nil, err
+	}
+	store.Rollover(time.Now())
+	return store.Periods(), nil
+}
+
+// SetQuota sets the monthly quota for the user tagged email; zero removes it.
+func (s *TrafficService) SetQuota(email string, bytes int64) error {
+	store, err := traffic.LoadStore(s.storePath)
+	if err != nil {
+		return err
+	}
+	if _, suspended := store.Suspended[email]; !suspended {
+		if _, err := s.findUser(email); err != nil {
+			return err
+		}
+	}
+
+	store.Rollover(time.Now())
+	store.SetQuota(email, bytes)
+	if err := store.Save(); err != nil {
+		return err
+	}
+	if bytes > 0 {
+		s.logger.Info("Set monthly quota of %s to %s", email, traffic.FormatBytes(bytes))
+	} else {
+		s.logger.Info("Removed monthly quota of %s", email)
+	}
+	return nil
+}
+
+// ResumeUser re-enables a user suspended for exceeding its quota. Raise or
+// clear the quota first, otherwise the next collection suspends it again.
+func (s *TrafficService) ResumeUser(email string) error {
+	store, err := traffic.LoadStore(s.storePath)
+	if err != nil {
+		return err
+	}
+	entry, ok := store.Suspended[email]
+	if !ok {
+		return trafficServiceError("traffic.ResumeUser", "user is not suspended", nil).WithField("email", email)
+	}
+
+	if err := configserver.RestoreVtruiUser(configserver.VtruiUser{ID: entry.ID, Email: email}); err != nil {
+		return err
+	}
+	delete(store.Suspended, email)
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	s.logger.Info("Resumed vtrui user %s", email)
+	return reloadVtrui(s.logger, "traffic.reloadVtrui")
+}
+
+// enforceQuotas removes over-quota users from vtrui and remembers their UUID.
+func (s *TrafficService) enforceQuotas(store *traffic.Store) bool {
+	changed := false
+	for _, email := range store.OverQuota() {
+		user, err := configserver.RemoveVtruiUser(email)
+		if err != nil {
+			s.logger.Warn("Failed to suspend over-quota user %s: %v", email, err)
+			continue
+		}
+		store.Suspended[email] = traffic.SuspendedUser{ID: user.ID, Period: store.Period}
+		s.logger.Warn("Suspended vtrui user %s: monthly quota of %s reached", email, traffic.FormatBytes(store.Quotas[email]))
+		changed = true
+	}
+	return changed
+}
+
+// resumeExpired restores users whose suspension belongs to a closed month.
+// Failures are logged and retried on the next collection.
+func (s *TrafficService) resumeExpired(store *traffic.Store) bool {
+	changed := false
+	for email, entry := range store.Suspended {
+		if entry.Period == store.Period {
+			continue
+		}
+		err := configserver.RestoreVtruiUser(configserver.VtruiUser{ID: entry.ID, Email: email})
+		if err != nil {
+			if _, findErr := s.findUser(email); findErr != nil {
+				s.logger.Warn("Failed to resume vtrui user %s: %v", email, err)
+				continue
+			}
+			// Already re-added by hand; only the suspension record is stale.
+		} else {
+			s.logger.Info("Resumed vtrui user %s for the new month", email)
+			changed = true
+		}
+		delete(store.Suspended, email)
+	}
+	return changed
+}
+
+func (s *TrafficService) findUser(email string) (configserver.VtruiUser, error) {
+	users, err := configserver.ListVtruiUsers()
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	for _, user := range users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return configserver.VtruiUser{}, trafficServiceError("traffic.findUser", "no vtrui user with this email; quotas apply to email-tagged users", nil).
+		WithField("email", email)
+}
+
+func trafficServiceError(operation, message string, err error) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryValidation, apperrors.CodeValidationGeneric, message, err).
+		WithModule("traffic").
+		WithOperation(operation)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/logger"
+	"GWD/internal/system"
+)
+
+const vtruiServiceName = "vtrui.service"
+
+// UserService manages vtrui client accounts and restarts vtrui so changes take effect.
+type UserService struct {
+	logger logger.Logger
+}
+
+// NewUserService constructs a UserService bound to the provided logger.
+func NewUserService(log logger.Logger) *UserService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &UserService{logger: log}
+}
+
+// ListUsers returns the configured vtrui clients.
+func (s *UserService) ListUsers() ([]configserver.VtruiUser, error) {
+	return configserver.ListVtruiUsers()
+}
+
+// AddUser creates a client with a generated UUID and optional email tag.
+func (s *UserService) AddUser(email string) (configserver.VtruiUser, error) {
+	user, err := configserver.AddVtruiUser(email)
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	s.logger.Info("Added vtrui user %s", user.Label())
+	return user, reloadVtrui(s.logger, "users.reloadVtrui")
+}
+
+// RemoveUser deletes the client identified by UUID or email.
+func (s *UserService) RemoveUser(ref string) (configserver.VtruiUser, error) {
+	user, err := configserver.RemoveVtruiUser(ref)
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	s.logger.Info("Removed vtrui user %s", user.Label())
+	return user, reloadVtrui(s.logger, "users.reloadVtrui")
+}
+
+// RenameUser replaces the email tag of the client identified by UUID or email.
+func (s *UserService) RenameUser(ref, email string) (configserver.VtruiUser, error) {
+	user, err := configserver.RenameVtruiUser(ref, email)
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	s.logger.Info("Renamed vtrui user %s", user.ID)
+	return user, reloadVtrui(s.logger, "users.reloadVtrui")
+}
+
+// reloadVtrui restarts vtrui when it is running; a stopped service picks up
+// the new configuration on its next start. The running instance is left
+// untouched when "vtrui run -test" rejects the configuration on disk.
+func reloadVtrui(log logger.Logger, operation string) error {
+	if !system.UnitActive(vtruiServiceName) {
+		log.Info("vtrui is not running; changes will apply on next start")
+		return nil
+	}
+	if err := configserver.TestVtruiConfig(); err != nil {
+		return err
+	}
+	return system.Systemctl(operation, "restart", vtruiServiceName)
+}
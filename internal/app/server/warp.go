@@ -0,0 +1,178 @@
+package server
+
+import (
+	"os"
+	"reflect"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+	"GWD/internal/logger"
+	dpkg "GWD/internal/pkgmgr"
+	"GWD/internal/system"
+)
+
+const wireGuardServiceName = "wg-quick@" + configserver.WireGuardInterface
+
+// WarpService manages the Cloudflare WARP (WireGuard) upstream used as a vtrui outbound.
+type WarpService struct {
+	logger     logger.Logger
+	pkgManager *dpkg.Manager
+}
+
+// NewWarpService constructs a WarpService bound to the provided logger.
+func NewWarpService(log logger.Logger) *WarpService {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	return &WarpService{logger: log, pkgManager: dpkg.NewManager(nil)}
+}
+
+// WarpEnabled reports whether the WARP outbound is configured in vtrui.
+func (s *WarpService) WarpEnabled() (bool, error) {
+	return configserver.VtruiWarpEnabled()
+}
+
+// LoadWgcfProfile reads and validates a wgcf-profile.conf.
+func (s *WarpService) LoadWgcfProfile(path string) (configserver.WireGuardConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configserver.WireGuardConfig{}, warpError("warp.LoadWgcfProfile", "failed to read wgcf profile", err).
+			WithField("path", path)
+	}
+	return configserver.ParseWgcfProfile(data)
+}
+
+// EnableWarp writes the WireGuard configuration, starts the interface and
+// routes domains through the WARP outbound. On failure the previous
+// configuration, interface state and routing are put back.
+func (s *WarpService) EnableWarp(cfg configserver.WireGuardConfig, domains []string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	// Reject bad domains before the running tunnel is touched.
+	if _, err := configserver.VtruiWarpRouting(domains); err != nil {
+		return err
+	}
+	if err := s.pkgManager.EnsurePackages("wireguard-tools"); err != nil {
+		return err
+	}
+
+	previous, err := s.snapshotWarp()
+	if err != nil {
+		return err
+	}
+	if err := configserver.WriteWireGuardConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := s.startWarp(domains); err != nil {
+		s.rollbackWarp(previous)
+		return err
+	}
+	s.logger.Info("WARP upstream enabled on interface %s", configserver.WireGuardInterface)
+	return reloadVtrui(s.logger, "warp.reloadVtrui")
+}
+
+// warpSnapshot is the WARP state EnableWarp restores after a failure.
+type warpSnapshot struct {
+	// config is the previous wgcf.conf, nil when there was none.
+	config   []byte
+	active   bool
+	outbound bool
+	routing  configserver.VtruiRoutingPolicy
+}
+
+func (s *WarpService) snapshotWarp() (warpSnapshot, error) {
+	var snapshot warpSnapshot
+	path := configserver.WireGuardConfigPath()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return snapshot, warpError("warp.snapshotWarp", "failed to read WireGuard configuration", err).WithField("path", path)
+	}
+	snapshot.config = data
+	snapshot.active = system.UnitActive(wireGuardServiceName)
+
+	if snapshot.outbound, err = configserver.VtruiWarpEnabled(); err != nil {
+		return snapshot, err
+	}
+	if snapshot.routing, err = configserver.LoadVtruiRouting(); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// startWarp brings the interface up and adds the vtrui outbound routing domains through it.
+func (s *WarpService) startWarp(domains []string) error {
+	// Restart so a re-run with new keys replaces a running interface.
+	if err := system.Systemctl("warp.EnableWarp", "enable", wireGuardServiceName); err != nil {
+		return err
+	}
+	if err := system.Systemctl("warp.EnableWarp", "restart", wireGuardServiceName); err != nil {
+		return err
+	}
+	return configserver.EnableVtruiWarpOutbound(domains)
+}
+
+// rollbackWarp puts back the vtrui outbound and routing, the WireGuard
+// configuration and the interface state recorded before a failed
+// EnableWarp, so neither a stray outbound nor a stray tunnel is left behind
+// and a working tunnel survives a failed re-enable.
+func (s *WarpService) rollbackWarp(previous warpSnapshot) {
+	if previous.outbound {
+		if current, err := configserver.LoadVtruiRouting(); err != nil || !reflect.DeepEqual(current, previous.routing) {
+			if err := configserver.SaveVtruiRouting(previous.routing); err != nil {
+				s.logger.Warn("Failed to restore the vtrui routing policy: %v", err)
+			}
+		}
+	} else if enabled, err := configserver.VtruiWarpEnabled(); err != nil || enabled {
+		if err := configserver.DisableVtruiWarpOutbound(); err != nil {
+			s.logger.Warn("Failed to remove the WARP outbound: %v", err)
+		}
+	}
+
+	path := configserver.WireGuardConfigPath()
+	if previous.config == nil {
+		if err := system.Systemctl("warp.rollbackWarp", "disable", "--now", wireGuardServiceName); err != nil {
+			s.logger.Warn("Failed to stop %s: %v", wireGuardServiceName, err)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("Failed to remove %s: %v", path, err)
+		}
+		return
+	}
+
+	if err := system.WriteFileAtomic(path, previous.config, 0o600); err != nil {
+		s.logger.Warn("Failed to restore %s: %v", path, err)
+		return
+	}
+	operation := "stop"
+	if previous.active {
+		operation = "restart"
+	}
+	if err := system.Systemctl("warp.rollbackWarp", operation, wireGuardServiceName); err != nil {
+		s.logger.Warn("Failed to %s %s: %v", operation, wireGuardServiceName, err)
+	}
+}
+
+// DisableWarp removes the WARP outbound and its routing rules before stopping
+// the interface, so vtrui never routes to a missing device.
+func (s *WarpService) DisableWarp() error {
+	if err := configserver.DisableVtruiWarpOutbound(); err != nil {
+		return err
+	}
+	if err := reloadVtrui(s.logger, "warp.reloadVtrui"); err != nil {
+		return err
+	}
+
+	if err := system.Systemctl("warp.DisableWarp", "disable", "--now", wireGuardServiceName); err != nil {
+		return err
+	}
+	s.logger.Info("WARP upstream disabled")
+	return nil
+}
+
+func warpError(operation, message string, err error) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryConfig, apperrors.CodeConfigGeneric, message, err).
+		WithModule("warp").
+		WithOperation(operation)
+}
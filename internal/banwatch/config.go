@@ -0,0 +1,228 @@
+package banwatch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const (
+	// DefaultConfigPath is where the rules and the whitelist are persisted.
+	DefaultConfigPath = "/opt/GWD/banwatch.json"
+
+	// DefaultAccessLog and DefaultErrorLog are the stock nginx log files.
+	DefaultAccessLog = "/var/log/nginx/access.log"
+	DefaultErrorLog  = "/var/log/nginx/error.log"
+
+	defaultBanMinutes = 60
+)
+
+// Log selectors for Rule.Log.
+const (
+	LogAccess = "access"
+	LogError  = "error"
+)
+
+// WSPathsPlaceholder is replaced in rule patterns by an alternation of the
+// configured WebSocket paths; rules using it are skipped when there are none.
+const WSPathsPlaceholder = "{ws_paths}"
+
+// Rule bans a source once Pattern matched Threshold lines from it within
+// WindowSeconds. Pattern is a regular expression with a named "ip" group.
+type Rule struct {
+	Name          string `json:"name"`
+	Log           string `json:"log"`
+	Pattern       string `json:"pattern"`
+	Threshold     int    `json:"threshold"`
+	WindowSeconds int    `json:"window_seconds"`
+	Disabled      bool   `json:"disabled,omitempty"`
+}
+
+// DefaultRules match the combined access log format and the messages nginx
+// writes for failed TLS handshakes.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:          "404-flood",
+			Log:           LogAccess,
+			Pattern:       `^(?P<ip>\S+) \S+ \S+ \[[^\]]*\] "[^"]*" 404 `,
+			Threshold:     20,
+			WindowSeconds: 60,
+		},
+		{
+			Name:          "ws-probe",
+			Log:           LogAccess,
+			Pattern:       `^(?P<ip>\S+) \S+ \S+ \[[^\]]*\] "\S+ (?:` + WSPathsPlaceholder + `)(?:[/?][^"]*)? [^"]*" 404 `,
+			Threshold:     3,
+			WindowSeconds: 300,
+		},
+		{
+			Name:          "tls-handshake",
+			Log:           LogError,
+			Pattern:       `(?:SSL_do_handshake\(\) failed|no "ssl_certificate"|client sent invalid|wrong version number).*client: (?P<ip>[0-9A-Fa-f.:]+)`,
+			Threshold:     5,
+			WindowSeconds: 60,
+		},
+	}
+}
+
+// Config lists the watched logs, the rules, the ban length and the addresses
+// that are never banned.
+type Config struct {
+	Enabled    bool     `json:"enabled"`
+	AccessLog  string   `json:"access_log"`
+	ErrorLog   string   `json:"error_log"`
+	BanMinutes int      `json:"ban_minutes"`
+	Whitelist  []string `json:"whitelist"`
+	Rules      []Rule   `json:"rules"`
+
+	path string
+}
+
+// LoadConfig reads the config at path, returning the defaults when it does
+// not exist yet.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, banwatchError("banwatch.LoadConfig", "failed to read ban watcher configuration", err).WithField("path", path)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, banwatchError("banwatch.LoadConfig", "failed to parse ban watcher configuration", err).WithField("path", path)
+		}
+	}
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+// Save writes the config atomically.
+func (c *Config) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return banwatchError("banwatch.Config.Save", "failed to encode ban watcher configuration", err)
+	}
+
+	if err := system.WriteFileAtomic(c.path, append(data, '\n'), 0o644); err != nil {
+		return banwatchError("banwatch.Config.Save", "failed to write ban watcher configuration", err).WithField("path", c.path)
+	}
+	return nil
+}
+
+// Whitelisted reports whether addr is exempt from bans. Loopback addresses
+// are always exempt.
+func (c *Config) Whitelisted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() {
+		return true
+	}
+	for _, prefix := range whitelistPrefixes(c.Whitelist) {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhitelistCIDRs returns the valid whitelist entries as CIDRs, bare
+// addresses becoming single-host prefixes.
+func (c *Config) WhitelistCIDRs() []string {
+	prefixes := whitelistPrefixes(c.Whitelist)
+	cidrs := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidrs = append(cidrs, prefix.String())
+	}
+	return cidrs
+}
+
+// Allow adds an address or CIDR to the whitelist.
+func (c *Config) Allow(entry string) error {
+	prefix, ok := parsePrefix(entry)
+	if !ok {
+		return validationError("banwatch.Config.Allow", "whitelist entry must be an IP address or CIDR").WithField("entry", entry)
+	}
+	normalized := prefix.String()
+	for _, existing := range c.Whitelist {
+		if existing == normalized {
+			return nil
+		}
+	}
+	c.Whitelist = append(c.Whitelist, normalized)
+	return nil
+}
+
+// Unallow removes entry from the whitelist; it reports whether it was listed.
+func (c *Config) Unallow(entry string) bool {
+	prefix, ok := parsePrefix(entry)
+	if !ok {
+		return false
+	}
+	normalized := prefix.String()
+	for idx, existing := range c.Whitelist {
+		if existing == normalized {
+			c.Whitelist = append(c.Whitelist[:idx], c.Whitelist[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) applyDefaults() {
+	if c.AccessLog == "" {
+		c.AccessLog = DefaultAccessLog
+	}
+	if c.ErrorLog == "" {
+		c.ErrorLog = DefaultErrorLog
+	}
+	if c.BanMinutes <= 0 {
+		c.BanMinutes = defaultBanMinutes
+	}
+	if c.Rules == nil {
+		c.Rules = DefaultRules()
+	}
+}
+
+func whitelistPrefixes(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, ok := parsePrefix(entry); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// parsePrefix accepts a bare address as a single-host prefix.
+func parsePrefix(entry string) (netip.Prefix, bool) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+func banwatchError(operation, message string, err error) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryFirewall, apperrors.CodeFirewallGeneric, message, err).
+		WithModule("banwatch").
+		WithOperation(operation)
+}
+
+func validationError(operation, message string) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryValidation, apperrors.CodeValidationGeneric, message, nil).
+		WithModule("banwatch").
+		WithOperation(operation)
+}
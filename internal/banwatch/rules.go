@@ -0,0 +1,88 @@
+package banwatch
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// compiledRule is a Rule ready for matching.
+type compiledRule struct {
+	Rule
+	re      *regexp.Regexp
+	ipGroup int
+}
+
+// match returns the source address of line when it matches the rule.
+func (r *compiledRule) match(line string) (netip.Addr, bool) {
+	groups := r.re.FindStringSubmatch(line)
+	if groups == nil {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(groups[r.ipGroup])
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// compileRules validates and compiles the enabled rules. wsPaths fill the
+// WSPathsPlaceholder; rules that need them are dropped when there are none.
+func compileRules(rules []Rule, wsPaths []string) ([]*compiledRule, error) {
+	alternation := make([]string, 0, len(wsPaths))
+	for _, path := range wsPaths {
+		if path = strings.TrimSpace(path); path != "" {
+			alternation = append(alternation, regexp.QuoteMeta(path))
+		}
+	}
+
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		if err := validateRule(rule); err != nil {
+			return nil, err
+		}
+
+		pattern := rule.Pattern
+		if strings.Contains(pattern, WSPathsPlaceholder) {
+			if len(alternation) == 0 {
+				continue
+			}
+			pattern = strings.ReplaceAll(pattern, WSPathsPlaceholder, strings.Join(alternation, "|"))
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, validationError("banwatch.compileRules", "invalid rule pattern: "+err.Error()).WithField("rule", rule.Name)
+		}
+		ipGroup := re.SubexpIndex("ip")
+		if ipGroup < 0 {
+			return nil, validationError("banwatch.compileRules", `rule pattern must have a named "ip" group`).WithField("rule", rule.Name)
+		}
+		compiled = append(compiled, &compiledRule{Rule: rule, re: re, ipGroup: ipGroup})
+	}
+	return compiled, nil
+}
+
+// Validate checks every enabled rule, filling the WebSocket placeholder with a
+// dummy path so those rules are compiled as well.
+func (c *Config) Validate() error {
+	_, err := compileRules(c.Rules, []string{"/"})
+	return err
+}
+
+func validateRule(rule Rule) error {
+	switch {
+	case rule.Name == "":
+		return validationError("banwatch.validateRule", "rule name is required")
+	case rule.Log != LogAccess && rule.Log != LogError:
+		return validationError("banwatch.validateRule", `rule log must be "access" or "error"`).WithField("rule", rule.Name)
+	case rule.Threshold <= 0:
+		return validationError("banwatch.validateRule", "rule threshold must be positive").WithField("rule", rule.Name)
+	case rule.WindowSeconds <= 0:
+		return validationError("banwatch.validateRule", "rule window must be positive").WithField("rule", rule.Name)
+	}
+	return nil
+}
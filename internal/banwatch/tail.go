@@ -0,0 +1,135 @@
+package banwatch
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+// maxLineLength bounds a buffered partial line; longer lines are dropped.
+const maxLineLength = 64 * 1024
+
+// tailer follows a log file across logrotate renames and truncation. The
+// first open starts at the end of the file so a restart does not replay old
+// lines; files that appear later (after rotation) are read from the start.
+type tailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial []byte
+	started bool
+}
+
+func newTailer(path string) *tailer {
+	return &tailer{path: path}
+}
+
+// poll hands every complete line appended since the last call to emit. A
+// missing file is not an error; it is retried on the next poll.
+func (t *tailer) poll(emit func(string)) error {
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := t.readLines(emit); err != nil {
+		return err
+	}
+
+	current, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Rotated away and not recreated yet; keep the old handle.
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(current, t.info):
+		// Rotated: the old file was drained above, continue with the new one.
+		t.close()
+		if err := t.open(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if t.file != nil {
+			return t.readLines(emit)
+		}
+	case current.Size() < t.offset:
+		// Truncated in place (copytruncate).
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset = 0
+		t.partial = nil
+		t.reader.Reset(t.file)
+	}
+	return nil
+}
+
+func (t *tailer) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	var offset int64
+	if !t.started {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	t.started = true
+	t.file = file
+	t.info = info
+	t.offset = offset
+	t.partial = nil
+	t.reader = bufio.NewReader(file)
+	return nil
+}
+
+func (t *tailer) readLines(emit func(string)) error {
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.offset += int64(len(chunk))
+		switch {
+		case err == nil:
+			line := chunk[:len(chunk)-1]
+			if len(t.partial) > 0 {
+				line = append(t.partial, line...)
+				t.partial = nil
+			}
+			emit(string(line))
+		case errors.Is(err, bufio.ErrBufferFull), errors.Is(err, io.EOF):
+			// Keep the unterminated tail until the writer completes the line.
+			if len(t.partial)+len(chunk) > maxLineLength {
+				t.partial = nil
+			} else {
+				t.partial = append(t.partial, chunk...)
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+		default:
+			return err
+		}
+	}
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+	t.file = nil
+	t.reader = nil
+}
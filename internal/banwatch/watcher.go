@@ -0,0 +1,157 @@
+package banwatch
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"GWD/internal/logger"
+)
+
+const pollInterval = time.Second
+
+// BanFunc bans addr for timeout.
+type BanFunc func(addr netip.Addr, timeout time.Duration) error
+
+type hitKey struct {
+	rule string
+	addr netip.Addr
+}
+
+// Watcher tails the nginx logs and bans sources that trip a rule.
+type Watcher struct {
+	cfg     *Config
+	rules   map[string][]*compiledRule
+	windows map[string]time.Duration
+	ban     BanFunc
+	logger  logger.Logger
+	now     func() time.Time
+
+	hits   map[hitKey][]time.Time
+	banned map[netip.Addr]time.Time
+}
+
+// NewWatcher compiles the configured rules; wsPaths are the WebSocket
+// locations nginx proxies to vtrui.
+func NewWatcher(cfg *Config, wsPaths []string, ban BanFunc, log logger.Logger) (*Watcher, error) {
+	if log == nil {
+		log = logger.NewStandardLogger()
+	}
+	compiled, err := compileRules(cfg.Rules, wsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string][]*compiledRule)
+	windows := make(map[string]time.Duration)
+	for _, rule := range compiled {
+		rules[rule.Log] = append(rules[rule.Log], rule)
+		windows[rule.Name] = rule.window()
+	}
+	return &Watcher{
+		cfg:     cfg,
+		rules:   rules,
+		windows: windows,
+		ban:     ban,
+		logger:  log,
+		now:     time.Now,
+		hits:    make(map[hitKey][]time.Time),
+		banned:  make(map[netip.Addr]time.Time),
+	}, nil
+}
+
+// Run follows the access and error logs until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	logs := map[string]*tailer{}
+	if len(w.rules[LogAccess]) > 0 {
+		logs[LogAccess] = newTailer(w.cfg.AccessLog)
+	}
+	if len(w.rules[LogError]) > 0 {
+		logs[LogError] = newTailer(w.cfg.ErrorLog)
+	}
+	defer func() {
+		for _, t := range logs {
+			t.close()
+		}
+	}()
+	w.logger.Info("Watching nginx logs with %d rules", len(w.rules[LogAccess])+len(w.rules[LogError]))
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for log, t := range logs {
+			if err := t.poll(func(line string) { w.Observe(log, line) }); err != nil {
+				w.logger.Warn("Failed to read %s: %v", t.path, err)
+				t.close()
+			}
+		}
+		w.expire()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Observe feeds one line of the given log through the matching rules.
+func (w *Watcher) Observe(log, line string) {
+	now := w.now()
+	for _, rule := range w.rules[log] {
+		addr, ok := rule.match(line)
+		if !ok || w.cfg.Whitelisted(addr) {
+			continue
+		}
+		if until, banned := w.banned[addr]; banned && now.Before(until) {
+			continue
+		}
+
+		key := hitKey{rule: rule.Name, addr: addr}
+		hits := append(pruneHits(w.hits[key], now, w.windows[rule.Name]), now)
+		if len(hits) < rule.Threshold {
+			w.hits[key] = hits
+			continue
+		}
+		delete(w.hits, key)
+
+		timeout := time.Duration(w.cfg.BanMinutes) * time.Minute
+		if err := w.ban(addr, timeout); err != nil {
+			w.logger.Warn("Failed to ban %s (%s): %v", addr, rule.Name, err)
+			continue
+		}
+		w.banned[addr] = now.Add(timeout)
+		w.logger.Info("Banned %s for %s: rule %s matched %d times", addr, timeout, rule.Name, len(hits))
+	}
+}
+
+// expire forgets stale counters and elapsed bans so memory stays bounded.
+func (w *Watcher) expire() {
+	now := w.now()
+	for key, hits := range w.hits {
+		if remaining := pruneHits(hits, now, w.windows[key.rule]); len(remaining) > 0 {
+			w.hits[key] = remaining
+		} else {
+			delete(w.hits, key)
+		}
+	}
+	for addr, until := range w.banned {
+		if !now.Before(until) {
+			delete(w.banned, addr)
+		}
+	}
+}
+
+func (r *compiledRule) window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+// pruneHits drops the timestamps that fell out of the window.
+func pruneHits(hits []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	idx := 0
+	for idx < len(hits) && !hits[idx].After(cutoff) {
+		idx++
+	}
+	return hits[idx:]
+}
@@ -0,0 +1,133 @@
+package blocklist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fetchTimeout = 60 * time.Second
+	// maxSourceSize guards against runaway downloads.
+	maxSourceSize = 64 << 20
+)
+
+// Result is a compiled blocklist ready to be rendered for a resolver.
+type Result struct {
+	// Blocked holds the minimal set of zones to block; subdomains of a
+	// blocked zone are dropped because blocking a zone covers them.
+	Blocked []string
+	// Allowed holds allowlisted domains that sit inside a blocked zone and
+	// must be exempted explicitly.
+	Allowed []string
+	Stats   Stats
+}
+
+// Compile loads every source, merges the domains and applies the allowlist.
+// A failing source is recorded in the stats and skipped; Compile fails only
+// when every source failed.
+func Compile(ctx context.Context, cfg *Config, client *http.Client) (Result, error) {
+	if client == nil {
+		client = &http.Client{Timeout: fetchTimeout}
+	}
+
+	blocked := make(map[string]struct{})
+	allowed := make(map[string]struct{})
+	for _, domain := range cfg.Allowlist {
+		allowed[domain] = struct{}{}
+	}
+
+	stats := Stats{UpdatedAt: time.Now()}
+	failures := 0
+	for _, source := range cfg.Sources {
+		entry := SourceStats{Source: source}
+		domains, exceptions, err := loadSource(ctx, client, source)
+		if err != nil {
+			entry.Error = err.Error()
+			failures++
+		}
+		for _, domain := range domains {
+			blocked[domain] = struct{}{}
+		}
+		for _, domain := range exceptions {
+			allowed[domain] = struct{}{}
+		}
+		entry.Domains = len(domains)
+		stats.Sources = append(stats.Sources, entry)
+	}
+	if failures > 0 && failures == len(cfg.Sources) {
+		return Result{Stats: stats}, blocklistError("blocklist.Compile", "all blocklist sources failed", nil).
+			WithField("sources", len(cfg.Sources))
+	}
+
+	result := Result{Stats: stats}
+	for domain := range blocked {
+		if coveredBy(domain, allowed) || coveredBy(parentOf(domain), blocked) {
+			continue
+		}
+		result.Blocked = append(result.Blocked, domain)
+	}
+	for domain := range allowed {
+		if coveredBy(parentOf(domain), blocked) {
+			result.Allowed = append(result.Allowed, domain)
+		}
+	}
+	sort.Strings(result.Blocked)
+	sort.Strings(result.Allowed)
+
+	result.Stats.Blocked = len(result.Blocked)
+	result.Stats.Allowed = len(cfg.Allowlist)
+	return result, nil
+}
+
+// coveredBy reports whether domain or one of its parents is in set.
+func coveredBy(domain string, set map[string]struct{}) bool {
+	for domain != "" {
+		if _, ok := set[domain]; ok {
+			return true
+		}
+		domain = parentOf(domain)
+	}
+	return false
+}
+
+func parentOf(domain string) string {
+	_, parent, ok := strings.Cut(domain, ".")
+	if !ok || !strings.Contains(parent, ".") {
+		return ""
+	}
+	return parent
+}
+
+func loadSource(ctx context.Context, client *http.Client, source string) ([]string, []string, error) {
+	var body io.ReadCloser
+	if isRemoteSource(source) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = f
+	}
+	defer body.Close()
+
+	return Parse(io.LimitReader(body, maxSourceSize))
+}
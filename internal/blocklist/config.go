@@ -0,0 +1,139 @@
+package blocklist
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+// DefaultConfigPath is where sources, the allowlist and the last refresh
+// statistics are persisted.
+const DefaultConfigPath = "/opt/GWD/blocklist.json"
+
+// SourceStats describes the outcome of loading one source.
+type SourceStats struct {
+	Source  string `json:"source"`
+	Domains int    `json:"domains"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Stats summarizes the last compiled blocklist.
+type Stats struct {
+	UpdatedAt time.Time     `json:"updated_at"`
+	Blocked   int           `json:"blocked"`
+	Allowed   int           `json:"allowed"`
+	Sources   []SourceStats `json:"sources,omitempty"`
+}
+
+// Config lists the blocklist sources (http(s) URLs or local files) and the
+// domains exempted from blocking.
+type Config struct {
+	Sources   []string `json:"sources"`
+	Allowlist []string `json:"allowlist"`
+	Stats     Stats    `json:"stats"`
+
+	path string
+}
+
+// LoadConfig reads the config at path, returning an empty config when it does
+// not exist yet.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, blocklistError("blocklist.LoadConfig", "failed to read blocklist configuration", err).WithField("path", path)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, blocklistError("blocklist.LoadConfig", "failed to parse blocklist configuration", err).WithField("path", path)
+		}
+	}
+	return cfg, nil
+}
+
+// Save writes the config atomically.
+func (c *Config) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return blocklistError("blocklist.Config.Save", "failed to encode blocklist configuration", err)
+	}
+
+	if err := system.WriteFileAtomic(c.path, append(data, '\n'), 0o644); err != nil {
+		return blocklistError("blocklist.Config.Save", "failed to write blocklist configuration", err).WithField("path", c.path)
+	}
+	return nil
+}
+
+// AddSource appends an http(s) URL or absolute file path.
+func (c *Config) AddSource(source string) error {
+	source = strings.TrimSpace(source)
+	if !isRemoteSource(source) && !filepath.IsAbs(source) {
+		return validationError("blocklist.Config.AddSource", "source must be an http(s) URL or an absolute file path").
+			WithField("source", source)
+	}
+	for _, existing := range c.Sources {
+		if existing == source {
+			return validationError("blocklist.Config.AddSource", "source already configured").WithField("source", source)
+		}
+	}
+	c.Sources = append(c.Sources, source)
+	return nil
+}
+
+// RemoveSource deletes source; it reports whether it was configured.
+func (c *Config) RemoveSource(source string) bool {
+	return removeString(&c.Sources, strings.TrimSpace(source))
+}
+
+// Allow exempts domain and its subdomains from blocking.
+func (c *Config) Allow(domain string) error {
+	normalized, ok := NormalizeDomain(domain)
+	if !ok {
+		return validationError("blocklist.Config.Allow", "invalid domain").WithField("domain", domain)
+	}
+	for _, existing := range c.Allowlist {
+		if existing == normalized {
+			return nil
+		}
+	}
+	c.Allowlist = append(c.Allowlist, normalized)
+	return nil
+}
+
+// Unallow removes domain from the allowlist; it reports whether it was listed.
+func (c *Config) Unallow(domain string) bool {
+	normalized, _ := NormalizeDomain(domain)
+	return removeString(&c.Allowlist, normalized)
+}
+
+func removeString(values *[]string, target string) bool {
+	for idx, value := range *values {
+		if value == target {
+			*values = append((*values)[:idx], (*values)[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+func blocklistError(operation, message string, err error) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategorySystem, apperrors.CodeSystemGeneric, message, err).
+		WithModule("blocklist").
+		WithOperation(operation)
+}
+
+func validationError(operation, message string) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategoryValidation, apperrors.CodeValidationGeneric, message, nil).
+		WithModule("blocklist").
+		WithOperation(operation)
+}
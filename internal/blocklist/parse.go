@@ -0,0 +1,117 @@
+package blocklist
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// maxLineLength bounds a single list line; longer lines are skipped.
+const maxLineLength = 64 * 1024
+
+// hostsSinkholes are the addresses hosts-format lists map blocked names to.
+var hostsSinkholes = map[string]struct{}{
+	"0.0.0.0": {}, "127.0.0.1": {}, "::": {}, "::1": {},
+}
+
+// localNames are entries of a stock hosts file that must never be blocked.
+var localNames = map[string]struct{}{
+	"localhost": {}, "localhost.localdomain": {}, "local": {}, "broadcasthost": {},
+	"ip6-localhost": {}, "ip6-loopback": {}, "ip6-localnet": {}, "ip6-mcastprefix": {},
+	"ip6-allnodes": {}, "ip6-allrouters": {}, "ip6-allhosts": {}, "0.0.0.0": {},
+}
+
+// Parse extracts domains from hosts-format, AdBlock-format ("||example.com^")
+// or plain one-domain-per-line content. AdBlock exception rules
+// ("@@||example.com^") are returned as allowed. Rules that only make sense in
+// a browser (paths, wildcards, element hiding) are ignored.
+func Parse(r io.Reader) (blocked, allowed []string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+		if idx := strings.Index(line, " #"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+
+		if strings.HasPrefix(line, "@@||") {
+			if domain, ok := parseAdBlockRule(line[4:]); ok {
+				allowed = append(allowed, domain)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "||") {
+			if domain, ok := parseAdBlockRule(line[2:]); ok {
+				blocked = append(blocked, domain)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			if _, sink := hostsSinkholes[fields[0]]; !sink {
+				continue
+			}
+			for _, name := range fields[1:] {
+				if domain, ok := NormalizeDomain(name); ok {
+					blocked = append(blocked, domain)
+				}
+			}
+			continue
+		}
+		if domain, ok := NormalizeDomain(fields[0]); ok {
+			blocked = append(blocked, domain)
+		}
+	}
+	return blocked, allowed, scanner.Err()
+}
+
+// parseAdBlockRule accepts "example.com^" optionally followed by the
+// $important or $third-party modifiers, which do not change DNS semantics.
+func parseAdBlockRule(rule string) (string, bool) {
+	rule, modifiers, _ := strings.Cut(rule, "$")
+	for _, modifier := range strings.Split(modifiers, ",") {
+		switch modifier {
+		case "", "important", "third-party", "3p", "all":
+		default:
+			return "", false
+		}
+	}
+	domain, ok := strings.CutSuffix(rule, "^")
+	if !ok || strings.ContainsAny(domain, "/*^|") {
+		return "", false
+	}
+	return NormalizeDomain(domain)
+}
+
+// NormalizeDomain lowercases name, strips a trailing dot and reports whether
+// it is a blockable host name.
+func NormalizeDomain(name string) (string, bool) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if name == "" || len(name) > 253 || net.ParseIP(name) != nil {
+		return "", false
+	}
+	if _, local := localNames[name]; local {
+		return "", false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return "", false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", false
+		}
+		for _, r := range label {
+			if !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z') {
+				return "", false
+			}
+		}
+	}
+	return name, true
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	apperrors "GWD/internal/errors"
+)
+
+// backupSuffix marks the copy of the pre-GWD version of a system file. It is
+// written once, so repeated runs keep the original for manual recovery.
+const backupSuffix = ".gwd.bak"
+
+// fileSnapshot captures a file (or symlink) so a failed change can be rolled
+// back exactly, including /etc/resolv.conf being a symlink or absent.
+type fileSnapshot struct {
+	path   string
+	exists bool
+	link   string
+	data   []byte
+	mode   os.FileMode
+}
+
+// snapshotFile records the current state of path and keeps a one-time
+// on-disk copy next to it.
+func snapshotFile(path string) (*fileSnapshot, error) {
+	snap := &fileSnapshot{path: path}
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, newConfiguratorError("configurator.snapshotFile", "failed to inspect file", err, apperrors.Metadata{"path": path})
+	}
+	snap.exists = true
+	snap.mode = info.Mode().Perm()
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if snap.link, err = os.Readlink(path); err != nil {
+			return nil, newConfiguratorError("configurator.snapshotFile", "failed to read symlink", err, apperrors.Metadata{"path": path})
+		}
+	}
+	// Follow symlinks for the content copy; a dangling link has none.
+	if data, err := os.ReadFile(path); err == nil {
+		snap.data = data
+	} else if snap.link == "" {
+		return nil, newConfiguratorError("configurator.snapshotFile", "failed to read file", err, apperrors.Metadata{"path": path})
+	}
+
+	backupPath := path + backupSuffix
+	if _, err := os.Lstat(backupPath); errors.Is(err, os.ErrNotExist) && snap.data != nil {
+		if err := os.WriteFile(backupPath, snap.data, 0o644); err != nil {
+			return nil, newConfiguratorError("configurator.snapshotFile", "failed to write backup", err, apperrors.Metadata{"path": backupPath})
+		}
+	}
+	return snap, nil
+}
+
+// restore puts the file back into the recorded state.
+func (s *fileSnapshot) restore() error {
+	if err := os.RemoveAll(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return newConfiguratorError("configurator.fileSnapshot.restore", "failed to remove modified file", err, apperrors.Metadata{"path": s.path})
+	}
+	if !s.exists {
+		return nil
+	}
+	if s.link != "" {
+		if err := os.Symlink(s.link, s.path); err != nil {
+			return newConfiguratorError("configurator.fileSnapshot.restore", "failed to restore symlink", err, apperrors.Metadata{"path": s.path, "target": s.link})
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return newConfiguratorError("configurator.fileSnapshot.restore", "failed to create directory", err, apperrors.Metadata{"path": s.path})
+	}
+	if err := os.WriteFile(s.path, s.data, s.mode); err != nil {
+		return newConfiguratorError("configurator.fileSnapshot.restore", "failed to restore file", err, apperrors.Metadata{"path": s.path})
+	}
+	return nil
+}
+
+// restoreSnapshots restores every snapshot and returns the first failure.
+func restoreSnapshots(snaps []*fileSnapshot) error {
+	var first error
+	for _, snap := range snaps {
+		if err := snap.restore(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
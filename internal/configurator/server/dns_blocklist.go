@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const (
+	unboundBlocklistFile  = "/etc/unbound/blocklist.conf"
+	smartDNSBlocklistFile = "/opt/GWD/smartdns/blocklist.conf"
+)
+
+// WriteDNSBlocklist renders the compiled blocklist for both resolver
+// backends: unbound local-zones answering NXDOMAIN and SmartDNS address
+// rules returning SOA. Allowed entries exempt subdomains of blocked zones.
+func WriteDNSBlocklist(blocked, allowed []string) error {
+	var unbound, smartdns bytes.Buffer
+	unbound.WriteString("# Generated by GWD; refreshed by gwd-blocklist.timer\nserver:\n")
+	smartdns.WriteString("# Generated by GWD; refreshed by gwd-blocklist.timer\n")
+	for _, domain := range blocked {
+		fmt.Fprintf(&unbound, "  local-zone: \"%s.\" always_nxdomain\n", domain)
+		fmt.Fprintf(&smartdns, "address /%s/#\n", domain)
+	}
+	for _, domain := range allowed {
+		fmt.Fprintf(&unbound, "  local-zone: \"%s.\" transparent\n", domain)
+		fmt.Fprintf(&smartdns, "address /%s/-\n", domain)
+	}
+
+	files := []struct {
+		path    string
+		content []byte
+	}{
+		{unboundBlocklistFile, unbound.Bytes()},
+		{smartDNSBlocklistFile, smartdns.Bytes()},
+	}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0o755); err != nil {
+			return newConfiguratorError(
+				"configurator.WriteDNSBlocklist",
+				"failed to create blocklist directory",
+				err,
+				apperrors.Metadata{"path": filepath.Dir(file.path)},
+			)
+		}
+		if err := system.WriteFileAtomic(file.path, file.content, 0o644); err != nil {
+			return newConfiguratorError(
+				"configurator.WriteDNSBlocklist",
+				"failed to write DNS blocklist",
+				err,
+				apperrors.Metadata{"path": file.path},
+			)
+		}
+	}
+	return nil
+}
+
+// ensureBlocklistInclude creates an empty include file so resolver
+// configurations can reference it before the first refresh.
+func ensureBlocklistInclude(path, content string) error {
+	if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return newConfiguratorError(
+			"configurator.ensureBlocklistInclude",
+			"failed to create blocklist directory",
+			err,
+			apperrors.Metadata{"path": filepath.Dir(path)},
+		)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return newConfiguratorError(
+			"configurator.ensureBlocklistInclude",
+			"failed to create empty DNS blocklist",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return nil
+}
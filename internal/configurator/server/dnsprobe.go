@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	apperrors "GWD/internal/errors"
+)
+
+const (
+	// LocalResolverAddress is where unbound and SmartDNS listen.
+	LocalResolverAddress = "127.0.0.1:53"
+
+	dnsProbeTimeout  = 3 * time.Second
+	dnsProbeAttempts = 3
+	dnsProbeInterval = time.Second
+)
+
+// dnsProbeNames are looked up to prove the resolver reaches the internet.
+var dnsProbeNames = []string{"deb.debian.org", "www.cloudflare.com"}
+
+// ProbeResolver verifies that the DNS server at addr answers A queries with
+// addresses and AAAA queries with an answer or NODATA (SmartDNS may return SOA
+// for AAAA by design). It retries briefly to cover a resolver that just started.
+func ProbeResolver(ctx context.Context, addr string) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < dnsProbeAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return dnsProbeError(addr, ctx.Err())
+			case <-time.After(dnsProbeInterval):
+			}
+		}
+		if lastErr = probeOnce(ctx, resolver); lastErr == nil {
+			return nil
+		}
+	}
+	return dnsProbeError(addr, lastErr)
+}
+
+func probeOnce(ctx context.Context, resolver *net.Resolver) error {
+	var lastErr error
+	for _, name := range dnsProbeNames {
+		queryCtx, cancel := context.WithTimeout(ctx, dnsProbeTimeout)
+		ips, err := resolver.LookupIP(queryCtx, "ip4", name)
+		if err == nil && len(ips) > 0 {
+			_, err = resolver.LookupIP(queryCtx, "ip6", name)
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				err = nil
+			}
+		} else if err == nil {
+			err = errors.New("no A records returned for " + name)
+		}
+		cancel()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// verifySystemResolver checks that /etc/resolv.conf sends queries to the
+// local resolver first and that it answers.
+func verifySystemResolver(ctx context.Context) error {
+	servers, err := resolvConfNameservers(etcResolvConf)
+	if err != nil {
+		return newConfiguratorError("configurator.verifySystemResolver", "failed to read resolv.conf", err, apperrors.Metadata{"path": etcResolvConf})
+	}
+	host, _, _ := net.SplitHostPort(LocalResolverAddress)
+	if len(servers) == 0 || servers[0] != host {
+		return newConfiguratorError(
+			"configurator.verifySystemResolver",
+			"resolv.conf does not point at the local resolver",
+			nil,
+			apperrors.Metadata{"path": etcResolvConf, "nameservers": strings.Join(servers, ", ")},
+		)
+	}
+	return ProbeResolver(ctx, LocalResolverAddress)
+}
+
+func resolvConfNameservers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
+
+func dnsProbeError(addr string, err error) error {
+	return apperrors.New(apperrors.ErrCategoryNetwork, apperrors.CodeNetworkGeneric, "DNS resolver did not answer A/AAAA probes", err).
+		WithModule("configurator").
+		WithOperation("configurator.ProbeResolver").
+		WithField("resolver", addr)
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	resolvedDropInDir  = "/etc/systemd/resolved.conf.d"
+	resolvedDropInFile = "/etc/systemd/resolved.conf.d/gwd-dns.conf"
+	resolvedStubPrefix = "/run/systemd/resolve/"
+	netplanDir         = "/etc/netplan"
+	netplanGWDFile     = "/etc/netplan/99-gwd-dns.yaml"
+	netplanBinary      = "/usr/sbin/netplan"
+	nmConfigFile       = "/etc/NetworkManager/conf.d/90-gwd-dns.conf"
+
+	resolvedDropInContent = `# Managed by GWD: resolve through the local resolver only.
+[Resolve]
+DNS=127.0.0.1
+Domains=~.
+DNSStubListener=no
+`
+	nmConfigContent = `# Managed by GWD: keep NetworkManager from rewriting resolv.conf.
+[main]
+dns=none
+rc-manager=unmanaged
+`
+)
+
+// dnsMethod points one component of the host network stack at the local
+// resolver. Files lists everything Apply may touch so it can be snapshotted
+// and restored; Reload makes the component re-read its restored files.
+type dnsMethod interface {
+	Name() string
+	Files() []string
+	Apply() error
+	Reload() error
+}
+
+// detectDNSMethods inspects the running network/DNS stack. resolvconf with
+// ifupdown is the fallback when neither systemd-resolved nor NetworkManager
+// manages resolv.conf.
+func detectDNSMethods() []dnsMethod {
+	var methods []dnsMethod
+	resolved := system.UnitActive("systemd-resolved.service") || resolvConfManagedByResolved()
+	networkManager := system.UnitActive("NetworkManager.service")
+
+	if networkManager {
+		methods = append(methods, networkManagerMethod{})
+	}
+	if files := netplanFiles(); len(files) > 0 {
+		if _, err := os.Stat(netplanBinary); err == nil {
+			methods = append(methods, netplanMethod{})
+		}
+	}
+	if resolved {
+		methods = append(methods, resolvedMethod{})
+	}
+	if !resolved && !networkManager {
+		methods = append(methods, resolvconfMethod{})
+	}
+	return methods
+}
+
+// DNSStack returns the names of the methods the resolver setup applies on
+// this host, e.g. "systemd-resolved, netplan".
+func DNSStack() []string {
+	var names []string
+	for _, method := range detectDNSMethods() {
+		names = append(names, method.Name())
+	}
+	return names
+}
+
+// resolvconfMethod is the Debian resolvconf + ifupdown setup.
+type resolvconfMethod struct{}
+
+func (resolvconfMethod) Name() string { return "resolvconf" }
+
+func (resolvconfMethod) Files() []string {
+	return []string{resolvconfHeadFile, resolvconfOriginal, resolvconfBase, resolvconfTail, etcResolvConf, systemInterfacesFile}
+}
+
+func (resolvconfMethod) Apply() error { return applyResolvconfConfig() }
+
+func (resolvconfMethod) Reload() error {
+	_ = exec.Command("resolvconf", "-u").Run()
+	return nil
+}
+
+// resolvedMethod routes systemd-resolved to 127.0.0.1, disables its stub
+// listener and replaces the stub resolv.conf symlink with a static file.
+type resolvedMethod struct{}
+
+func (resolvedMethod) Name() string { return "systemd-resolved" }
+
+func (resolvedMethod) Files() []string { return []string{resolvedDropInFile, etcResolvConf} }
+
+func (resolvedMethod) Apply() error {
+	if err := os.MkdirAll(resolvedDropInDir, 0o755); err != nil {
+		return newConfiguratorError("configurator.resolvedMethod.Apply", "failed to create resolved drop-in directory", err,
+			apperrors.Metadata{"path": resolvedDropInDir})
+	}
+	if err := system.WriteFileAtomic(resolvedDropInFile, []byte(resolvedDropInContent), 0o644); err != nil {
+		return newConfiguratorError("configurator.resolvedMethod.Apply", "failed to write resolved drop-in", err,
+			apperrors.Metadata{"path": resolvedDropInFile})
+	}
+	if err := system.Systemctl("configurator.resolvedMethod.Apply", "restart", "systemd-resolved.service"); err != nil {
+		return err
+	}
+	return writeStaticResolvConf()
+}
+
+func (resolvedMethod) Reload() error {
+	return system.Systemctl("configurator.resolvedMethod.Reload", "restart", "systemd-resolved.service")
+}
+
+// networkManagerMethod stops NetworkManager from managing resolv.conf.
+type networkManagerMethod struct{}
+
+func (networkManagerMethod) Name() string { return "NetworkManager" }
+
+func (networkManagerMethod) Files() []string { return []string{nmConfigFile, etcResolvConf} }
+
+func (networkManagerMethod) Apply() error {
+	if err := os.MkdirAll(filepath.Dir(nmConfigFile), 0o755); err != nil {
+		return newConfiguratorError("configurator.networkManagerMethod.Apply", "failed to create NetworkManager conf.d", err,
+			apperrors.Metadata{"path": filepath.Dir(nmConfigFile)})
+	}
+	if err := system.WriteFileAtomic(nmConfigFile, []byte(nmConfigContent), 0o644); err != nil {
+		return newConfiguratorError("configurator.networkManagerMethod.Apply", "failed to write NetworkManager DNS config", err,
+			apperrors.Metadata{"path": nmConfigFile})
+	}
+	if err := system.Systemctl("configurator.networkManagerMethod.Apply", "reload", "NetworkManager.service"); err != nil {
+		return err
+	}
+	return writeStaticResolvConf()
+}
+
+func (networkManagerMethod) Reload() error {
+	return system.Systemctl("configurator.networkManagerMethod.Reload", "reload", "NetworkManager.service")
+}
+
+// netplanMethod overrides nameservers on every netplan device and ignores
+// DHCP-provided DNS so it is not re-injected on lease renewal.
+type netplanMethod struct{}
+
+func (netplanMethod) Name() string { return "netplan" }
+
+func (netplanMethod) Files() []string { return []string{netplanGWDFile} }
+
+func (netplanMethod) Apply() error {
+	content, err := renderNetplanDNSOverride(netplanFiles())
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	if err := system.WriteFileAtomic(netplanGWDFile, content, 0o600); err != nil {
+		return newConfiguratorError("configurator.netplanMethod.Apply", "failed to write netplan DNS override", err,
+			apperrors.Metadata{"path": netplanGWDFile})
+	}
+	return netplanMethod{}.Reload()
+}
+
+// Reload regenerates backend configuration and lets the renderer pick it up
+// without bouncing links the way "netplan apply" would.
+func (netplanMethod) Reload() error {
+	if err := system.Run("configurator.netplanMethod.Reload", netplanBinary, "generate"); err != nil {
+		return err
+	}
+	if system.UnitActive("systemd-networkd.service") {
+		return system.Run("configurator.netplanMethod.Reload", "networkctl", "reload")
+	}
+	return nil
+}
+
+type netplanDHCPOverrides struct {
+	UseDNS bool `yaml:"use-dns"`
+}
+
+type netplanNameservers struct {
+	Addresses []string `yaml:"addresses"`
+}
+
+type netplanDevice struct {
+	DHCP4          bool                  `yaml:"dhcp4,omitempty"`
+	DHCP6          bool                  `yaml:"dhcp6,omitempty"`
+	Nameservers    *netplanNameservers   `yaml:"nameservers,omitempty"`
+	DHCP4Overrides *netplanDHCPOverrides `yaml:"dhcp4-overrides,omitempty"`
+	DHCP6Overrides *netplanDHCPOverrides `yaml:"dhcp6-overrides,omitempty"`
+}
+
+type netplanNetwork struct {
+	Version   int                      `yaml:"version"`
+	Ethernets map[string]netplanDevice `yaml:"ethernets,omitempty"`
+	Bonds     map[string]netplanDevice `yaml:"bonds,omitempty"`
+	Bridges   map[string]netplanDevice `yaml:"bridges,omitempty"`
+	VLANs     map[string]netplanDevice `yaml:"vlans,omitempty"`
+	WiFis     map[string]netplanDevice `yaml:"wifis,omitempty"`
+}
+
+// deviceClasses returns the device maps of every class that can carry an
+// uplink, in a fixed order.
+func (n *netplanNetwork) deviceClasses() []*map[string]netplanDevice {
+	return []*map[string]netplanDevice{&n.Ethernets, &n.Bonds, &n.Bridges, &n.VLANs, &n.WiFis}
+}
+
+type netplanDocument struct {
+	Network netplanNetwork `yaml:"network"`
+}
+
+// renderNetplanDNSOverride builds the override for the devices defined in
+// files, or returns nil when there is nothing to override. Netplan merges
+// the override into the original definitions by device name.
+func renderNetplanDNSOverride(files []string) ([]byte, error) {
+	var merged netplanNetwork
+	found := false
+	for _, path := range files {
+		if path == netplanGWDFile {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, newConfiguratorError("configurator.renderNetplanDNSOverride", "failed to read netplan file", err,
+				apperrors.Metadata{"path": path})
+		}
+		var doc netplanDocument
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, newConfiguratorError("configurator.renderNetplanDNSOverride", "failed to parse netplan file", err,
+				apperrors.Metadata{"path": path})
+		}
+		mergedClasses := merged.deviceClasses()
+		for idx, class := range doc.Network.deviceClasses() {
+			target := mergedClasses[idx]
+			for name, dev := range *class {
+				if *target == nil {
+					*target = make(map[string]netplanDevice)
+				}
+				current := (*target)[name]
+				current.DHCP4 = current.DHCP4 || dev.DHCP4
+				current.DHCP6 = current.DHCP6 || dev.DHCP6
+				(*target)[name] = current
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var override netplanDocument
+	override.Network.Version = 2
+	overrideClasses := override.Network.deviceClasses()
+	for idx, class := range merged.deviceClasses() {
+		if len(*class) == 0 {
+			continue
+		}
+		entries := make(map[string]netplanDevice, len(*class))
+		for name, dev := range *class {
+			entry := netplanDevice{Nameservers: &netplanNameservers{Addresses: []string{"127.0.0.1"}}}
+			if dev.DHCP4 {
+				entry.DHCP4Overrides = &netplanDHCPOverrides{UseDNS: false}
+			}
+			if dev.DHCP6 {
+				entry.DHCP6Overrides = &netplanDHCPOverrides{UseDNS: false}
+			}
+			entries[name] = entry
+		}
+		*overrideClasses[idx] = entries
+	}
+
+	data, err := yaml.Marshal(&override)
+	if err != nil {
+		return nil, newConfiguratorError("configurator.renderNetplanDNSOverride", "failed to encode netplan override", err, nil)
+	}
+	return append([]byte("# Managed by GWD: resolve through the local resolver only.\n"), data...), nil
+}
+
+func netplanFiles() []string {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, _ := filepath.Glob(filepath.Join(netplanDir, pattern))
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// writeStaticResolvConf replaces /etc/resolv.conf (often a symlink into
+// /run) with a plain file naming only the local resolver. The rename swaps
+// the symlink itself, so there is no moment without a resolv.conf.
+func writeStaticResolvConf() error {
+	if err := system.WriteFileAtomic(etcResolvConf, []byte(resolvconfHeadContent), 0o644); err != nil {
+		return newConfiguratorError("configurator.writeStaticResolvConf", "failed to write resolv.conf", err,
+			apperrors.Metadata{"path": etcResolvConf})
+	}
+	return nil
+}
+
+func resolvConfManagedByResolved() bool {
+	target, err := os.Readlink(etcResolvConf)
+	return err == nil && strings.HasPrefix(target, resolvedStubPrefix)
+}
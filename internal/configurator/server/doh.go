@@ -1,39 +1,213 @@
 package server
 
 import (
+	"bytes"
+	_ "embed"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 
 	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
 )
 
-const dohConfigDir = "/opt/GWD/doh"
+//go:embed templates_doh/doh-server.conf.tmpl
+var dohConfigTemplate string
+
+// DoH ECS (EDNS Client Subnet) modes. Anonymized forwards the client's /24
+// (IPv4) or /56 (IPv6); precise forwards the full address.
+const (
+	DoHECSAnonymized = "anonymized"
+	DoHECSPrecise    = "precise"
+)
+
+const (
+	dohConfigDir  = "/opt/GWD/doh"
+	dohConfigFile = "doh-server.conf"
+
+	// DoHListenAddress is the loopback address nginx proxies DoH requests to.
+	DoHListenAddress = "127.0.0.1:9853"
+	// dohBackendPath is the path doh-server serves; every public path is
+	// proxied onto it, so only nginx needs to know the public ones.
+	dohBackendPath = "/dq"
+
+	defaultDoHPath    = "/dq"
+	defaultDoHTimeout = 10
+	defaultDoHTries   = 3
+)
+
+// defaultDoHUpstreams point doh-server at the local resolver.
+var defaultDoHUpstreams = []string{"udp:127.0.0.1:53", "tcp:127.0.0.1:53"}
+
+// DoHOptions configures doh-server and the nginx locations in front of it.
+// Upstreams use doh-server syntax, udp:|tcp:|tcp-tls:host:port.
+type DoHOptions struct {
+	Paths               []string `json:"paths,omitempty"`
+	Upstreams           []string `json:"upstreams,omitempty"`
+	Timeout             int      `json:"timeout,omitempty"`
+	Tries               int      `json:"tries,omitempty"`
+	ECS                 string   `json:"ecs,omitempty"`
+	ECSAllowNonGlobalIP bool     `json:"ecs_allow_non_global_ip,omitempty"`
+	LogClientIP         bool     `json:"log_client_ip,omitempty"`
+}
+
+type dohTemplateData struct {
+	DoHOptions
+	Listen      string
+	BackendPath string
+	ECSPrecise  bool
+}
+
+// DoHECSModes lists the ECS modes accepted by NormalizeDoHOptions.
+func DoHECSModes() []string {
+	return []string{DoHECSAnonymized, DoHECSPrecise}
+}
+
+// NormalizeDoHOptions fills in defaults and validates paths and upstreams.
+func NormalizeDoHOptions(opts DoHOptions) (DoHOptions, error) {
+	invalid := func(message string, metadata apperrors.Metadata) error {
+		return newConfiguratorError("configurator.NormalizeDoHOptions", message, nil, metadata)
+	}
+
+	paths := make([]string, 0, len(opts.Paths))
+	for _, raw := range opts.Paths {
+		path := strings.TrimSpace(raw)
+		if path == "" {
+			continue
+		}
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+		if !strings.HasPrefix(path, "/") || path == "/" || strings.ContainsAny(path, " \t;{}\"'") {
+			return DoHOptions{}, invalid("DoH path must start with / and contain no spaces or nginx syntax", apperrors.Metadata{"path": raw})
+		}
+		if !containsString(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{defaultDoHPath}
+	}
+	opts.Paths = paths
+
+	upstreams := make([]string, 0, len(opts.Upstreams))
+	for _, raw := range opts.Upstreams {
+		upstream := strings.TrimSpace(raw)
+		if upstream == "" {
+			continue
+		}
+		scheme, addr, ok := strings.Cut(upstream, ":")
+		if !ok || !containsString([]string{"udp", "tcp", "tcp-tls"}, scheme) {
+			return DoHOptions{}, invalid("DoH upstream must be udp:, tcp: or tcp-tls:host:port", apperrors.Metadata{"upstream": raw})
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" {
+			return DoHOptions{}, invalid("DoH upstream must be udp:, tcp: or tcp-tls:host:port", apperrors.Metadata{"upstream": raw})
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return DoHOptions{}, invalid("DoH upstream port is invalid", apperrors.Metadata{"upstream": raw})
+		}
+		if !containsString(upstreams, upstream) {
+			upstreams = append(upstreams, upstream)
+		}
+	}
+	if len(upstreams) == 0 {
+		upstreams = append(upstreams, defaultDoHUpstreams...)
+	}
+	opts.Upstreams = upstreams
+
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultDoHTimeout
+	}
+	if opts.Timeout < 1 || opts.Timeout > 60 {
+		return DoHOptions{}, invalid("DoH timeout must be between 1 and 60 seconds", apperrors.Metadata{"timeout": opts.Timeout})
+	}
+	if opts.Tries == 0 {
+		opts.Tries = defaultDoHTries
+	}
+	if opts.Tries < 1 || opts.Tries > 10 {
+		return DoHOptions{}, invalid("DoH tries must be between 1 and 10", apperrors.Metadata{"tries": opts.Tries})
+	}
+
+	opts.ECS = strings.ToLower(strings.TrimSpace(opts.ECS))
+	if opts.ECS == "" {
+		opts.ECS = DoHECSAnonymized
+	}
+	if !containsString(DoHECSModes(), opts.ECS) {
+		return DoHOptions{}, invalid("unsupported DoH ECS mode", apperrors.Metadata{"ecs": opts.ECS})
+	}
+	return opts, nil
+}
+
+// ValidateDoHPaths rejects DoH paths that nginx would also route to a vtrui
+// inbound.
+func ValidateDoHPaths(opts DoHOptions, inbounds []VtruiInboundSpec) error {
+	for _, path := range opts.Paths {
+		for _, inbound := range inbounds {
+			if strings.TrimSuffix(inbound.Path, "/") == path {
+				return newConfiguratorError(
+					"configurator.ValidateDoHPaths",
+					"DoH path collides with a vtrui inbound path",
+					nil,
+					apperrors.Metadata{"path": path},
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// DoHConfigPath returns the doh-server configuration file.
+func DoHConfigPath() string {
+	return filepath.Join(dohConfigDir, dohConfigFile)
+}
+
+// EnsureDoHConfig renders doh-server.conf from opts.
+func EnsureDoHConfig(opts DoHOptions) error {
+	opts, err := NormalizeDoHOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	content, err := renderDoHConfig(opts)
+	if err != nil {
+		return err
+	}
 
-func EnsureDoHConfig() error {
 	if err := os.MkdirAll(dohConfigDir, 0755); err != nil {
 		return newConfiguratorError("configurator.EnsureDoHConfig", "failed to create DoH configuration directory", err, apperrors.Metadata{
 			"path": dohConfigDir,
 		})
 	}
 
-	if err := os.WriteFile("/opt/GWD/doh/doh-server.conf", []byte(dohConfigContent), 0644); err != nil {
+	path := DoHConfigPath()
+	if err := system.WriteFileAtomic(path, content, 0644); err != nil {
 		return newConfiguratorError("configurator.EnsureDoHConfig", "failed to write DoH configuration file", err, apperrors.Metadata{
-			"path": "/opt/GWD/doh/doh-server.conf",
+			"path": path,
 		})
 	}
 
 	return nil
 }
 
-const dohConfigContent = `listen = [ "127.0.0.1:9853" ]
-path = "/dq"
-upstream = [
-  "udp:127.0.0.1:53",
-  "tcp:127.0.0.1:53"
-]
-timeout = 10
-tries = 3
-verbose = false
-log_guessed_client_ip = false
-ecs_allow_non_global_ip = false
-ecs_use_precise_ip = false
-`
+func renderDoHConfig(opts DoHOptions) ([]byte, error) {
+	tmpl, err := template.New("doh").Parse(dohConfigTemplate)
+	if err != nil {
+		return nil, newConfiguratorError("configurator.renderDoHConfig", "failed to parse DoH template", err, nil)
+	}
+
+	var buf bytes.Buffer
+	data := dohTemplateData{
+		DoHOptions:  opts,
+		Listen:      DoHListenAddress,
+		BackendPath: dohBackendPath,
+		ECSPrecise:  opts.ECS == DoHECSPrecise,
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, newConfiguratorError("configurator.renderDoHConfig", "failed to render DoH template", err, nil)
+	}
+	return buf.Bytes(), nil
+}
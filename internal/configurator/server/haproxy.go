@@ -0,0 +1,335 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+//go:embed templates_haproxy/haproxy.cfg.tmpl
+var haproxyConfigTemplate string
+
+// PROXY protocol versions accepted by PortForward.ProxyProtocol.
+const (
+	ProxyProtocolNone = ""
+	ProxyProtocolV1   = "v1"
+	ProxyProtocolV2   = "v2"
+)
+
+const (
+	haproxyConfigDir         = "/etc/haproxy"
+	haproxyConfigFile        = "haproxy.cfg"
+	haproxyBinary            = "/usr/sbin/haproxy"
+	portForwardsFile         = "/opt/GWD/port_forwards.json"
+	maxPortForwardName       = 32
+	defaultForwardNamePrefix = "forward-"
+)
+
+var portForwardNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// reservedForwardPorts are served by GWD itself on every host and cannot be
+// forwarded; the nginx port and firewall DNAT forwards come from the
+// install profile.
+var reservedForwardPorts = map[int]string{
+	53:           "DNS",
+	80:           "nginx HTTP",
+	VtruiAPIPort: "vtrui stats API",
+}
+
+// PortForward maps a local TCP port to a remote host:port through HAProxy.
+// ProxyProtocol is empty, "v1" or "v2" to prepend a PROXY protocol header.
+type PortForward struct {
+	Name          string `json:"name"`
+	ListenPort    int    `json:"listen_port"`
+	TargetHost    string `json:"target_host"`
+	TargetPort    int    `json:"target_port"`
+	ProxyProtocol string `json:"proxy_protocol,omitempty"`
+}
+
+// TargetAddress returns the host:port HAProxy connects to.
+func (f PortForward) TargetAddress() string {
+	return net.JoinHostPort(f.TargetHost, strconv.Itoa(f.TargetPort))
+}
+
+// HAProxyConfigPath returns the rendered HAProxy configuration path.
+func HAProxyConfigPath() string {
+	return filepath.Join(haproxyConfigDir, haproxyConfigFile)
+}
+
+// LoadPortForwards returns the stored forwards, or none when nothing has been saved.
+func LoadPortForwards() ([]PortForward, error) {
+	data, err := os.ReadFile(portForwardsFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []PortForward{}, nil
+		}
+		return nil, newConfiguratorError(
+			"configurator.LoadPortForwards",
+			"failed to read port forward definitions",
+			err,
+			apperrors.Metadata{"path": portForwardsFile},
+		)
+	}
+
+	forwards := []PortForward{}
+	if err := json.Unmarshal(data, &forwards); err != nil {
+		return nil, newConfiguratorError(
+			"configurator.LoadPortForwards",
+			"failed to parse port forward definitions",
+			err,
+			apperrors.Metadata{"path": portForwardsFile},
+		)
+	}
+	return forwards, nil
+}
+
+// SavePortForwards validates forwards against the reserved ports, renders
+// haproxy.cfg, checks it with "haproxy -c" and only then replaces the live
+// configuration and the stored definitions.
+func SavePortForwards(forwards []PortForward, reserved map[int]string) ([]PortForward, error) {
+	normalized, err := NormalizePortForwards(forwards, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeHAProxyConfig(normalized); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(normalized, "", "  ")
+	if err != nil {
+		return nil, newConfiguratorError("configurator.SavePortForwards", "failed to encode port forward definitions", err, nil)
+	}
+	if err := os.MkdirAll(filepath.Dir(portForwardsFile), 0o755); err != nil {
+		return nil, newConfiguratorError(
+			"configurator.SavePortForwards",
+			"failed to create GWD working directory",
+			err,
+			apperrors.Metadata{"path": filepath.Dir(portForwardsFile)},
+		)
+	}
+	if err := system.WriteFileAtomic(portForwardsFile, append(data, '\n'), 0o644); err != nil {
+		return nil, newConfiguratorError(
+			"configurator.SavePortForwards",
+			"failed to write port forward definitions",
+			err,
+			apperrors.Metadata{"path": portForwardsFile},
+		)
+	}
+	return normalized, nil
+}
+
+// NormalizePortForwards validates ports, targets and PROXY protocol options,
+// fills in default names and sorts the forwards by listen port. Listen ports
+// must not be in reserved (port to owner), be used by GWD itself or be held
+// by a running service other than HAProxy.
+func NormalizePortForwards(forwards []PortForward, reserved map[int]string) ([]PortForward, error) {
+	invalid := func(message string, metadata apperrors.Metadata) ([]PortForward, error) {
+		return nil, newConfiguratorError("configurator.NormalizePortForwards", message, nil, metadata)
+	}
+
+	reserved = forwardReservedPorts(reserved)
+
+	normalized := make([]PortForward, 0, len(forwards))
+	usedPorts := make(map[int]struct{})
+	usedNames := make(map[string]struct{})
+	for _, fwd := range forwards {
+		fwd.Name = strings.TrimSpace(fwd.Name)
+		fwd.TargetHost = strings.Trim(strings.TrimSpace(fwd.TargetHost), "[]")
+		fwd.ProxyProtocol = strings.ToLower(strings.TrimSpace(fwd.ProxyProtocol))
+
+		if fwd.ListenPort < 1 || fwd.ListenPort > 65535 {
+			return invalid("listen port must be between 1 and 65535", apperrors.Metadata{"listen_port": fwd.ListenPort})
+		}
+		if owner, ok := reserved[fwd.ListenPort]; ok {
+			return invalid("listen port is used by "+owner, apperrors.Metadata{"listen_port": fwd.ListenPort})
+		}
+		if _, dup := usedPorts[fwd.ListenPort]; dup {
+			return invalid("listen port is forwarded twice", apperrors.Metadata{"listen_port": fwd.ListenPort})
+		}
+		usedPorts[fwd.ListenPort] = struct{}{}
+
+		if fwd.TargetPort < 1 || fwd.TargetPort > 65535 {
+			return invalid("target port must be between 1 and 65535", apperrors.Metadata{"target_port": fwd.TargetPort})
+		}
+		if !isValidForwardHost(fwd.TargetHost) {
+			return invalid("target host must be an IP address or hostname", apperrors.Metadata{"target_host": fwd.TargetHost})
+		}
+
+		switch fwd.ProxyProtocol {
+		case ProxyProtocolNone, ProxyProtocolV1, ProxyProtocolV2:
+		default:
+			return invalid("PROXY protocol must be empty, v1 or v2", apperrors.Metadata{"proxy_protocol": fwd.ProxyProtocol})
+		}
+
+		if fwd.Name == "" {
+			fwd.Name = defaultForwardNamePrefix + strconv.Itoa(fwd.ListenPort)
+		}
+		if len(fwd.Name) > maxPortForwardName || !portForwardNamePattern.MatchString(fwd.Name) {
+			return invalid("forward name may only contain letters, digits, '.', '_' and '-'", apperrors.Metadata{"name": fwd.Name})
+		}
+		if _, dup := usedNames[fwd.Name]; dup {
+			return invalid("forward name is used twice", apperrors.Metadata{"name": fwd.Name})
+		}
+		usedNames[fwd.Name] = struct{}{}
+
+		normalized = append(normalized, fwd)
+	}
+
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].ListenPort < normalized[j].ListenPort })
+	return normalized, nil
+}
+
+// forwardReservedPorts merges extra with the ports of GWD's own services and
+// of every TCP listener that is not a stored forward, which HAProxy owns.
+func forwardReservedPorts(extra map[int]string) map[int]string {
+	reserved := make(map[int]string, len(reservedForwardPorts)+len(extra))
+	if listeners, err := listeningTCPPorts(); err == nil {
+		if stored, err := LoadPortForwards(); err == nil {
+			for _, fwd := range stored {
+				delete(listeners, fwd.ListenPort)
+			}
+		}
+		for port := range listeners {
+			reserved[port] = "a running service"
+		}
+	}
+	if _, port, err := net.SplitHostPort(DoHListenAddress); err == nil {
+		if value, err := strconv.Atoi(port); err == nil {
+			reserved[value] = "doh-server"
+		}
+	}
+	if specs, err := VtruiInbounds(); err == nil {
+		for _, spec := range specs {
+			reserved[spec.Port] = "vtrui inbound " + spec.Tag
+		}
+	}
+	for port, owner := range reservedForwardPorts {
+		reserved[port] = owner
+	}
+	for port, owner := range extra {
+		reserved[port] = owner
+	}
+	return reserved
+}
+
+// listeningTCPPorts returns the local ports of listening TCP sockets of both
+// address families.
+func listeningTCPPorts() (map[int]struct{}, error) {
+	ports := make(map[int]struct{})
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, newConfiguratorError("configurator.listeningTCPPorts", "failed to read socket table", err, apperrors.Metadata{"path": path})
+		}
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			// fields[1] is local_address (hex addr:port), fields[3] the state; 0A is LISTEN.
+			if len(fields) < 4 || fields[3] != "0A" {
+				continue
+			}
+			_, hexPort, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			if port, err := strconv.ParseUint(hexPort, 16, 16); err == nil {
+				ports[int(port)] = struct{}{}
+			}
+		}
+	}
+	return ports, nil
+}
+
+func writeHAProxyConfig(forwards []PortForward) error {
+	tmpl, err := template.New("haproxy.cfg").Parse(haproxyConfigTemplate)
+	if err != nil {
+		return newConfiguratorError("configurator.writeHAProxyConfig", "failed to parse haproxy template", err, nil)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, forwards); err != nil {
+		return newConfiguratorError("configurator.writeHAProxyConfig", "failed to render haproxy template", err, nil)
+	}
+
+	if err := os.MkdirAll(haproxyConfigDir, 0o755); err != nil {
+		return newConfiguratorError(
+			"configurator.writeHAProxyConfig",
+			"failed to create haproxy configuration directory",
+			err,
+			apperrors.Metadata{"path": haproxyConfigDir},
+		)
+	}
+
+	path := HAProxyConfigPath()
+	candidate := path + ".new"
+	if err := os.WriteFile(candidate, buf.Bytes(), 0o644); err != nil {
+		return newConfiguratorError(
+			"configurator.writeHAProxyConfig",
+			"failed to write haproxy candidate configuration",
+			err,
+			apperrors.Metadata{"path": candidate},
+		)
+	}
+	defer os.Remove(candidate)
+
+	// The check needs the haproxy binary; definitions saved before HAProxy is
+	// installed are validated on the first write after installation.
+	if _, err := os.Stat(haproxyBinary); err == nil {
+		if output, err := exec.Command(haproxyBinary, "-c", "-q", "-f", candidate).CombinedOutput(); err != nil {
+			return newConfiguratorError(
+				"configurator.writeHAProxyConfig",
+				"haproxy rejected the generated configuration",
+				err,
+				apperrors.Metadata{"output": strings.TrimSpace(string(output))},
+			)
+		}
+	}
+
+	if err := system.WriteFileAtomic(path, buf.Bytes(), 0o644); err != nil {
+		return newConfiguratorError(
+			"configurator.writeHAProxyConfig",
+			"failed to write haproxy configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return nil
+}
+
+func isValidForwardHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
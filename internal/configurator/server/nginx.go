@@ -35,7 +35,8 @@ type NginxOptions struct {
 	Port        int
 	Domain      string
 	ConfigDir   string
-	WSPath      string
+	Inbounds    []VtruiInboundSpec
+	DoH         DoHOptions
 	CertFile    string
 	KeyFile     string
 	DHParamFile string
@@ -139,15 +140,28 @@ func validateNginxOptions(opts *NginxOptions) error {
 		)
 	}
 
-	opts.WSPath = strings.TrimSpace(opts.WSPath)
-	if opts.WSPath == "" {
+	if len(opts.Inbounds) == 0 {
 		return newConfiguratorError(
 			"configurator.validateNginxOptions",
-			"websocket path is required",
+			"at least one vtrui inbound is required",
 			nil,
 			nil,
 		)
 	}
+	inbounds, err := NormalizeVtruiInbounds(opts.Inbounds)
+	if err != nil {
+		return err
+	}
+	opts.Inbounds = inbounds
+
+	doh, err := NormalizeDoHOptions(opts.DoH)
+	if err != nil {
+		return err
+	}
+	if err := ValidateDoHPaths(doh, inbounds); err != nil {
+		return err
+	}
+	opts.DoH = doh
 
 	opts.ConfigDir = strings.TrimSpace(opts.ConfigDir)
 	if opts.ConfigDir == "" {
@@ -192,6 +206,11 @@ func validateNginxOptions(opts *NginxOptions) error {
 	return nil
 }
 
+// DoHUpstream is the doh-server URL every public DoH path is proxied to.
+func (o NginxOptions) DoHUpstream() string {
+	return "http://" + DoHListenAddress + dohBackendPath
+}
+
 func renderNginxTemplate(tmpl string, data NginxOptions) (string, error) {
 	t, err := template.New("nginx").Parse(tmpl)
 	if err != nil {
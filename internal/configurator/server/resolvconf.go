@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -26,9 +27,82 @@ const (
 )
 
 // EnsureResolvconfConfig guarantees /etc/resolv.conf resolves via 127.0.0.1.
+// The local resolver is probed first, then every detected DNS method
+// (resolvconf/ifupdown, systemd-resolved, netplan, NetworkManager) snapshots
+// the files it owns and is applied in turn. When the system resolver does not
+// answer through 127.0.0.1 afterwards, the methods are rolled back in reverse.
+func EnsureResolvconfConfig() error {
+	ctx := context.Background()
+	if err := ProbeResolver(ctx, LocalResolverAddress); err != nil {
+		return newConfiguratorError(
+			"configurator.EnsureResolvconfConfig",
+			"local DNS resolver is not answering; resolv.conf left unchanged",
+			err,
+			apperrors.Metadata{"resolver": LocalResolverAddress},
+		)
+	}
+
+	type appliedMethod struct {
+		method dnsMethod
+		snaps  []*fileSnapshot
+	}
+	var applied []appliedMethod
+	var names []string
+
+	var err error
+	for _, method := range detectDNSMethods() {
+		names = append(names, method.Name())
+		var snaps []*fileSnapshot
+		for _, path := range method.Files() {
+			snap, snapErr := snapshotFile(path)
+			if snapErr != nil {
+				err = snapErr
+				break
+			}
+			snaps = append(snaps, snap)
+		}
+		if err != nil {
+			break
+		}
+		applied = append(applied, appliedMethod{method: method, snaps: snaps})
+		if err = method.Apply(); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = verifySystemResolver(ctx)
+	}
+	if err == nil {
+		return nil
+	}
+
+	metadata := apperrors.Metadata{
+		"resolver": LocalResolverAddress,
+		"methods":  strings.Join(names, ","),
+	}
+	var restoreErrs []string
+	for i := len(applied) - 1; i >= 0; i-- {
+		if restoreErr := restoreSnapshots(applied[i].snaps); restoreErr != nil {
+			restoreErrs = append(restoreErrs, applied[i].method.Name()+": "+restoreErr.Error())
+			continue
+		}
+		_ = applied[i].method.Reload()
+	}
+	if len(restoreErrs) > 0 {
+		metadata["restore_error"] = strings.Join(restoreErrs, "; ")
+	}
+	return newConfiguratorError(
+		"configurator.EnsureResolvconfConfig",
+		"DNS stopped working after switching to the local resolver; previous DNS configuration restored",
+		err,
+		metadata,
+	)
+}
+
+// applyResolvconfConfig points the host at the local resolver.
 // Steps: ensure base files -> write head -> strip dns-nameservers from interfaces
 // -> try "resolvconf -u" -> on failure, write /etc/resolv.conf directly.
-func EnsureResolvconfConfig() error {
+func applyResolvconfConfig() error {
 	// 1) Ensure resolvconf base files exist (empty)
 	if err := ensureEmptyFile(resolvconfOriginal); err != nil {
 		return err
@@ -43,7 +117,7 @@ func EnsureResolvconfConfig() error {
 	// 2) Write head with local nameserver
 	if err := os.WriteFile(resolvconfHeadFile, []byte(resolvconfHeadContent), 0644); err != nil {
 		return newConfiguratorError(
-			"configurator.EnsureResolvconfConfig",
+			"configurator.applyResolvconfConfig",
 			"failed to write resolvconf head file",
 			err,
 			apperrors.Metadata{"path": resolvconfHeadFile},
@@ -63,7 +137,7 @@ func EnsureResolvconfConfig() error {
 		_ = os.RemoveAll(etcResolvConf) // remove broken symlink if present
 		if writeErr := os.WriteFile(etcResolvConf, []byte(resolvconfHeadContent), 0644); writeErr != nil {
 			return newConfiguratorError(
-				"configurator.EnsureResolvconfConfig",
+				"configurator.applyResolvconfConfig",
 				"resolvconf update failed and fallback write unsuccessful",
 				writeErr,
 				apperrors.Metadata{
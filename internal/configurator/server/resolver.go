@@ -0,0 +1,41 @@
+package server
+
+import (
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// Local DNS resolver backends. Both listen on 127.0.0.1:53, so resolv.conf and
+// the DoH upstream stay the same whichever one is selected.
+const (
+	DNSResolverUnbound  = "unbound"
+	DNSResolverSmartDNS = "smartdns"
+)
+
+// DNSResolvers lists the resolver backends accepted by NormalizeDNSResolver.
+func DNSResolvers() []string {
+	return []string{DNSResolverUnbound, DNSResolverSmartDNS}
+}
+
+// NormalizeDNSResolver validates name, defaulting to unbound when empty.
+func NormalizeDNSResolver(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DNSResolverUnbound, nil
+	}
+	if !containsString(DNSResolvers(), name) {
+		return "", newConfiguratorError(
+			"configurator.NormalizeDNSResolver",
+			"unsupported DNS resolver",
+			nil,
+			apperrors.Metadata{"resolver": name, "supported": strings.Join(DNSResolvers(), ", ")},
+		)
+	}
+	return name, nil
+}
+
+// DNSResolverUnit returns the systemd unit running the given resolver.
+func DNSResolverUnit(name string) string {
+	return name + ".service"
+}
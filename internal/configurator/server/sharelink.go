@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// ShareEndpoint describes how clients reach one vtrui inbound through nginx.
+type ShareEndpoint struct {
+	Domain   string
+	Port     int
+	Protocol string
+	Network  string
+	Path     string
+}
+
+// VtruiShareEndpoints derives client endpoints from inbound.json for the public domain and port.
+func VtruiShareEndpoints(domain string, port int) ([]ShareEndpoint, error) {
+	specs, err := VtruiInbounds()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]ShareEndpoint, 0, len(specs))
+	for _, spec := range specs {
+		endpoints = append(endpoints, ShareEndpoint{
+			Domain:   domain,
+			Port:     port,
+			Protocol: spec.Protocol,
+			Network:  spec.Transport,
+			Path:     spec.Path,
+		})
+	}
+	return endpoints, nil
+}
+
+// ShareLink renders the client URI for user. TLS is always terminated by nginx
+// with the node domain as SNI.
+func (e ShareEndpoint) ShareLink(user VtruiUser) (string, error) {
+	name := e.Domain
+	if user.Email != "" {
+		name = fmt.Sprintf("%s-%s", e.Domain, user.Email)
+	}
+
+	switch e.Protocol {
+	case VtruiProtocolVMess:
+		return e.vmessLink(user, name)
+	case VtruiProtocolVLESS:
+		return e.uriLink(VtruiProtocolVLESS, user.ID, name), nil
+	case VtruiProtocolTrojan:
+		return e.uriLink(VtruiProtocolTrojan, user.ID, name), nil
+	default:
+		return "", newConfiguratorError(
+			"configurator.ShareEndpoint.ShareLink",
+			"unsupported protocol for share links",
+			nil,
+			apperrors.Metadata{"protocol": e.Protocol},
+		)
+	}
+}
+
+// vmessLink follows the widely used v2rayN "vmess://base64(json)" convention.
+func (e ShareEndpoint) vmessLink(user VtruiUser, name string) (string, error) {
+	payload := map[string]string{
+		"v":    "2",
+		"ps":   name,
+		"add":  e.Domain,
+		"port": strconv.Itoa(e.Port),
+		"id":   user.ID,
+		"aid":  "0",
+		"scy":  "auto",
+		"net":  e.Network,
+		"type": "none",
+		"host": e.Domain,
+		"path": e.Path,
+		"tls":  "tls",
+		"sni":  e.Domain,
+	}
+
+	if e.Network == VtruiTransportGRPC {
+		payload["path"] = strings.Trim(e.Path, "/")
+		payload["type"] = "gun"
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", newConfiguratorError("configurator.ShareEndpoint.vmessLink", "failed to encode vmess link", err, nil)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// uriLink renders the "scheme://secret@host:port?params#name" form shared by vless and trojan.
+func (e ShareEndpoint) uriLink(scheme, secret, name string) string {
+	query := url.Values{}
+	if scheme == VtruiProtocolVLESS {
+		query.Set("encryption", "none")
+	}
+	query.Set("security", "tls")
+	query.Set("sni", e.Domain)
+	query.Set("type", e.Network)
+
+	switch e.Network {
+	case VtruiTransportGRPC:
+		query.Set("serviceName", strings.Trim(e.Path, "/"))
+		query.Set("mode", "gun")
+	default:
+		query.Set("host", e.Domain)
+		if e.Path != "" {
+			query.Set("path", e.Path)
+		}
+	}
+
+	link := url.URL{
+		Scheme:   scheme,
+		User:     url.User(secret),
+		Host:     net.JoinHostPort(e.Domain, strconv.Itoa(e.Port)),
+		RawQuery: query.Encode(),
+		Fragment: name,
+	}
+	return link.String()
+}
+
+// String summarises the endpoint, e.g. "vmess+ws /ws".
+func (e ShareEndpoint) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%s+%s %s", e.Protocol, e.Network, e.Path))
+}
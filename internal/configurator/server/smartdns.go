@@ -39,8 +39,12 @@ tcp-idle 120
 
 force-AAAA-SOA yes
 dualstack-ip-selection no
+
+conf-file /opt/GWD/smartdns/blocklist.conf
 `
 
+// EnsureSmartDNSConfig writes the SmartDNS configuration used when SmartDNS is
+// selected as the local resolver.
 func EnsureSmartDNSConfig() error {
 	if err := os.MkdirAll(smartDNSConfigDir, 0755); err != nil {
 		return newConfiguratorError("configurator.EnsureSmartDNSConfig", "failed to create SmartDNS configuration directory", err, apperrors.Metadata{
@@ -48,6 +52,10 @@ func EnsureSmartDNSConfig() error {
 		})
 	}
 
+	if err := ensureBlocklistInclude(smartDNSBlocklistFile, ""); err != nil {
+		return err
+	}
+
 	if err := os.WriteFile("/opt/GWD/smartdns/smartdns.conf", []byte(smartDNSConfigContent), 0644); err != nil {
 		return newConfiguratorError("configurator.EnsureSmartDNSConfig", "failed to write SmartDNS configuration file", err, apperrors.Metadata{
 			"path": "/opt/GWD/smartdns/smartdns.conf",
@@ -1,69 +1,185 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"errors"
+	"net"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
 
 	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
 )
 
-const unboundConfigDir = "/etc/unbound"
-
-const unboundConfigContent = `server:
-  verbosity: 0
-  interface: 127.0.0.1
-  port: 53
-
-  do-ip4: yes
-  do-udp: yes
-  do-tcp: yes
-  do-ip6: no
-  prefer-ip6: no
-  edns-buffer-size: 1232
-
-  prefetch: yes
-  module-config: "validator iterator"
-
-  so-reuseport: yes
-  so-rcvbuf: 512k
-  so-sndbuf: 512k
-
-  num-threads: 2
-  msg-cache-slabs: 4
-  rrset-cache-slabs: 4
-  infra-cache-slabs: 4
-  key-cache-slabs: 4
-
-forward-zone:
-  name: "."
-  forward-addr: 1.1.1.1
-  forward-addr: 1.0.0.1
-  forward-addr: 8.8.8.8
-  forward-addr: 8.8.4.4
-  forward-addr: 9.9.9.9
-  forward-addr: 208.67.222.222
-  forward-first: no
-`
+//go:embed templates_unbound/unbound.conf.tmpl
+var unboundConfigTemplate string
 
-const unboundServiceContent = `[Unit]
-Description=Unbound DNS server
-After=network.target
+// Unbound resolution modes.
+const (
+	UnboundModeForward   = "forward"
+	UnboundModeRecursive = "recursive"
+)
 
-[Service]
-Type=simple
-Nice=-5
-ReadOnlyPaths=/etc/unbound
-ExecStart=/usr/sbin/unbound -d
-ExecReload=/bin/kill -HUP $MAINPID
-Restart=on-failure
-RestartSec=2
-RestartPreventExitStatus=23
-TimeoutStopSec=15
+const (
+	unboundConfigDir       = "/etc/unbound"
+	unboundConfigFile      = "unbound.conf"
+	unboundCheckconfBinary = "/usr/sbin/unbound-checkconf"
+	unboundAnchorBinary    = "/usr/sbin/unbound-anchor"
+	unboundTrustAnchorFile = "/var/lib/unbound/root.key"
+	unboundRootHints       = "/usr/share/dns/root.hints"
+	dnsRootDataKey         = "/usr/share/dns/root.key"
+	systemCABundle         = "/etc/ssl/certs/ca-certificates.crt"
+	unboundMaxThreads      = 4
+)
 
-[Install]
-WantedBy=multi-user.target
-`
+// defaultUnboundUpstreams are the plaintext forwarders used historically.
+var defaultUnboundUpstreams = []string{
+	"1.1.1.1", "1.0.0.1", "8.8.8.8", "8.8.4.4", "9.9.9.9", "208.67.222.222",
+}
+
+// defaultUnboundTLSUpstreams carry the TLS names needed to authenticate DoT.
+var defaultUnboundTLSUpstreams = []string{
+	"1.1.1.1@853#cloudflare-dns.com",
+	"1.0.0.1@853#cloudflare-dns.com",
+	"8.8.8.8@853#dns.google",
+	"8.8.4.4@853#dns.google",
+	"9.9.9.9@853#dns.quad9.net",
+}
+
+// UnboundOptions selects how unbound resolves. Upstreams use unbound's
+// forward-addr syntax, IP[@port][#tls-name]; with TLS every upstream needs a
+// TLS name and defaults to port 853. Recursive mode ignores upstreams and
+// resolves from the root servers.
+type UnboundOptions struct {
+	Mode          string   `json:"mode,omitempty"`
+	Upstreams     []string `json:"upstreams,omitempty"`
+	TLS           bool     `json:"tls,omitempty"`
+	IPv6          bool     `json:"ipv6,omitempty"`
+	DisableDNSSEC bool     `json:"disable_dnssec,omitempty"`
+}
+
+// unboundTemplateData is the rendered view of UnboundOptions plus host sizing.
+type unboundTemplateData struct {
+	UnboundOptions
+	DNSSEC          bool
+	TrustAnchorFile string
+	RootHints       string
+	CABundle        string
+	Blocklist       string
+	Threads         int
+	Slabs           int
+	MsgCacheMB      int
+	RRSetCacheMB    int
+}
+
+// UnboundModes lists the modes accepted by NormalizeUnboundOptions.
+func UnboundModes() []string {
+	return []string{UnboundModeForward, UnboundModeRecursive}
+}
+
+// NormalizeUnboundOptions fills in defaults and validates upstream addresses.
+func NormalizeUnboundOptions(opts UnboundOptions) (UnboundOptions, error) {
+	opts.Mode = strings.ToLower(strings.TrimSpace(opts.Mode))
+	if opts.Mode == "" {
+		opts.Mode = UnboundModeForward
+	}
+	if !containsString(UnboundModes(), opts.Mode) {
+		return UnboundOptions{}, newConfiguratorError(
+			"configurator.NormalizeUnboundOptions",
+			"unsupported unbound mode",
+			nil,
+			apperrors.Metadata{"mode": opts.Mode},
+		)
+	}
+
+	if opts.Mode == UnboundModeRecursive {
+		opts.Upstreams = nil
+		opts.TLS = false
+		return opts, nil
+	}
+
+	upstreams := make([]string, 0, len(opts.Upstreams))
+	seen := make(map[string]struct{}, len(opts.Upstreams))
+	for _, raw := range opts.Upstreams {
+		upstream, err := normalizeUnboundUpstream(raw, opts.TLS)
+		if err != nil {
+			return UnboundOptions{}, err
+		}
+		if upstream == "" {
+			continue
+		}
+		if _, dup := seen[upstream]; dup {
+			continue
+		}
+		seen[upstream] = struct{}{}
+		upstreams = append(upstreams, upstream)
+	}
+	if len(upstreams) == 0 {
+		upstreams = append(upstreams, defaultUnboundUpstreams...)
+		if opts.TLS {
+			upstreams = append(upstreams[:0], defaultUnboundTLSUpstreams...)
+		}
+	}
+	opts.Upstreams = upstreams
+	return opts, nil
+}
+
+func normalizeUnboundUpstream(raw string, tls bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	invalid := func(message string) error {
+		return newConfiguratorError("configurator.NormalizeUnboundOptions", message, nil, apperrors.Metadata{"upstream": raw})
+	}
+
+	addr, name, hasName := strings.Cut(raw, "#")
+	host, port, hasPort := strings.Cut(addr, "@")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", invalid("upstream must be an IP address")
+	}
+	if hasName && !isValidForwardHost(name) {
+		return "", invalid("invalid upstream TLS name")
+	}
+	if tls && !hasName {
+		return "", invalid("DNS-over-TLS upstreams need a TLS name, e.g. 1.1.1.1@853#cloudflare-dns.com")
+	}
+	if hasPort {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", invalid("upstream port must be between 1 and 65535")
+		}
+	} else if tls {
+		port, hasPort = "853", true
+	}
+
+	out := ip.String()
+	if hasPort {
+		out += "@" + port
+	}
+	if hasName {
+		out += "#" + name
+	}
+	return out, nil
+}
+
+// EnsureUnboundConfig renders unbound.conf from opts, validates it with
+// unbound-checkconf when available and installs the GWD unit.
+func EnsureUnboundConfig(opts UnboundOptions) error {
+	opts, err := NormalizeUnboundOptions(opts)
+	if err != nil {
+		return err
+	}
 
-func EnsureUnboundConfig() error {
 	if err := os.MkdirAll(unboundConfigDir, 0755); err != nil {
 		return newConfiguratorError(
 			"configurator.EnsureUnboundConfig",
@@ -73,22 +189,211 @@ func EnsureUnboundConfig() error {
 		)
 	}
 
-	if err := os.WriteFile("/etc/unbound/unbound.conf", []byte(unboundConfigContent), 0644); err != nil {
+	data := unboundTemplateData{
+		UnboundOptions:  opts,
+		DNSSEC:          !opts.DisableDNSSEC,
+		TrustAnchorFile: unboundTrustAnchorFile,
+		RootHints:       unboundRootHints,
+		CABundle:        systemCABundle,
+		Blocklist:       unboundBlocklistFile,
+	}
+	data.Threads, data.Slabs, data.MsgCacheMB, data.RRSetCacheMB = unboundSizing(runtime.NumCPU(), systemMemoryMB())
+
+	if data.DNSSEC {
+		if err := ensureUnboundTrustAnchor(); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureBlocklistInclude(unboundBlocklistFile, "server:\n"); err != nil {
+		return err
+	}
+
+	content, err := renderUnboundConfig(data)
+	if err != nil {
+		return err
+	}
+	if err := writeUnboundConfig(content); err != nil {
+		return err
+	}
+
+	if err := writeUnboundServiceUnit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func renderUnboundConfig(data unboundTemplateData) ([]byte, error) {
+	funcs := template.FuncMap{
+		"yesno": func(v bool) string {
+			if v {
+				return "yes"
+			}
+			return "no"
+		},
+	}
+	tmpl, err := template.New("unbound.conf").Funcs(funcs).Parse(unboundConfigTemplate)
+	if err != nil {
+		return nil, newConfiguratorError("configurator.renderUnboundConfig", "failed to parse unbound template", err, nil)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, newConfiguratorError("configurator.renderUnboundConfig", "failed to render unbound template", err, nil)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeUnboundConfig(content []byte) error {
+	path := filepath.Join(unboundConfigDir, unboundConfigFile)
+	candidate := path + ".new"
+	if err := os.WriteFile(candidate, content, 0o644); err != nil {
 		return newConfiguratorError(
-			"configurator.EnsureUnboundConfig",
+			"configurator.writeUnboundConfig",
+			"failed to write unbound candidate configuration",
+			err,
+			apperrors.Metadata{"path": candidate},
+		)
+	}
+	defer os.Remove(candidate)
+
+	if _, err := os.Stat(unboundCheckconfBinary); err == nil {
+		if output, err := exec.Command(unboundCheckconfBinary, candidate).CombinedOutput(); err != nil {
+			return newConfiguratorError(
+				"configurator.writeUnboundConfig",
+				"unbound-checkconf rejected the generated configuration",
+				err,
+				apperrors.Metadata{"output": strings.TrimSpace(string(output))},
+			)
+		}
+	}
+
+	if err := system.WriteFileAtomic(path, content, 0o644); err != nil {
+		return newConfiguratorError(
+			"configurator.writeUnboundConfig",
 			"failed to write unbound configuration file",
 			err,
-			apperrors.Metadata{"path": "/etc/unbound/unbound.conf"},
+			apperrors.Metadata{"path": path},
 		)
 	}
+	return nil
+}
 
-	if err := writeUnboundServiceUnit(); err != nil {
-		return err
+// unboundSizing derives threads, slabs and cache sizes (MiB) from the host.
+// Caches take about 1/32 of RAM, capped at 256 MiB for the rrset cache.
+func unboundSizing(cpus, memoryMB int) (threads, slabs, msgCacheMB, rrsetCacheMB int) {
+	threads = cpus
+	if threads < 1 {
+		threads = 1
+	}
+	if threads > unboundMaxThreads {
+		threads = unboundMaxThreads
+	}
+	slabs = 1
+	for slabs < threads {
+		slabs <<= 1
+	}
+
+	msgCacheMB = memoryMB / 96
+	if msgCacheMB < 4 {
+		msgCacheMB = 4
+	}
+	if msgCacheMB > 128 {
+		msgCacheMB = 128
+	}
+	rrsetCacheMB = msgCacheMB * 2
+	return threads, slabs, msgCacheMB, rrsetCacheMB
+}
+
+// systemMemoryMB returns MemTotal from /proc/meminfo, or 0 when unknown.
+func systemMemoryMB() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0
+			}
+			return kb / 1024
+		}
+	}
+	return 0
+}
+
+// ensureUnboundTrustAnchor seeds the DNSSEC root trust anchor from
+// dns-root-data and refreshes it with unbound-anchor (RFC 5011). The file
+// must be writable by the unbound user, which keeps it updated afterwards.
+func ensureUnboundTrustAnchor() error {
+	if err := os.MkdirAll(filepath.Dir(unboundTrustAnchorFile), 0o755); err != nil {
+		return newConfiguratorError(
+			"configurator.ensureUnboundTrustAnchor",
+			"failed to create trust anchor directory",
+			err,
+			apperrors.Metadata{"path": filepath.Dir(unboundTrustAnchorFile)},
+		)
 	}
 
+	if _, err := os.Stat(unboundTrustAnchorFile); errors.Is(err, os.ErrNotExist) {
+		if err := copyFile(dnsRootDataKey, unboundTrustAnchorFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return newConfiguratorError(
+				"configurator.ensureUnboundTrustAnchor",
+				"failed to seed DNSSEC trust anchor",
+				err,
+				apperrors.Metadata{"source": dnsRootDataKey, "path": unboundTrustAnchorFile},
+			)
+		}
+	}
+
+	// unbound-anchor exits 1 when it updated the anchor; only a missing file
+	// afterwards is fatal.
+	var anchorOutput []byte
+	if _, err := os.Stat(unboundAnchorBinary); err == nil {
+		anchorOutput, _ = exec.Command(unboundAnchorBinary, "-a", unboundTrustAnchorFile).CombinedOutput()
+	}
+	if _, err := os.Stat(unboundTrustAnchorFile); err != nil {
+		return newConfiguratorError(
+			"configurator.ensureUnboundTrustAnchor",
+			"DNSSEC trust anchor is unavailable",
+			err,
+			apperrors.Metadata{"path": unboundTrustAnchorFile, "output": strings.TrimSpace(string(anchorOutput))},
+		)
+	}
+
+	if account, err := user.Lookup("unbound"); err == nil {
+		uid, _ := strconv.Atoi(account.Uid)
+		gid, _ := strconv.Atoi(account.Gid)
+		_ = os.Chown(filepath.Dir(unboundTrustAnchorFile), uid, gid)
+		_ = os.Chown(unboundTrustAnchorFile, uid, gid)
+	}
 	return nil
 }
 
+const unboundServiceContent = `[Unit]
+Description=Unbound DNS server
+After=network.target
+
+[Service]
+Type=simple
+Nice=-5
+ReadOnlyPaths=/etc/unbound
+ExecStart=/usr/sbin/unbound -d
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=2
+RestartPreventExitStatus=23
+TimeoutStopSec=15
+
+[Install]
+WantedBy=multi-user.target
+`
+
 func writeUnboundServiceUnit() error {
 	servicePath := "/etc/systemd/system/unbound.service"
 	if err := os.WriteFile(servicePath, []byte(unboundServiceContent), 0644); err != nil {
@@ -3,57 +3,66 @@ package server
 import (
 	_ "embed"
 	"os"
-	"path/filepath"
-
-	apperrors "GWD/internal/errors"
 )
 
 //go:embed templates_vtrui/config.json
 var vtruiConfigTemplate []byte
 
-//go:embed templates_vtrui/inbound.json
-var vtruiInboundTemplate []byte
-
 //go:embed templates_vtrui/outbound.json
 var vtruiOutboundTemplate []byte
 
 const vtruiConfigDir = "/opt/GWD/vtrui"
 
-// EnsureVtruiConfig creates vtrui configuration directory and files atomically
-func EnsureVtruiConfig() error {
-	// Create configuration directory
-	if err := os.MkdirAll(vtruiConfigDir, 0o755); err != nil {
-		return newConfiguratorError(
-			"configurator.EnsureVtruiConfig",
-			"failed to create vtrui configuration directory",
-			err,
-			apperrors.Metadata{"path": vtruiConfigDir},
-		)
+// EnsureVtruiConfig creates vtrui configuration directory and files atomically.
+// inbound.json is rendered from the supplied specs; clients already present in
+// the previous inbound.json and an enabled WARP outbound are carried over, and the
+// stored routing policy is rendered into config.json. The complete set is
+// validated before any file is replaced.
+func EnsureVtruiConfig(inbounds []VtruiInboundSpec) error {
+	specs, err := NormalizeVtruiInbounds(inbounds)
+	if err != nil {
+		return err
 	}
 
-	files := []struct {
-		name    string
-		content []byte
-	}{
-		{"config.json", vtruiConfigTemplate},
-		{"inbound.json", vtruiInboundTemplate},
-		{"outbound.json", vtruiOutboundTemplate},
+	var existingUsers []VtruiUser
+	if _, err := os.Stat(vtruiInboundPath()); err == nil {
+		if users, err := ListVtruiUsers(); err == nil {
+			existingUsers = users
+		}
 	}
+	warpEnabled, _ := VtruiWarpEnabled()
 
-	for _, file := range files {
-		path := filepath.Join(vtruiConfigDir, file.name)
-		if err := os.WriteFile(path, file.content, 0o644); err != nil {
-			return newConfiguratorError(
-				"configurator.EnsureVtruiConfig",
-				"failed to write vtrui configuration file",
-				err,
-				apperrors.Metadata{
-					"path": path,
-					"file": file.name,
-				},
-			)
-		}
+	routing, err := LoadVtruiRouting()
+	if err != nil {
+		return err
+	}
+	config, err := withVtruiRouting(vtruiConfigTemplate, routing)
+	if err != nil {
+		return err
+	}
+	outbound, err := withVtruiWarpOutbound(vtruiOutboundTemplate, warpEnabled)
+	if err != nil {
+		return err
+	}
+	inbound, err := renderVtruiInbounds(specs, existingUsers).encode()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// nginx is rendered from the same specs afterwards, so its locations are
+	// not checked here.
+	return commitVtruiFiles(map[string][]byte{
+		vtruiConfigFile:   config,
+		vtruiOutboundFile: outbound,
+		vtruiInboundFile:  inbound,
+	}, vtruiCommitOptions{})
+}
+
+// VtruiInbounds returns the inbound specs currently rendered into inbound.json.
+func VtruiInbounds() ([]VtruiInboundSpec, error) {
+	file, err := loadVtruiInbounds()
+	if err != nil {
+		return nil, err
+	}
+	return file.specs(), nil
 }
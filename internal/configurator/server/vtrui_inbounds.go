@@ -0,0 +1,394 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// Supported vtrui inbound protocols.
+const (
+	VtruiProtocolVMess  = "vmess"
+	VtruiProtocolVLESS  = "vless"
+	VtruiProtocolTrojan = "trojan"
+)
+
+// Supported vtrui inbound transports. TLS is always terminated by nginx.
+const (
+	VtruiTransportWS          = "ws"
+	VtruiTransportGRPC        = "grpc"
+	VtruiTransportHTTPUpgrade = "httpupgrade"
+)
+
+const (
+	vtruiInboundListen   = "127.0.0.1"
+	vtruiInboundBasePort = 9890
+)
+
+// VtruiAPIPort is the loopback port of the stats API inbound in config.json.
+const VtruiAPIPort = 10085
+
+// VtruiInboundSpec selects the protocol, transport and public path of one
+// vtrui inbound. Port is the loopback port nginx proxies to; it is assigned
+// automatically when left empty.
+type VtruiInboundSpec struct {
+	Tag       string `json:"tag"`
+	Protocol  string `json:"protocol"`
+	Transport string `json:"transport"`
+	Path      string `json:"path"`
+	Port      int    `json:"port"`
+}
+
+// ServiceName returns the gRPC service name derived from the path.
+func (s VtruiInboundSpec) ServiceName() string {
+	return strings.Trim(s.Path, "/")
+}
+
+// VtruiProtocols lists the protocols accepted by NormalizeVtruiInbounds.
+func VtruiProtocols() []string {
+	return []string{VtruiProtocolVMess, VtruiProtocolVLESS, VtruiProtocolTrojan}
+}
+
+// VtruiTransports lists the transports accepted by NormalizeVtruiInbounds.
+func VtruiTransports() []string {
+	return []string{VtruiTransportWS, VtruiTransportGRPC, VtruiTransportHTTPUpgrade}
+}
+
+// DefaultVtruiInbounds returns the historical single vmess+ws inbound on /ws.
+func DefaultVtruiInbounds() []VtruiInboundSpec {
+	return []VtruiInboundSpec{{
+		Tag:       "vmess-ws",
+		Protocol:  VtruiProtocolVMess,
+		Transport: VtruiTransportWS,
+		Path:      "/ws",
+		Port:      vtruiInboundBasePort,
+	}}
+}
+
+// DefaultVtruiInboundPath suggests a public path for a transport.
+func DefaultVtruiInboundPath(protocol, transport string) string {
+	if transport == VtruiTransportWS && protocol == VtruiProtocolVMess {
+		return "/ws"
+	}
+	return "/" + protocol + "-" + transport
+}
+
+// NormalizeVtruiInbounds fills in defaults (tags, ports) and validates that
+// the specs can run side by side behind one nginx server block.
+func NormalizeVtruiInbounds(specs []VtruiInboundSpec) ([]VtruiInboundSpec, error) {
+	if len(specs) == 0 {
+		return DefaultVtruiInbounds(), nil
+	}
+
+	normalized := make([]VtruiInboundSpec, len(specs))
+	usedPorts := make(map[int]struct{})
+	for idx, spec := range specs {
+		spec.Protocol = strings.ToLower(strings.TrimSpace(spec.Protocol))
+		spec.Transport = strings.ToLower(strings.TrimSpace(spec.Transport))
+		spec.Path = strings.TrimSpace(spec.Path)
+		spec.Tag = strings.TrimSpace(spec.Tag)
+
+		if !containsString(VtruiProtocols(), spec.Protocol) {
+			return nil, inboundSpecError("unsupported vtrui protocol", idx, apperrors.Metadata{"protocol": spec.Protocol})
+		}
+		if !containsString(VtruiTransports(), spec.Transport) {
+			return nil, inboundSpecError("unsupported vtrui transport", idx, apperrors.Metadata{"transport": spec.Transport})
+		}
+		if spec.Path == "" {
+			spec.Path = DefaultVtruiInboundPath(spec.Protocol, spec.Transport)
+		}
+		if !strings.HasPrefix(spec.Path, "/") || strings.ContainsAny(spec.Path, " \t{};") {
+			return nil, inboundSpecError("inbound path must start with / and contain no spaces or nginx syntax", idx, apperrors.Metadata{"path": spec.Path})
+		}
+		if spec.Transport == VtruiTransportGRPC && (spec.ServiceName() == "" || strings.Contains(spec.ServiceName(), "/")) {
+			return nil, inboundSpecError("gRPC path must be a single segment used as service name", idx, apperrors.Metadata{"path": spec.Path})
+		}
+		if spec.Tag == "" {
+			spec.Tag = fmt.Sprintf("%s-%s", spec.Protocol, spec.Transport)
+			if idx > 0 {
+				spec.Tag = fmt.Sprintf("%s-%d", spec.Tag, idx)
+			}
+		}
+		if spec.Port < 0 || spec.Port > 65535 {
+			return nil, inboundSpecError("inbound port must be between 1 and 65535", idx, apperrors.Metadata{"port": spec.Port})
+		}
+		if spec.Port == VtruiAPIPort {
+			return nil, inboundSpecError("inbound port is reserved for the vtrui API", idx, apperrors.Metadata{"port": spec.Port})
+		}
+		if spec.Port != 0 {
+			if _, dup := usedPorts[spec.Port]; dup {
+				return nil, inboundSpecError("inbound port is used twice", idx, apperrors.Metadata{"port": spec.Port})
+			}
+			usedPorts[spec.Port] = struct{}{}
+		}
+		normalized[idx] = spec
+	}
+
+	nextPort := vtruiInboundBasePort
+	for idx := range normalized {
+		if normalized[idx].Port != 0 {
+			continue
+		}
+		for {
+			if _, used := usedPorts[nextPort]; !used {
+				break
+			}
+			nextPort++
+		}
+		normalized[idx].Port = nextPort
+		usedPorts[nextPort] = struct{}{}
+	}
+
+	seenPaths := make(map[string]struct{})
+	seenTags := make(map[string]struct{})
+	for idx, spec := range normalized {
+		if _, dup := seenPaths[spec.Path]; dup {
+			return nil, inboundSpecError("inbound path is used twice", idx, apperrors.Metadata{"path": spec.Path})
+		}
+		seenPaths[spec.Path] = struct{}{}
+		if _, dup := seenTags[spec.Tag]; dup {
+			return nil, inboundSpecError("inbound tag is used twice", idx, apperrors.Metadata{"tag": spec.Tag})
+		}
+		seenTags[spec.Tag] = struct{}{}
+	}
+
+	return normalized, nil
+}
+
+func inboundSpecError(message string, index int, metadata apperrors.Metadata) *apperrors.AppError {
+	err := newConfiguratorError("configurator.NormalizeVtruiInbounds", message, nil, metadata)
+	return err.WithField("index", index)
+}
+
+// vtruiInboundsFile is the typed form of /opt/GWD/vtrui/inbound.json.
+type vtruiInboundsFile struct {
+	Inbounds []vtruiInbound `json:"inbounds"`
+}
+
+type vtruiInbound struct {
+	Tag            string               `json:"tag,omitempty"`
+	Listen         string               `json:"listen"`
+	Port           int                  `json:"port"`
+	Protocol       string               `json:"protocol"`
+	Settings       vtruiInboundSettings `json:"settings"`
+	StreamSettings vtruiStreamSettings  `json:"streamSettings"`
+	Sniffing       *vtruiSniffing       `json:"sniffing,omitempty"`
+}
+
+type vtruiInboundSettings struct {
+	Clients    []vtruiClient `json:"clients"`
+	Decryption string        `json:"decryption,omitempty"`
+}
+
+// vtruiClient covers vmess/vless (id) and trojan (password) accounts.
+type vtruiClient struct {
+	ID       string `json:"id,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+type vtruiStreamSettings struct {
+	Network             string               `json:"network"`
+	Security            string               `json:"security"`
+	WSSettings          *vtruiPathSettings   `json:"wsSettings,omitempty"`
+	HTTPUpgradeSettings *vtruiPathSettings   `json:"httpupgradeSettings,omitempty"`
+	GRPCSettings        *vtruiGRPCSettings   `json:"grpcSettings,omitempty"`
+	Sockopt             *vtruiInboundSockopt `json:"sockopt,omitempty"`
+}
+
+type vtruiPathSettings struct {
+	Path string `json:"path"`
+}
+
+type vtruiGRPCSettings struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type vtruiInboundSockopt struct {
+	TCPFastOpen bool `json:"tcpFastOpen"`
+	TCPMptcp    bool `json:"tcpMptcp"`
+}
+
+type vtruiSniffing struct {
+	Enabled      bool     `json:"enabled"`
+	DestOverride []string `json:"destOverride"`
+}
+
+// renderVtruiInbounds builds the typed inbound file for specs and users.
+func renderVtruiInbounds(specs []VtruiInboundSpec, users []VtruiUser) *vtruiInboundsFile {
+	file := &vtruiInboundsFile{Inbounds: make([]vtruiInbound, 0, len(specs))}
+	for _, spec := range specs {
+		inbound := vtruiInbound{
+			Tag:      spec.Tag,
+			Listen:   vtruiInboundListen,
+			Port:     spec.Port,
+			Protocol: spec.Protocol,
+			StreamSettings: vtruiStreamSettings{
+				Network:  spec.Transport,
+				Security: "none",
+				Sockopt: &vtruiInboundSockopt{
+					TCPFastOpen: true,
+					TCPMptcp:    true,
+				},
+			},
+			Sniffing: &vtruiSniffing{
+				Enabled:      true,
+				DestOverride: []string{"http", "tls", "quic"},
+			},
+		}
+		if spec.Protocol == VtruiProtocolVLESS {
+			inbound.Settings.Decryption = "none"
+		}
+
+		switch spec.Transport {
+		case VtruiTransportWS:
+			inbound.StreamSettings.WSSettings = &vtruiPathSettings{Path: spec.Path}
+		case VtruiTransportHTTPUpgrade:
+			inbound.StreamSettings.HTTPUpgradeSettings = &vtruiPathSettings{Path: spec.Path}
+		case VtruiTransportGRPC:
+			inbound.StreamSettings.GRPCSettings = &vtruiGRPCSettings{ServiceName: spec.ServiceName()}
+		}
+
+		file.Inbounds = append(file.Inbounds, inbound)
+	}
+	file.setUsers(users)
+	return file
+}
+
+// specs recovers the inbound specs from a rendered file.
+func (f *vtruiInboundsFile) specs() []VtruiInboundSpec {
+	specs := make([]VtruiInboundSpec, 0, len(f.Inbounds))
+	for _, inbound := range f.Inbounds {
+		spec := VtruiInboundSpec{
+			Tag:       inbound.Tag,
+			Protocol:  inbound.Protocol,
+			Transport: inbound.StreamSettings.Network,
+			Port:      inbound.Port,
+		}
+		switch {
+		case inbound.StreamSettings.WSSettings != nil:
+			spec.Path = inbound.StreamSettings.WSSettings.Path
+		case inbound.StreamSettings.HTTPUpgradeSettings != nil:
+			spec.Path = inbound.StreamSettings.HTTPUpgradeSettings.Path
+		case inbound.StreamSettings.GRPCSettings != nil:
+			spec.Path = "/" + inbound.StreamSettings.GRPCSettings.ServiceName
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func (f *vtruiInboundsFile) users() []VtruiUser {
+	seen := make(map[string]struct{})
+	users := []VtruiUser{}
+	for _, inbound := range f.Inbounds {
+		for _, client := range inbound.Settings.Clients {
+			id := client.ID
+			if id == "" {
+				id = client.Password
+			}
+			if id == "" {
+				continue
+			}
+			key := strings.ToLower(id)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			users = append(users, VtruiUser{ID: id, Email: client.Email})
+		}
+	}
+	return users
+}
+
+// setUsers applies the same accounts to every inbound; trojan uses the UUID as password.
+func (f *vtruiInboundsFile) setUsers(users []VtruiUser) {
+	for idx := range f.Inbounds {
+		clients := make([]vtruiClient, 0, len(users))
+		for _, user := range users {
+			client := vtruiClient{Email: user.Email}
+			if f.Inbounds[idx].Protocol == VtruiProtocolTrojan {
+				client.Password = user.ID
+			} else {
+				client.ID = user.ID
+			}
+			clients = append(clients, client)
+		}
+		f.Inbounds[idx].Settings.Clients = clients
+	}
+}
+
+func vtruiInboundPath() string {
+	return filepath.Join(vtruiConfigDir, vtruiInboundFile)
+}
+
+func loadVtruiInbounds() (*vtruiInboundsFile, error) {
+	path := vtruiInboundPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newConfiguratorError(
+			"configurator.loadVtruiInbounds",
+			"failed to read vtrui inbound configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	file := &vtruiInboundsFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, newConfiguratorError(
+			"configurator.loadVtruiInbounds",
+			"failed to parse vtrui inbound configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	if len(file.Inbounds) == 0 {
+		return nil, newConfiguratorError(
+			"configurator.loadVtruiInbounds",
+			"vtrui inbound configuration defines no inbounds",
+			nil,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return file, nil
+}
+
+func (f *vtruiInboundsFile) encode() ([]byte, error) {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, newConfiguratorError(
+			"configurator.vtruiInboundsFile.encode",
+			"failed to encode vtrui inbound configuration",
+			err,
+			nil,
+		)
+	}
+	return append(data, '\n'), nil
+}
+
+// save validates and writes inbound.json, including the nginx location check.
+func (f *vtruiInboundsFile) save() error {
+	return f.commit(vtruiCommitOptions{checkNginx: true})
+}
+
+func (f *vtruiInboundsFile) commit(opts vtruiCommitOptions) error {
+	data, err := f.encode()
+	if err != nil {
+		return err
+	}
+	return commitVtruiFiles(map[string][]byte{vtruiInboundFile: data}, opts)
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const (
+	vtruiRoutingFile  = "routing.json"
+	vtruiConfigFile   = "config.json"
+	vtruiOutboundFile = "outbound.json"
+
+	vtruiBlockedOutbound = "blocked"
+	vtruiAPITag          = "api"
+	vtruiAdsGeoSite      = "category-ads-all"
+)
+
+var (
+	geoIPCodePattern       = regexp.MustCompile(`^!?[a-z0-9-]+$`)
+	geoSiteCategoryPattern = regexp.MustCompile(`^!?[a-z0-9._-]+(@[a-z0-9!_-]+)?$`)
+	domainMatcherPrefixes  = []string{"domain:", "full:", "keyword:", "regexp:", "geosite:"}
+)
+
+// VtruiRoutingPolicy is the declarative routing configuration stored in
+// /opt/GWD/vtrui/routing.json and rendered into config.json.
+type VtruiRoutingPolicy struct {
+	BlockPrivateIP  bool              `json:"block_private_ip"`
+	BlockAds        bool              `json:"block_ads"`
+	BlockBitTorrent bool              `json:"block_bittorrent"`
+	BlockGeoIP      []string          `json:"block_geoip,omitempty"`
+	BlockGeoSite    []string          `json:"block_geosite,omitempty"`
+	DomainRules     []VtruiDomainRule `json:"domain_rules,omitempty"`
+}
+
+// VtruiDomainRule sends traffic for a domain matcher to a specific outbound.
+// Domain accepts plain domains and the xray prefixes domain:, full:,
+// keyword:, regexp: and geosite:.
+type VtruiDomainRule struct {
+	Domain   string `json:"domain"`
+	Outbound string `json:"outbound"`
+}
+
+// vtruiRoutingRule is one entry of config.json "routing.rules".
+type vtruiRoutingRule struct {
+	Type        string   `json:"type"`
+	InboundTag  []string `json:"inboundTag,omitempty"`
+	OutboundTag string   `json:"outboundTag"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"`
+	Protocol    []string `json:"protocol,omitempty"`
+}
+
+type vtruiRouting struct {
+	DomainStrategy string             `json:"domainStrategy"`
+	Rules          []vtruiRoutingRule `json:"rules"`
+}
+
+// LoadVtruiRouting returns the stored routing policy, or an empty policy when
+// none has been saved yet.
+func LoadVtruiRouting() (VtruiRoutingPolicy, error) {
+	path := vtruiRoutingPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return VtruiRoutingPolicy{}, nil
+		}
+		return VtruiRoutingPolicy{}, newConfiguratorError(
+			"configurator.LoadVtruiRouting",
+			"failed to read vtrui routing policy",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	var policy VtruiRoutingPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return VtruiRoutingPolicy{}, newConfiguratorError(
+			"configurator.LoadVtruiRouting",
+			"failed to parse vtrui routing policy",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return policy, nil
+}
+
+// SaveVtruiRouting validates policy, re-renders config.json and stores the
+// policy once vtrui accepted the result.
+func SaveVtruiRouting(policy VtruiRoutingPolicy) error {
+	normalized, err := normalizeVtruiRouting(policy)
+	if err != nil {
+		return err
+	}
+
+	if err := applyVtruiRouting(normalized); err != nil {
+		return err
+	}
+	return storeVtruiRouting(normalized)
+}
+
+// storeVtruiRouting writes the normalized policy once config.json reflects it.
+func storeVtruiRouting(policy VtruiRoutingPolicy) error {
+	path := vtruiRoutingPath()
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return newConfiguratorError("configurator.storeVtruiRouting", "failed to encode vtrui routing policy", err, nil)
+	}
+	if err := system.WriteFileAtomic(path, append(data, '\n'), 0o644); err != nil {
+		return newConfiguratorError(
+			"configurator.storeVtruiRouting",
+			"failed to write vtrui routing policy",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return nil
+}
+
+// VtruiOutboundTags lists the outbound tags defined in outbound.json.
+func VtruiOutboundTags() ([]string, error) {
+	path := filepath.Join(vtruiConfigDir, vtruiOutboundFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newConfiguratorError(
+			"configurator.VtruiOutboundTags",
+			"failed to read vtrui outbound configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	var doc struct {
+		Outbounds []struct {
+			Tag string `json:"tag"`
+		} `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, newConfiguratorError(
+			"configurator.VtruiOutboundTags",
+			"failed to parse vtrui outbound configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	tags := make([]string, 0, len(doc.Outbounds))
+	for _, outbound := range doc.Outbounds {
+		if outbound.Tag != "" {
+			tags = append(tags, outbound.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// applyVtruiRouting renders policy into the "routing" section of config.json,
+// leaving the other sections untouched.
+func applyVtruiRouting(policy VtruiRoutingPolicy) error {
+	if err := checkVtruiRoutingOutbounds(policy); err != nil {
+		return err
+	}
+
+	path := filepath.Join(vtruiConfigDir, vtruiConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newConfiguratorError(
+			"configurator.applyVtruiRouting",
+			"failed to read vtrui configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	out, err := withVtruiRouting(data, policy)
+	if err != nil {
+		return err
+	}
+	return commitVtruiFiles(map[string][]byte{vtruiConfigFile: out}, vtruiCommitOptions{})
+}
+
+// withVtruiRouting returns the config.json document data with its "routing"
+// section replaced by the rendered policy.
+func withVtruiRouting(data []byte, policy VtruiRoutingPolicy) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, newConfiguratorError("configurator.withVtruiRouting", "failed to parse vtrui configuration", err, nil)
+	}
+
+	routing, err := json.Marshal(renderVtruiRouting(policy))
+	if err != nil {
+		return nil, newConfiguratorError("configurator.withVtruiRouting", "failed to encode vtrui routing", err, nil)
+	}
+	doc["routing"] = routing
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, newConfiguratorError("configurator.withVtruiRouting", "failed to encode vtrui configuration", err, nil)
+	}
+	return append(out, '\n'), nil
+}
+
+// checkVtruiRoutingOutbounds ensures every domain rule targets an outbound
+// defined in outbound.json.
+func checkVtruiRoutingOutbounds(policy VtruiRoutingPolicy) error {
+	tags, err := VtruiOutboundTags()
+	if err != nil {
+		return err
+	}
+	for _, rule := range policy.DomainRules {
+		if !containsString(tags, rule.Outbound) {
+			return newConfiguratorError(
+				"configurator.checkVtruiRoutingOutbounds",
+				"routing rule references an unknown outbound",
+				nil,
+				apperrors.Metadata{"domain": rule.Domain, "outbound": rule.Outbound, "available": tags},
+			)
+		}
+	}
+	return nil
+}
+
+// renderVtruiRouting converts the policy into xray routing rules. The stats
+// API rule always comes first, followed by block rules so per-domain
+// overrides cannot re-open blocked destinations.
+func renderVtruiRouting(policy VtruiRoutingPolicy) vtruiRouting {
+	routing := vtruiRouting{DomainStrategy: "AsIs", Rules: []vtruiRoutingRule{
+		{Type: "field", InboundTag: []string{vtruiAPITag}, OutboundTag: vtruiAPITag},
+	}}
+
+	var blockedIPs []string
+	if policy.BlockPrivateIP {
+		blockedIPs = append(blockedIPs, "geoip:private")
+	}
+	for _, code := range policy.BlockGeoIP {
+		blockedIPs = append(blockedIPs, "geoip:"+code)
+	}
+	if len(blockedIPs) > 0 {
+		routing.Rules = append(routing.Rules, vtruiRoutingRule{Type: "field", OutboundTag: vtruiBlockedOutbound, IP: blockedIPs})
+	}
+
+	var blockedSites []string
+	if policy.BlockAds {
+		blockedSites = append(blockedSites, "geosite:"+vtruiAdsGeoSite)
+	}
+	for _, category := range policy.BlockGeoSite {
+		blockedSites = append(blockedSites, "geosite:"+category)
+	}
+	if len(blockedSites) > 0 {
+		routing.Rules = append(routing.Rules, vtruiRoutingRule{Type: "field", OutboundTag: vtruiBlockedOutbound, Domain: blockedSites})
+	}
+
+	if policy.BlockBitTorrent {
+		routing.Rules = append(routing.Rules, vtruiRoutingRule{Type: "field", OutboundTag: vtruiBlockedOutbound, Protocol: []string{"bittorrent"}})
+	}
+
+	// Group consecutive domains per outbound while keeping rule order stable.
+	domainStart := len(routing.Rules)
+	for _, rule := range policy.DomainRules {
+		last := len(routing.Rules) - 1
+		if last >= domainStart && routing.Rules[last].OutboundTag == rule.Outbound {
+			routing.Rules[last].Domain = append(routing.Rules[last].Domain, rule.Domain)
+			continue
+		}
+		routing.Rules = append(routing.Rules, vtruiRoutingRule{Type: "field", OutboundTag: rule.Outbound, Domain: []string{rule.Domain}})
+	}
+
+	return routing
+}
+
+func normalizeVtruiRouting(policy VtruiRoutingPolicy) (VtruiRoutingPolicy, error) {
+	normalized := VtruiRoutingPolicy{
+		BlockPrivateIP:  policy.BlockPrivateIP,
+		BlockAds:        policy.BlockAds,
+		BlockBitTorrent: policy.BlockBitTorrent,
+	}
+
+	for _, code := range policy.BlockGeoIP {
+		code = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(code), "geoip:"))
+		if !geoIPCodePattern.MatchString(code) {
+			return VtruiRoutingPolicy{}, newConfiguratorError(
+				"configurator.normalizeVtruiRouting",
+				"invalid geoip code",
+				nil,
+				apperrors.Metadata{"geoip": code},
+			)
+		}
+		if !containsString(normalized.BlockGeoIP, code) {
+			normalized.BlockGeoIP = append(normalized.BlockGeoIP, code)
+		}
+	}
+
+	for _, category := range policy.BlockGeoSite {
+		category = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(category), "geosite:"))
+		if !geoSiteCategoryPattern.MatchString(category) {
+			return VtruiRoutingPolicy{}, newConfiguratorError(
+				"configurator.normalizeVtruiRouting",
+				"invalid geosite category",
+				nil,
+				apperrors.Metadata{"geosite": category},
+			)
+		}
+		if !containsString(normalized.BlockGeoSite, category) {
+			normalized.BlockGeoSite = append(normalized.BlockGeoSite, category)
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for _, rule := range policy.DomainRules {
+		rule.Domain = strings.TrimSpace(rule.Domain)
+		rule.Outbound = strings.TrimSpace(rule.Outbound)
+		if err := validateDomainMatcher(rule.Domain); err != nil {
+			return VtruiRoutingPolicy{}, err
+		}
+		if rule.Outbound == "" {
+			return VtruiRoutingPolicy{}, newConfiguratorError(
+				"configurator.normalizeVtruiRouting",
+				"routing rule requires an outbound",
+				nil,
+				apperrors.Metadata{"domain": rule.Domain},
+			)
+		}
+		if _, dup := seen[rule.Domain]; dup {
+			return VtruiRoutingPolicy{}, newConfiguratorError(
+				"configurator.normalizeVtruiRouting",
+				"domain already has a routing rule",
+				nil,
+				apperrors.Metadata{"domain": rule.Domain},
+			)
+		}
+		seen[rule.Domain] = struct{}{}
+		normalized.DomainRules = append(normalized.DomainRules, rule)
+	}
+
+	return normalized, nil
+}
+
+func validateDomainMatcher(domain string) error {
+	invalid := func(reason string) error {
+		return newConfiguratorError(
+			"configurator.validateDomainMatcher",
+			reason,
+			nil,
+			apperrors.Metadata{"domain": domain},
+		)
+	}
+
+	if domain == "" {
+		return invalid("routing rule requires a domain")
+	}
+	value := domain
+	for _, prefix := range domainMatcherPrefixes {
+		if strings.HasPrefix(domain, prefix) {
+			value = strings.TrimPrefix(domain, prefix)
+			if prefix == "regexp:" {
+				if _, err := regexp.Compile(value); err != nil {
+					return invalid("invalid regular expression in domain rule")
+				}
+				return nil
+			}
+			break
+		}
+	}
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"") {
+		return invalid("domain rule must not be empty or contain whitespace")
+	}
+	return nil
+}
+
+func vtruiRoutingPath() string {
+	return filepath.Join(vtruiConfigDir, vtruiRoutingFile)
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+const (
+	vtruiInboundFile       = "inbound.json"
+	defaultVtruiUserEmail  = "default"
+	maxVtruiUserEmailRunes = 64
+)
+
+// VtruiUser describes a client account accepted by the vtrui inbounds.
+type VtruiUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email,omitempty"`
+}
+
+// Label returns the email tag when present, falling back to the UUID.
+func (u VtruiUser) Label() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.ID
+}
+
+// ListVtruiUsers returns the clients configured in the vtrui inbound configuration.
+func ListVtruiUsers() ([]VtruiUser, error) {
+	doc, err := loadVtruiInbounds()
+	if err != nil {
+		return nil, err
+	}
+	return doc.users(), nil
+}
+
+// AddVtruiUser generates a new client UUID, tags it with email and rewrites
+// inbound.json atomically. vtrui only keeps traffic stats for tagged clients,
+// so an empty email is replaced by a tag derived from the UUID.
+func AddVtruiUser(email string) (VtruiUser, error) {
+	return addVtruiUser(email, vtruiCommitOptions{checkNginx: true})
+}
+
+func addVtruiUser(email string, opts vtruiCommitOptions) (VtruiUser, error) {
+	email, err := NormalizeVtruiEmail(email)
+	if err != nil {
+		return VtruiUser{}, err
+	}
+
+	doc, err := loadVtruiInbounds()
+	if err != nil {
+		return VtruiUser{}, err
+	}
+	users := doc.users()
+
+	if email != "" {
+		if _, ok := findVtruiUser(users, email); ok {
+			return VtruiUser{}, newConfiguratorError(
+				"configurator.AddVtruiUser",
+				"a vtrui user with this email already exists",
+				nil,
+				apperrors.Metadata{"email": email},
+			)
+		}
+	}
+
+	id, err := newUUIDv4()
+	if err != nil {
+		return VtruiUser{}, newConfiguratorError("configurator.AddVtruiUser", "failed to generate client UUID", err, nil)
+	}
+
+	if email == "" {
+		email = "user-" + id[:8]
+	}
+
+	user := VtruiUser{ID: id, Email: email}
+	doc.setUsers(append(users, user))
+	if err := doc.commit(opts); err != nil {
+		return VtruiUser{}, err
+	}
+
+	return user, nil
+}
+
+// RemoveVtruiUser deletes the client matching ref (UUID or email).
+func RemoveVtruiUser(ref string) (VtruiUser, error) {
+	doc, err := loadVtruiInbounds()
+	if err != nil {
+		return VtruiUser{}, err
+	}
+	users := doc.users()
+
+	idx, ok := findVtruiUser(users, ref)
+	if !ok {
+		return VtruiUser{}, newConfiguratorError(
+			"configurator.RemoveVtruiUser",
+			"vtrui user not found",
+			nil,
+			apperrors.Metadata{"user": ref},
+		)
+	}
+
+	removed := users[idx]
+	users = append(users[:idx], users[idx+1:]...)
+	doc.setUsers(users)
+	if err := doc.save(); err != nil {
+		return VtruiUser{}, err
+	}
+
+	return removed, nil
+}
+
+// RenameVtruiUser replaces the email tag of the client matching ref (UUID or email).
+func RenameVtruiUser(ref, email string) (VtruiUser, error) {
+	email, err := NormalizeVtruiEmail(email)
+	if err != nil {
+		return VtruiUser{}, err
+	}
+	if email == "" {
+		return VtruiUser{}, newConfiguratorError(
+			"configurator.RenameVtruiUser",
+			"user email must not be empty; traffic accounting is keyed on it",
+			nil,
+			apperrors.Metadata{"user": ref},
+		)
+	}
+
+	doc, err := loadVtruiInbounds()
+	if err != nil {
+		return VtruiUser{}, err
+	}
+	users := doc.users()
+
+	idx, ok := findVtruiUser(users, ref)
+	if !ok {
+		return VtruiUser{}, newConfiguratorError(
+			"configurator.RenameVtruiUser",
+			"vtrui user not found",
+			nil,
+			apperrors.Metadata{"user": ref},
+		)
+	}
+	if other, exists := findVtruiUser(users, email); exists && other != idx {
+		return VtruiUser{}, newConfiguratorError(
+			"configurator.RenameVtruiUser",
+			"a vtrui user with this email already exists",
+			nil,
+			apperrors.Metadata{"email": email},
+		)
+	}
+
+	users[idx].Email = email
+	doc.setUsers(users)
+	if err := doc.save(); err != nil {
+		return VtruiUser{}, err
+	}
+
+	return users[idx], nil
+}
+
+// RestoreVtruiUser re-adds a previously removed client with its original UUID,
+// e.g. when a suspended user is re-enabled.
+func RestoreVtruiUser(user VtruiUser) error {
+	email, err := NormalizeVtruiEmail(user.Email)
+	if err != nil {
+		return err
+	}
+
+	doc, err := loadVtruiInbounds()
+	if err != nil {
+		return err
+	}
+	users := doc.users()
+
+	for _, ref := range []string{user.ID, email} {
+		if _, exists := findVtruiUser(users, ref); exists {
+			return newConfiguratorError(
+				"configurator.RestoreVtruiUser",
+				"a vtrui user with this UUID or email already exists",
+				nil,
+				apperrors.Metadata{"user": ref},
+			)
+		}
+	}
+
+	doc.setUsers(append(users, VtruiUser{ID: user.ID, Email: email}))
+	return doc.save()
+}
+
+// EnsureDefaultVtruiUser creates an initial client when the inbound has none,
+// so a fresh installation accepts at least one connection. It runs before
+// nginx is configured, so nginx locations are not checked.
+func EnsureDefaultVtruiUser() (VtruiUser, bool, error) {
+	users, err := ListVtruiUsers()
+	if err != nil {
+		return VtruiUser{}, false, err
+	}
+	if len(users) > 0 {
+		return users[0], false, nil
+	}
+
+	user, err := addVtruiUser(defaultVtruiUserEmail, vtruiCommitOptions{})
+	if err != nil {
+		return VtruiUser{}, false, err
+	}
+	return user, true, nil
+}
+
+func findVtruiUser(users []VtruiUser, ref string) (int, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, false
+	}
+	for idx, user := range users {
+		if strings.EqualFold(user.ID, ref) {
+			return idx, true
+		}
+		if user.Email != "" && strings.EqualFold(user.Email, ref) {
+			return idx, true
+		}
+	}
+	return -1, false
+}
+
+// NormalizeVtruiEmail trims email and rejects tags vtrui cannot use as a stats key.
+func NormalizeVtruiEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(email, " \t\r\n") {
+		return "", newConfiguratorError(
+			"configurator.NormalizeVtruiEmail",
+			"user email must not contain whitespace",
+			nil,
+			apperrors.Metadata{"email": email},
+		)
+	}
+	if len([]rune(email)) > maxVtruiUserEmailRunes {
+		return "", newConfiguratorError(
+			"configurator.NormalizeVtruiEmail",
+			"user email is too long",
+			nil,
+			apperrors.Metadata{"email": email, "max_length": maxVtruiUserEmailRunes},
+		)
+	}
+	return email, nil
+}
+
+// newUUIDv4 returns a random RFC 4122 version 4 UUID.
+func newUUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
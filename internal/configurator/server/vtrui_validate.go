@@ -0,0 +1,388 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const (
+	vtruiBinary          = "/usr/local/bin/vtrui"
+	vtruiTestTimeout     = 30 * time.Second
+	nginxDefaultConfPath = "/etc/nginx/conf.d/default.conf"
+)
+
+// vtruiConfigFiles lists the documents vtrui merges from its -confdir.
+var vtruiConfigFiles = []string{vtruiConfigFile, vtruiInboundFile, vtruiOutboundFile}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// vtruiConfigModel is the subset of the vtrui (xray) schema GWD validates.
+// Each file in the confdir is decoded into it and merged, mirroring how vtrui
+// concatenates inbounds/outbounds across files.
+type vtruiConfigModel struct {
+	API *struct {
+		Tag string `json:"tag"`
+	} `json:"api"`
+	Inbounds []struct {
+		Tag      string `json:"tag"`
+		Listen   string `json:"listen"`
+		Port     int    `json:"port"`
+		Protocol string `json:"protocol"`
+		Settings struct {
+			Clients []vtruiClient `json:"clients"`
+		} `json:"settings"`
+	} `json:"inbounds"`
+	Outbounds []struct {
+		Tag      string `json:"tag"`
+		Protocol string `json:"protocol"`
+	} `json:"outbounds"`
+	Routing *struct {
+		Rules []struct {
+			InboundTag  []string `json:"inboundTag"`
+			OutboundTag string   `json:"outboundTag"`
+			BalancerTag string   `json:"balancerTag"`
+		} `json:"rules"`
+	} `json:"routing"`
+}
+
+// vtruiCommitOptions tunes the checks run by commitVtruiFiles.
+type vtruiCommitOptions struct {
+	// checkNginx verifies loopback inbounds against the nginx default server.
+	// Installation skips it because nginx is regenerated from the same specs.
+	checkNginx bool
+}
+
+// TestVtruiConfig runs "vtrui run -test" against the live confdir. It is a
+// no-op when the binary is not installed yet.
+func TestVtruiConfig() error {
+	return runVtruiConfigTest(vtruiConfigDir)
+}
+
+// commitVtruiFiles validates the confdir with changes applied, runs the
+// vtrui self-test on a staged copy and only then replaces the changed files.
+func commitVtruiFiles(changes map[string][]byte, opts vtruiCommitOptions) error {
+	files, err := readVtruiConfigFiles(changes)
+	if err != nil {
+		return err
+	}
+	if err := validateVtruiConfigFiles(files, opts); err != nil {
+		return err
+	}
+	if err := testStagedVtruiConfig(files); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(vtruiConfigDir, 0o755); err != nil {
+		return newConfiguratorError(
+			"configurator.commitVtruiFiles",
+			"failed to create vtrui configuration directory",
+			err,
+			apperrors.Metadata{"path": vtruiConfigDir},
+		)
+	}
+	for _, name := range vtruiConfigFiles {
+		data, changed := changes[name]
+		if !changed {
+			continue
+		}
+		path := filepath.Join(vtruiConfigDir, name)
+		if err := system.WriteFileAtomic(path, data, 0o644); err != nil {
+			return newConfiguratorError(
+				"configurator.commitVtruiFiles",
+				"failed to write vtrui configuration file",
+				err,
+				apperrors.Metadata{"path": path, "file": name},
+			)
+		}
+	}
+	return nil
+}
+
+// readVtruiConfigFiles returns the confdir contents with changes overlaid;
+// missing files are treated as absent.
+func readVtruiConfigFiles(changes map[string][]byte) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(vtruiConfigFiles))
+	for _, name := range vtruiConfigFiles {
+		if data, ok := changes[name]; ok {
+			files[name] = data
+			continue
+		}
+		path := filepath.Join(vtruiConfigDir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, newConfiguratorError(
+				"configurator.readVtruiConfigFiles",
+				"failed to read vtrui configuration file",
+				err,
+				apperrors.Metadata{"path": path},
+			)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+func validateVtruiConfigFiles(files map[string][]byte, opts vtruiCommitOptions) error {
+	invalid := func(message string, metadata apperrors.Metadata) error {
+		return newConfiguratorError("configurator.validateVtruiConfig", message, nil, metadata)
+	}
+
+	var merged vtruiConfigModel
+	for _, name := range vtruiConfigFiles {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		var model vtruiConfigModel
+		if err := json.Unmarshal(data, &model); err != nil {
+			return newConfiguratorError(
+				"configurator.validateVtruiConfig",
+				"vtrui configuration file is not valid JSON",
+				err,
+				apperrors.Metadata{"file": name},
+			)
+		}
+		if model.API != nil {
+			merged.API = model.API
+		}
+		if model.Routing != nil {
+			merged.Routing = model.Routing
+		}
+		merged.Inbounds = append(merged.Inbounds, model.Inbounds...)
+		merged.Outbounds = append(merged.Outbounds, model.Outbounds...)
+	}
+
+	inboundTags := make(map[string]struct{})
+	listeners := make(map[string]string)
+	for _, inbound := range merged.Inbounds {
+		if inbound.Tag != "" {
+			if _, dup := inboundTags[inbound.Tag]; dup {
+				return invalid("duplicate inbound tag", apperrors.Metadata{"tag": inbound.Tag})
+			}
+			inboundTags[inbound.Tag] = struct{}{}
+		}
+		if inbound.Port < 1 || inbound.Port > 65535 {
+			return invalid("inbound port must be between 1 and 65535", apperrors.Metadata{"tag": inbound.Tag, "port": inbound.Port})
+		}
+		listener := fmt.Sprintf("%s:%d", inbound.Listen, inbound.Port)
+		if other, dup := listeners[listener]; dup {
+			return invalid("inbounds listen on the same address", apperrors.Metadata{"tag": inbound.Tag, "other": other, "listen": listener})
+		}
+		listeners[listener] = inbound.Tag
+
+		if err := validateVtruiClients(inbound.Tag, inbound.Protocol, inbound.Settings.Clients); err != nil {
+			return err
+		}
+	}
+
+	outboundTags := make(map[string]struct{})
+	for _, outbound := range merged.Outbounds {
+		if outbound.Tag == "" {
+			continue
+		}
+		if _, dup := outboundTags[outbound.Tag]; dup {
+			return invalid("duplicate outbound tag", apperrors.Metadata{"tag": outbound.Tag})
+		}
+		outboundTags[outbound.Tag] = struct{}{}
+	}
+	if files[vtruiOutboundFile] != nil && len(merged.Outbounds) == 0 {
+		return invalid("at least one outbound is required", nil)
+	}
+	// The api section creates an implicit outbound for its tag.
+	if merged.API != nil && merged.API.Tag != "" {
+		outboundTags[merged.API.Tag] = struct{}{}
+	}
+
+	if merged.Routing != nil {
+		for idx, rule := range merged.Routing.Rules {
+			if rule.OutboundTag == "" && rule.BalancerTag == "" {
+				return invalid("routing rule has no outboundTag", apperrors.Metadata{"rule": idx})
+			}
+			if rule.OutboundTag != "" {
+				if _, ok := outboundTags[rule.OutboundTag]; !ok {
+					return invalid("routing rule references an unknown outbound", apperrors.Metadata{"rule": idx, "outbound": rule.OutboundTag})
+				}
+			}
+			for _, tag := range rule.InboundTag {
+				if _, ok := inboundTags[tag]; !ok {
+					return invalid("routing rule references an unknown inbound", apperrors.Metadata{"rule": idx, "inbound": tag})
+				}
+			}
+		}
+	}
+
+	if opts.checkNginx {
+		return checkVtruiNginxRoutes(files[vtruiInboundFile])
+	}
+	return nil
+}
+
+func validateVtruiClients(tag, protocol string, clients []vtruiClient) error {
+	seen := make(map[string]struct{}, len(clients))
+	for _, client := range clients {
+		secret := client.ID
+		switch protocol {
+		case VtruiProtocolTrojan:
+			secret = client.Password
+			if secret == "" {
+				return newConfiguratorError("configurator.validateVtruiClients", "trojan client requires a password", nil,
+					apperrors.Metadata{"inbound": tag, "email": client.Email})
+			}
+		case VtruiProtocolVMess, VtruiProtocolVLESS:
+			if !uuidPattern.MatchString(secret) {
+				return newConfiguratorError("configurator.validateVtruiClients", "client id must be a UUID", nil,
+					apperrors.Metadata{"inbound": tag, "email": client.Email})
+			}
+		default:
+			continue
+		}
+		key := strings.ToLower(secret)
+		if _, dup := seen[key]; dup {
+			return newConfiguratorError("configurator.validateVtruiClients", "duplicate client in inbound", nil,
+				apperrors.Metadata{"inbound": tag, "email": client.Email})
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
+// checkVtruiNginxRoutes verifies every rendered inbound path is proxied by the
+// nginx default server to the matching loopback port. It is skipped when
+// nginx has not been configured yet.
+func checkVtruiNginxRoutes(inboundData []byte) error {
+	if inboundData == nil {
+		return nil
+	}
+	routes, err := nginxLoopbackRoutes(nginxDefaultConfPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return newConfiguratorError(
+			"configurator.checkVtruiNginxRoutes",
+			"failed to read nginx configuration",
+			err,
+			apperrors.Metadata{"path": nginxDefaultConfPath},
+		)
+	}
+
+	var file vtruiInboundsFile
+	if err := json.Unmarshal(inboundData, &file); err != nil {
+		return newConfiguratorError("configurator.checkVtruiNginxRoutes", "failed to parse vtrui inbound configuration", err, nil)
+	}
+	for _, spec := range file.specs() {
+		port, ok := routes[spec.Path]
+		if !ok {
+			return newConfiguratorError(
+				"configurator.checkVtruiNginxRoutes",
+				"nginx has no location for vtrui inbound path",
+				nil,
+				apperrors.Metadata{"tag": spec.Tag, "path": spec.Path, "nginx": nginxDefaultConfPath},
+			)
+		}
+		if port != spec.Port {
+			return newConfiguratorError(
+				"configurator.checkVtruiNginxRoutes",
+				"nginx proxies vtrui inbound path to a different port",
+				nil,
+				apperrors.Metadata{"tag": spec.Tag, "path": spec.Path, "port": spec.Port, "nginx_port": port},
+			)
+		}
+	}
+	return nil
+}
+
+var (
+	nginxLocationPattern = regexp.MustCompile(`^\s*location\s+(?:\^~\s+|=\s+)?(/\S*)\s*\{`)
+	nginxUpstreamPattern = regexp.MustCompile(`^\s*(?:proxy_pass|grpc_pass)\s+\w+://127\.0\.0\.1:(\d+)`)
+)
+
+// nginxLoopbackRoutes maps location paths to the loopback port they proxy to.
+func nginxLoopbackRoutes(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]int)
+	location := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := nginxLocationPattern.FindStringSubmatch(line); match != nil {
+			location = match[1]
+			if location != "/" {
+				location = strings.TrimSuffix(location, "/")
+			}
+			continue
+		}
+		if match := nginxUpstreamPattern.FindStringSubmatch(line); match != nil && location != "" {
+			port, _ := strconv.Atoi(match[1])
+			routes[location] = port
+		}
+	}
+	return routes, scanner.Err()
+}
+
+// testStagedVtruiConfig writes files to a temporary confdir and runs the
+// vtrui self-test on it.
+func testStagedVtruiConfig(files map[string][]byte) error {
+	if _, err := os.Stat(vtruiBinary); err != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "vtrui-test-")
+	if err != nil {
+		return newConfiguratorError("configurator.testStagedVtruiConfig", "failed to create staging directory", err, nil)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return newConfiguratorError(
+				"configurator.testStagedVtruiConfig",
+				"failed to stage vtrui configuration",
+				err,
+				apperrors.Metadata{"file": name},
+			)
+		}
+	}
+	return runVtruiConfigTest(dir)
+}
+
+func runVtruiConfigTest(dir string) error {
+	if _, err := os.Stat(vtruiBinary); err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vtruiTestTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, vtruiBinary, "run", "-test", "-confdir", dir).CombinedOutput()
+	if err != nil {
+		return newConfiguratorError(
+			"configurator.runVtruiConfigTest",
+			"vtrui rejected the configuration",
+			err,
+			apperrors.Metadata{"confdir": dir, "output": strings.TrimSpace(string(output))},
+		)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/system"
+)
+
+const (
+	// WireGuardInterface is the interface name used for the WARP upstream,
+	// matching the wg-quick@wgcf unit checked by the status screen.
+	WireGuardInterface = "wgcf"
+	// VtruiWarpOutbound is the vtrui outbound tag that egresses through WireGuardInterface.
+	VtruiWarpOutbound = "warp"
+
+	wireGuardConfigDir   = "/etc/wireguard"
+	defaultWireGuardMTU  = 1280
+	defaultWarpAllowedIP = "0.0.0.0/0, ::/0"
+)
+
+// WireGuardConfig holds the fields GWD needs to bring up the WARP interface.
+type WireGuardConfig struct {
+	PrivateKey    string
+	Addresses     []string
+	PeerPublicKey string
+	Endpoint      string
+	MTU           int
+}
+
+// WireGuardConfigPath returns the wg-quick configuration file for WireGuardInterface.
+func WireGuardConfigPath() string {
+	return filepath.Join(wireGuardConfigDir, WireGuardInterface+".conf")
+}
+
+// ParseWgcfProfile extracts the interface and peer settings from a
+// wgcf-profile.conf (or any single-peer wg-quick file).
+func ParseWgcfProfile(data []byte) (WireGuardConfig, error) {
+	var cfg WireGuardConfig
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch section + "." + key {
+		case "interface.privatekey":
+			cfg.PrivateKey = value
+		case "interface.address":
+			for _, addr := range strings.Split(value, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					cfg.Addresses = append(cfg.Addresses, addr)
+				}
+			}
+		case "interface.mtu":
+			mtu, err := strconv.Atoi(value)
+			if err != nil {
+				return WireGuardConfig{}, newConfiguratorError(
+					"configurator.ParseWgcfProfile",
+					"invalid MTU in WireGuard profile",
+					err,
+					apperrors.Metadata{"mtu": value},
+				)
+			}
+			cfg.MTU = mtu
+		case "peer.publickey":
+			cfg.PeerPublicKey = value
+		case "peer.endpoint":
+			cfg.Endpoint = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return WireGuardConfig{}, newConfiguratorError("configurator.ParseWgcfProfile", "failed to read WireGuard profile", err, nil)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks keys, addresses and the peer endpoint.
+func (c WireGuardConfig) Validate() error {
+	invalid := func(message string, metadata apperrors.Metadata) error {
+		return newConfiguratorError("configurator.WireGuardConfig.Validate", message, nil, metadata)
+	}
+
+	if !isWireGuardKey(c.PrivateKey) {
+		return invalid("WireGuard private key must be a base64 encoded 32 byte key", nil)
+	}
+	if !isWireGuardKey(c.PeerPublicKey) {
+		return invalid("WireGuard peer public key must be a base64 encoded 32 byte key", nil)
+	}
+	if len(c.Addresses) == 0 {
+		return invalid("WireGuard interface requires at least one address", nil)
+	}
+	for _, addr := range c.Addresses {
+		if _, err := netip.ParsePrefix(addr); err != nil {
+			return invalid("invalid WireGuard interface address", apperrors.Metadata{"address": addr})
+		}
+	}
+	host, port, err := net.SplitHostPort(c.Endpoint)
+	if err != nil || host == "" {
+		return invalid("WireGuard endpoint must be host:port", apperrors.Metadata{"endpoint": c.Endpoint})
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return invalid("WireGuard endpoint port is invalid", apperrors.Metadata{"endpoint": c.Endpoint})
+	}
+	if c.MTU != 0 && (c.MTU < 1280 || c.MTU > 1500) {
+		return invalid("WireGuard MTU must be between 1280 and 1500", apperrors.Metadata{"mtu": c.MTU})
+	}
+	return nil
+}
+
+// WriteWireGuardConfig renders the wg-quick configuration. "Table = off" keeps
+// the host default route untouched; only vtrui traffic bound to the
+// interface egresses through WARP.
+func WriteWireGuardConfig(cfg WireGuardConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = defaultWireGuardMTU
+	}
+
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", cfg.PrivateKey)
+	fmt.Fprintf(&b, "Address = %s\n", strings.Join(cfg.Addresses, ", "))
+	fmt.Fprintf(&b, "MTU = %d\n", mtu)
+	b.WriteString("Table = off\n")
+	b.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %s\n", cfg.PeerPublicKey)
+	fmt.Fprintf(&b, "AllowedIPs = %s\n", defaultWarpAllowedIP)
+	fmt.Fprintf(&b, "Endpoint = %s\n", cfg.Endpoint)
+	b.WriteString("PersistentKeepalive = 25\n")
+
+	if err := os.MkdirAll(wireGuardConfigDir, 0o700); err != nil {
+		return newConfiguratorError(
+			"configurator.WriteWireGuardConfig",
+			"failed to create WireGuard configuration directory",
+			err,
+			apperrors.Metadata{"path": wireGuardConfigDir},
+		)
+	}
+
+	path := WireGuardConfigPath()
+	if err := system.WriteFileAtomic(path, []byte(b.String()), 0o600); err != nil {
+		return newConfiguratorError(
+			"configurator.WriteWireGuardConfig",
+			"failed to write WireGuard configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+	return nil
+}
+
+// VtruiWarpEnabled reports whether outbound.json contains the WARP outbound.
+func VtruiWarpEnabled() (bool, error) {
+	tags, err := VtruiOutboundTags()
+	if err != nil {
+		return false, err
+	}
+	return containsString(tags, VtruiWarpOutbound), nil
+}
+
+// VtruiWarpRouting returns the stored routing policy with the given domain
+// matchers routed through WARP, normalized but not applied.
+func VtruiWarpRouting(domains []string) (VtruiRoutingPolicy, error) {
+	policy, err := LoadVtruiRouting()
+	if err != nil {
+		return VtruiRoutingPolicy{}, err
+	}
+	for _, domain := range domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		replaced := false
+		for idx := range policy.DomainRules {
+			if policy.DomainRules[idx].Domain == domain {
+				policy.DomainRules[idx].Outbound = VtruiWarpOutbound
+				replaced = true
+			}
+		}
+		if !replaced {
+			policy.DomainRules = append(policy.DomainRules, VtruiDomainRule{Domain: domain, Outbound: VtruiWarpOutbound})
+		}
+	}
+	return normalizeVtruiRouting(policy)
+}
+
+// EnableVtruiWarpOutbound adds the WARP outbound to outbound.json and routes
+// the given domain matchers through it. Both files are validated and
+// committed together, so a rejected domain or vtrui self-test changes
+// neither.
+func EnableVtruiWarpOutbound(domains []string) error {
+	policy, err := VtruiWarpRouting(domains)
+	if err != nil {
+		return err
+	}
+
+	outboundPath := filepath.Join(vtruiConfigDir, vtruiOutboundFile)
+	outboundData, err := os.ReadFile(outboundPath)
+	if err != nil {
+		return newConfiguratorError(
+			"configurator.EnableVtruiWarpOutbound",
+			"failed to read vtrui outbound configuration",
+			err,
+			apperrors.Metadata{"path": outboundPath},
+		)
+	}
+	outbound, err := withVtruiWarpOutbound(outboundData, true)
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(vtruiConfigDir, vtruiConfigFile)
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return newConfiguratorError(
+			"configurator.EnableVtruiWarpOutbound",
+			"failed to read vtrui configuration",
+			err,
+			apperrors.Metadata{"path": configPath},
+		)
+	}
+	config, err := withVtruiRouting(configData, policy)
+	if err != nil {
+		return err
+	}
+
+	if err := commitVtruiFiles(map[string][]byte{
+		vtruiOutboundFile: outbound,
+		vtruiConfigFile:   config,
+	}, vtruiCommitOptions{}); err != nil {
+		return err
+	}
+	return storeVtruiRouting(policy)
+}
+
+// DisableVtruiWarpOutbound drops every routing rule targeting WARP and then
+// removes the outbound itself.
+func DisableVtruiWarpOutbound() error {
+	policy, err := LoadVtruiRouting()
+	if err != nil {
+		return err
+	}
+	rules := policy.DomainRules[:0]
+	for _, rule := range policy.DomainRules {
+		if rule.Outbound != VtruiWarpOutbound {
+			rules = append(rules, rule)
+		}
+	}
+	policy.DomainRules = rules
+	if err := SaveVtruiRouting(policy); err != nil {
+		return err
+	}
+
+	return setVtruiWarpOutbound(false)
+}
+
+// vtruiWarpOutbound binds a freedom outbound to the WireGuard interface.
+func vtruiWarpOutbound() map[string]any {
+	return map[string]any{
+		"tag":      VtruiWarpOutbound,
+		"protocol": "freedom",
+		"settings": map[string]any{
+			"domainStrategy": "UseIP",
+		},
+		"streamSettings": map[string]any{
+			"sockopt": map[string]any{
+				"interface":   WireGuardInterface,
+				"tcpFastOpen": true,
+				"tcpNoDelay":  true,
+			},
+		},
+	}
+}
+
+func setVtruiWarpOutbound(enabled bool) error {
+	path := filepath.Join(vtruiConfigDir, vtruiOutboundFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newConfiguratorError(
+			"configurator.setVtruiWarpOutbound",
+			"failed to read vtrui outbound configuration",
+			err,
+			apperrors.Metadata{"path": path},
+		)
+	}
+
+	out, err := withVtruiWarpOutbound(data, enabled)
+	if err != nil {
+		return err
+	}
+	return commitVtruiFiles(map[string][]byte{vtruiOutboundFile: out}, vtruiCommitOptions{})
+}
+
+// withVtruiWarpOutbound returns the outbound.json document data with the WARP
+// outbound added or removed.
+func withVtruiWarpOutbound(data []byte, enabled bool) ([]byte, error) {
+	var doc struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, newConfiguratorError("configurator.withVtruiWarpOutbound", "failed to parse vtrui outbound configuration", err, nil)
+	}
+
+	outbounds := make([]json.RawMessage, 0, len(doc.Outbounds)+1)
+	for _, raw := range doc.Outbounds {
+		var head struct {
+			Tag string `json:"tag"`
+		}
+		if err := json.Unmarshal(raw, &head); err == nil && head.Tag == VtruiWarpOutbound {
+			continue
+		}
+		outbounds = append(outbounds, raw)
+	}
+	if enabled {
+		raw, err := json.Marshal(vtruiWarpOutbound())
+		if err != nil {
+			return nil, newConfiguratorError("configurator.withVtruiWarpOutbound", "failed to encode WARP outbound", err, nil)
+		}
+		outbounds = append(outbounds, raw)
+	}
+	doc.Outbounds = outbounds
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, newConfiguratorError("configurator.withVtruiWarpOutbound", "failed to encode vtrui outbound configuration", err, nil)
+	}
+	return append(out, '\n'), nil
+}
+
+func isWireGuardKey(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	return err == nil && len(decoded) == 32
+}
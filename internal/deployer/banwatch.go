@@ -0,0 +1,25 @@
+package deployer
+
+const (
+	banwatchComponentName   = "gwd-banwatch"
+	banwatchServiceUnit     = "gwd-banwatch.service"
+	banwatchServiceTemplate = "gwd-banwatch.service.tmpl"
+)
+
+type banwatchServiceData struct {
+	Executable string
+}
+
+// NewBanWatcher returns the long-running service that executes
+// "<executable> firewall watch" to ban addresses found in the nginx logs.
+func NewBanWatcher(executable string) Component {
+	return NewGenericDeployer("", ComponentConfig{
+		Name:        banwatchComponentName,
+		BinaryPath:  executable,
+		ServiceUnit: banwatchServiceUnit,
+		Service: TemplateConfig{
+			Source: banwatchServiceTemplate,
+			Data:   banwatchServiceData{Executable: executable},
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package deployer
+
+const (
+	blocklistComponentName   = "gwd-blocklist"
+	blocklistServiceUnit     = "gwd-blocklist.service"
+	blocklistTimerUnit       = "gwd-blocklist.timer"
+	blocklistServiceTemplate = "gwd-blocklist.service.tmpl"
+	blocklistTimerTemplate   = "gwd-blocklist.timer"
+)
+
+type blocklistServiceData struct {
+	Executable string
+}
+
+// NewBlocklistUpdater returns the timer that periodically runs
+// "<executable> dns blocklist refresh" to re-download DNS blocklists.
+func NewBlocklistUpdater(executable string) Component {
+	return NewTimerDeployer(TimerConfig{
+		Name:        blocklistComponentName,
+		ServiceUnit: blocklistServiceUnit,
+		TimerUnit:   blocklistTimerUnit,
+		Service: TemplateConfig{
+			Source: blocklistServiceTemplate,
+			Data:   blocklistServiceData{Executable: executable},
+		},
+		Timer: TemplateConfig{
+			Source: blocklistTimerTemplate,
+		},
+	})
+}
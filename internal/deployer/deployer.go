@@ -24,6 +24,9 @@ type TemplateConfig struct {
 }
 
 // ComponentConfig defines the resources required to deploy a component.
+// An empty BinaryName means the binary is provided by a distribution package;
+// only its presence at BinaryPath is validated. Likewise an empty
+// Service.Source keeps the package's unit and only DropIns are written.
 type ComponentConfig struct {
 	Name        string
 	BinaryName  string
@@ -68,24 +71,28 @@ func (g *GenericDeployer) Install() error {
 		}
 	}
 
-	if err := deployBinary(g.repoDir, g.config.BinaryName, g.config.BinaryPath); err != nil {
-		return newDeployerError("deployer.GenericDeployer.Install", "failed to deploy binary", err, apperrors.Metadata{
-			"binary": g.config.BinaryName,
-			"target": g.config.BinaryPath,
-		})
+	if g.config.BinaryName != "" {
+		if err := deployBinary(g.repoDir, g.config.BinaryName, g.config.BinaryPath); err != nil {
+			return newDeployerError("deployer.GenericDeployer.Install", "failed to deploy binary", err, apperrors.Metadata{
+				"binary": g.config.BinaryName,
+				"target": g.config.BinaryPath,
+			})
+		}
 	}
 
-	serviceContent, err := renderTemplate(g.config.Service.Source, g.config.Service.Data)
-	if err != nil {
-		return newDeployerError("deployer.GenericDeployer.Install", "failed to render systemd service template", err, apperrors.Metadata{
-			"template": g.config.Service.Source,
-		})
-	}
+	if g.config.Service.Source != "" {
+		serviceContent, err := renderTemplate(g.config.Service.Source, g.config.Service.Data)
+		if err != nil {
+			return newDeployerError("deployer.GenericDeployer.Install", "failed to render systemd service template", err, apperrors.Metadata{
+				"template": g.config.Service.Source,
+			})
+		}
 
-	if err := writeSystemdUnit(g.config.ServiceUnit, serviceContent); err != nil {
-		return newDeployerError("deployer.GenericDeployer.Install", "failed to write systemd unit", err, apperrors.Metadata{
-			"unit": g.config.ServiceUnit,
-		})
+		if err := writeSystemdUnit(g.config.ServiceUnit, serviceContent); err != nil {
+			return newDeployerError("deployer.GenericDeployer.Install", "failed to write systemd unit", err, apperrors.Metadata{
+				"unit": g.config.ServiceUnit,
+			})
+		}
 	}
 
 	for dropInName, dropInTemplate := range g.config.DropIns {
@@ -122,11 +129,22 @@ func (g *GenericDeployer) Validate() error {
 		})
 	}
 
-	unitPath := filepath.Join(systemdDir, g.config.ServiceUnit)
-	if _, err := os.Stat(unitPath); err != nil {
-		return newDeployerError("deployer.GenericDeployer.Validate", "systemd unit not found", err, apperrors.Metadata{
-			"path": unitPath,
-		})
+	if g.config.Service.Source != "" {
+		unitPath := filepath.Join(systemdDir, g.config.ServiceUnit)
+		if _, err := os.Stat(unitPath); err != nil {
+			return newDeployerError("deployer.GenericDeployer.Validate", "systemd unit not found", err, apperrors.Metadata{
+				"path": unitPath,
+			})
+		}
+	}
+
+	for dropInName := range g.config.DropIns {
+		dropInPath := filepath.Join(systemdDir, g.config.ServiceUnit+systemdDropIn, dropInName)
+		if _, err := os.Stat(dropInPath); err != nil {
+			return newDeployerError("deployer.GenericDeployer.Validate", "systemd drop-in not found", err, apperrors.Metadata{
+				"path": dropInPath,
+			})
+		}
 	}
 
 	for _, dir := range g.config.ConfigDirs {
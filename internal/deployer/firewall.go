@@ -0,0 +1,44 @@
+package deployer
+
+const (
+	firewallComponentName          = "gwd-firewall"
+	firewallServiceUnit            = "gwd-firewall.service"
+	firewallServiceTemplate        = "gwd-firewall.service.tmpl"
+	firewallRestoreComponentName   = "gwd-firewall-restore"
+	firewallRestoreServiceUnit     = "gwd-firewall-restore.service"
+	firewallRestoreServiceTemplate = "gwd-firewall-restore.service.tmpl"
+)
+
+type firewallServiceData struct {
+	Executable string
+}
+
+// NewFirewallRestorer returns the oneshot service that executes
+// "<executable> firewall restore" before network-pre.target, so the
+// confirmed ruleset is in place before any interface comes up.
+func NewFirewallRestorer(executable string) Component {
+	return NewGenericDeployer("", ComponentConfig{
+		Name:        firewallRestoreComponentName,
+		BinaryPath:  executable,
+		ServiceUnit: firewallRestoreServiceUnit,
+		Service: TemplateConfig{
+			Source: firewallRestoreServiceTemplate,
+			Data:   firewallServiceData{Executable: executable},
+		},
+	})
+}
+
+// NewFirewallPersister returns the long-running service that executes
+// "<executable> firewall persist" to re-apply the firewall once the network
+// is up and whenever the flowtable devices change.
+func NewFirewallPersister(executable string) Component {
+	return NewGenericDeployer("", ComponentConfig{
+		Name:        firewallComponentName,
+		BinaryPath:  executable,
+		ServiceUnit: firewallServiceUnit,
+		Service: TemplateConfig{
+			Source: firewallServiceTemplate,
+			Data:   firewallServiceData{Executable: executable},
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package deployer
+
+const (
+	geoipComponentName   = "gwd-geoip"
+	geoipServiceUnit     = "gwd-geoip.service"
+	geoipTimerUnit       = "gwd-geoip.timer"
+	geoipServiceTemplate = "gwd-geoip.service.tmpl"
+	geoipTimerTemplate   = "gwd-geoip.timer"
+)
+
+type geoipServiceData struct {
+	Executable string
+}
+
+// NewGeoIPUpdater returns the timer that periodically runs
+// "<executable> firewall geoip refresh" to reload the GeoIP country sets.
+func NewGeoIPUpdater(executable string) Component {
+	return NewTimerDeployer(TimerConfig{
+		Name:        geoipComponentName,
+		ServiceUnit: geoipServiceUnit,
+		TimerUnit:   geoipTimerUnit,
+		Service: TemplateConfig{
+			Source: geoipServiceTemplate,
+			Data:   geoipServiceData{Executable: executable},
+		},
+		Timer: TemplateConfig{
+			Source: geoipTimerTemplate,
+		},
+	})
+}
@@ -0,0 +1,26 @@
+package deployer
+
+const (
+	haproxyComponentName = "haproxy"
+	haproxyBinaryPath    = "/usr/sbin/haproxy"
+	haproxyServiceUnit   = "haproxy.service"
+	haproxyOverrideName  = "override.conf"
+	haproxyOverride      = "haproxy-override.conf"
+	haproxyConfigDir     = "/etc/haproxy"
+)
+
+// NewHAProxy returns a deployable HAProxy component. The binary and unit come
+// from the Debian haproxy package; GWD only adds a drop-in.
+func NewHAProxy(repoDir string) Component {
+	return NewGenericDeployer(repoDir, ComponentConfig{
+		Name:        haproxyComponentName,
+		BinaryPath:  haproxyBinaryPath,
+		ServiceUnit: haproxyServiceUnit,
+		DropIns: map[string]TemplateConfig{
+			haproxyOverrideName: {
+				Source: haproxyOverride,
+			},
+		},
+		ConfigDirs: []string{haproxyConfigDir},
+	})
+}
@@ -0,0 +1,72 @@
+package deployer
+
+import (
+	"os"
+	"path/filepath"
+
+	apperrors "GWD/internal/errors"
+)
+
+// TimerConfig defines a oneshot service unit triggered by a systemd timer.
+type TimerConfig struct {
+	Name        string
+	ServiceUnit string
+	TimerUnit   string
+	Service     TemplateConfig
+	Timer       TemplateConfig
+}
+
+// TimerDeployer installs a service/timer unit pair; the service runs an
+// existing binary, so nothing is copied from the repository.
+type TimerDeployer struct {
+	config TimerConfig
+}
+
+// NewTimerDeployer constructs a TimerDeployer with the provided configuration.
+func NewTimerDeployer(config TimerConfig) *TimerDeployer {
+	return &TimerDeployer{config: config}
+}
+
+// Name returns the component name.
+func (t *TimerDeployer) Name() string {
+	return t.config.Name
+}
+
+// Install renders and writes the service and timer units.
+func (t *TimerDeployer) Install() error {
+	units := []struct {
+		unit     string
+		template TemplateConfig
+	}{
+		{t.config.ServiceUnit, t.config.Service},
+		{t.config.TimerUnit, t.config.Timer},
+	}
+
+	for _, u := range units {
+		content, err := renderTemplate(u.template.Source, u.template.Data)
+		if err != nil {
+			return newDeployerError("deployer.TimerDeployer.Install", "failed to render systemd unit template", err, apperrors.Metadata{
+				"template": u.template.Source,
+			})
+		}
+		if err := writeSystemdUnit(u.unit, content); err != nil {
+			return newDeployerError("deployer.TimerDeployer.Install", "failed to write systemd unit", err, apperrors.Metadata{
+				"unit": u.unit,
+			})
+		}
+	}
+	return nil
+}
+
+// Validate verifies that both units exist on disk.
+func (t *TimerDeployer) Validate() error {
+	for _, unit := range []string{t.config.ServiceUnit, t.config.TimerUnit} {
+		unitPath := filepath.Join(systemdDir, unit)
+		if _, err := os.Stat(unitPath); err != nil {
+			return newDeployerError("deployer.TimerDeployer.Validate", "systemd unit not found", err, apperrors.Metadata{
+				"path": unitPath,
+			})
+		}
+	}
+	return nil
+}
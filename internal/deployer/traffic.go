@@ -0,0 +1,30 @@
+package deployer
+
+const (
+	trafficComponentName   = "gwd-traffic"
+	trafficServiceUnit     = "gwd-traffic.service"
+	trafficTimerUnit       = "gwd-traffic.timer"
+	trafficServiceTemplate = "gwd-traffic.service.tmpl"
+	trafficTimerTemplate   = "gwd-traffic.timer"
+)
+
+type trafficServiceData struct {
+	Executable string
+}
+
+// NewTrafficCollector returns the timer that periodically runs
+// "<executable> traffic collect" to accumulate vtrui user statistics.
+func NewTrafficCollector(executable string) Component {
+	return NewTimerDeployer(TimerConfig{
+		Name:        trafficComponentName,
+		ServiceUnit: trafficServiceUnit,
+		TimerUnit:   trafficTimerUnit,
+		Service: TemplateConfig{
+			Source: trafficServiceTemplate,
+			Data:   trafficServiceData{Executable: executable},
+		},
+		Timer: TemplateConfig{
+			Source: trafficTimerTemplate,
+		},
+	})
+}
@@ -0,0 +1,191 @@
+package nftables
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+)
+
+// Ban is one address held in the ban sets.
+type Ban struct {
+	Address netip.Addr
+	// Timeout is the ban length the address was added with.
+	Timeout time.Duration
+	// Expires is the time left before the kernel drops the entry.
+	Expires time.Duration
+}
+
+// BanAddress adds addr to the ban set of its family for timeout; a zero
+// timeout uses the set default (RateLimit.BanTimeout). Banning an address
+// that is already banned leaves its current expiry in place.
+func BanAddress(cfg *Config, addr netip.Addr, timeout time.Duration) error {
+	conn, set, err := banSet(cfg, addr, "nftables.BanAddress")
+	if err != nil {
+		return err
+	}
+
+	element := nf.SetElement{Key: addrKey(addr), Timeout: timeout}
+	if err := conn.SetAddElements(set, []nf.SetElement{element}); err != nil {
+		return firewallError("nftables.BanAddress.add", "failed to queue ban entry", err, apperrors.Metadata{
+			"set":     set.Name,
+			"address": addr.String(),
+		})
+	}
+	if err := conn.Flush(); err != nil {
+		return firewallError("nftables.BanAddress.flush", "failed to add ban entry", err, apperrors.Metadata{
+			"set":     set.Name,
+			"address": addr.String(),
+		})
+	}
+	return nil
+}
+
+// UnbanAddress removes addr from its ban set; it reports whether the address
+// was banned.
+func UnbanAddress(cfg *Config, addr netip.Addr) (bool, error) {
+	conn, set, err := banSet(cfg, addr, "nftables.UnbanAddress")
+	if err != nil {
+		return false, err
+	}
+	addr = addr.Unmap()
+
+	elements, err := conn.GetSetElements(set)
+	if err != nil {
+		return false, firewallError("nftables.UnbanAddress.getElements", "failed to read ban entries", err, apperrors.Metadata{
+			"set": set.Name,
+		})
+	}
+	key := addrKey(addr)
+	found := false
+	for _, element := range elements {
+		if addrFromKey(element.Key) == addr {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	if err := conn.SetDeleteElements(set, []nf.SetElement{{Key: key}}); err != nil {
+		return false, firewallError("nftables.UnbanAddress.delete", "failed to queue ban removal", err, apperrors.Metadata{
+			"set":     set.Name,
+			"address": addr.String(),
+		})
+	}
+	if err := conn.Flush(); err != nil {
+		return false, firewallError("nftables.UnbanAddress.flush", "failed to remove ban entry", err, apperrors.Metadata{
+			"set":     set.Name,
+			"address": addr.String(),
+		})
+	}
+	return true, nil
+}
+
+// ListBans returns the banned addresses of both families, soonest expiry
+// last. A missing table yields no bans.
+func ListBans(cfg *Config) ([]Ban, error) {
+	cfg = normalizedConfig(cfg)
+	conn := newConn()
+
+	exists, err := tableExists(conn, cfg.TableName, nf.TableFamilyINet)
+	if err != nil || !exists {
+		return nil, err
+	}
+	table := &nf.Table{Name: cfg.TableName, Family: nf.TableFamilyINet}
+
+	var bans []Ban
+	for _, name := range []string{cfg.RateLimit.BanSetName, cfg.RateLimit.Ban6SetName} {
+		set, err := findSet(conn, table, name)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			continue
+		}
+		elements, err := conn.GetSetElements(set)
+		if err != nil {
+			return nil, firewallError("nftables.ListBans.getElements", "failed to read ban entries", err, apperrors.Metadata{
+				"set": name,
+			})
+		}
+		for _, element := range elements {
+			addr := addrFromKey(element.Key)
+			if !addr.IsValid() {
+				continue
+			}
+			bans = append(bans, Ban{Address: addr, Timeout: element.Timeout, Expires: element.Expires})
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].Expires != bans[j].Expires {
+			return bans[i].Expires > bans[j].Expires
+		}
+		return bans[i].Address.Less(bans[j].Address)
+	})
+	return bans, nil
+}
+
+func banSet(cfg *Config, addr netip.Addr, operation string) (netlinkConn, *nf.Set, error) {
+	cfg = normalizedConfig(cfg)
+	if !addr.IsValid() {
+		return nil, nil, firewallError(operation, "invalid address", nil, nil)
+	}
+	addr = addr.Unmap()
+
+	name := cfg.RateLimit.BanSetName
+	if addr.Is6() {
+		name = cfg.RateLimit.Ban6SetName
+	}
+
+	conn := newConn()
+	table := &nf.Table{Name: cfg.TableName, Family: nf.TableFamilyINet}
+	exists, err := tableExists(conn, cfg.TableName, nf.TableFamilyINet)
+	if err != nil {
+		return nil, nil, err
+	}
+	var set *nf.Set
+	if exists {
+		if set, err = findSet(conn, table, name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if set == nil {
+		return nil, nil, firewallError(operation, "ban set not found; apply the firewall first", nil, apperrors.Metadata{
+			"table": cfg.TableName,
+			"set":   name,
+		})
+	}
+	return conn, set, nil
+}
+
+func normalizedConfig(cfg *Config) *Config {
+	if cfg == nil {
+		return DefaultConfig()
+	}
+	cfg = cfg.clone()
+	cfg.applyDefaults()
+	return cfg
+}
+
+func addrKey(addr netip.Addr) []byte {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		key := addr.As4()
+		return key[:]
+	}
+	key := addr.As16()
+	return key[:]
+}
+
+func addrFromKey(key []byte) netip.Addr {
+	addr, ok := netip.AddrFromSlice(key)
+	if !ok {
+		return netip.Addr{}
+	}
+	return addr
+}
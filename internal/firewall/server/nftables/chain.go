@@ -6,8 +6,19 @@ import (
 	apperrors "GWD/internal/errors"
 )
 
+// baseChainSpec describes a base chain created by ensureBaseChains.
+type baseChainSpec struct {
+	name     string
+	hook     *nf.ChainHook
+	typ      nf.ChainType
+	priority *nf.ChainPriority
+}
+
+// ensureBaseChains creates the filter chains and, when NAT is configured,
+// the nat chains at the dstnat (prerouting) and srcnat (postrouting)
+// priorities. Chains that already exist are left alone.
 func ensureBaseChains(table *nf.Table, cfg *Config) error {
-	conn := &nf.Conn{}
+	conn := newConn()
 
 	chains, err := conn.ListChainsOfTableFamily(table.Family)
 	if err != nil {
@@ -23,18 +34,32 @@ func ensureBaseChains(table *nf.Table, cfg *Config) error {
 		}
 	}
 
-	chainSpecs := []struct {
-		name string
-		hook *nf.ChainHook
-	}{
-		{cfg.InputChainName, nf.ChainHookInput},
-		{cfg.ForwardChainName, nf.ChainHookForward},
-		{cfg.OutputChainName, nf.ChainHookOutput},
+	filterPriority := nf.ChainPriorityRef(nf.ChainPriority(cfg.FilterPriority))
+	chainSpecs := []baseChainSpec{
+		{cfg.InputChainName, nf.ChainHookInput, nf.ChainTypeFilter, filterPriority},
+		{cfg.ForwardChainName, nf.ChainHookForward, nf.ChainTypeFilter, filterPriority},
+		{cfg.OutputChainName, nf.ChainHookOutput, nf.ChainTypeFilter, filterPriority},
+	}
+	natChains := []baseChainSpec{
+		{cfg.NAT.PreroutingChainName, nf.ChainHookPrerouting, nf.ChainTypeNAT, nf.ChainPriorityNATDest},
+		{cfg.NAT.PostroutingChainName, nf.ChainHookPostrouting, nf.ChainTypeNAT, nf.ChainPriorityNATSource},
+	}
+	if cfg.NAT.Enabled() {
+		chainSpecs = append(chainSpecs, natChains...)
+	} else {
+		// Without NAT the nat hooks are removed, so conntrack does not
+		// keep doing NAT lookups for every new flow.
+		for _, spec := range natChains {
+			if _, ok := existing[spec.name]; !ok {
+				continue
+			}
+			chain := &nf.Chain{Name: spec.name, Table: table}
+			conn.FlushChain(chain)
+			conn.DelChain(chain)
+		}
 	}
 
 	policy := nf.ChainPolicyAccept
-	priority := nf.ChainPriority(cfg.FilterPriority)
-	priorityPtr := nf.ChainPriorityRef(priority)
 
 	for _, spec := range chainSpecs {
 		if spec.name == "" {
@@ -48,9 +73,9 @@ func ensureBaseChains(table *nf.Table, cfg *Config) error {
 			Name:     spec.name,
 			Table:    table,
 			Hooknum:  spec.hook,
-			Type:     nf.ChainTypeFilter,
+			Type:     spec.typ,
 			Policy:   &policy,
-			Priority: priorityPtr,
+			Priority: spec.priority,
 		})
 	}
 
@@ -63,8 +88,71 @@ func ensureBaseChains(table *nf.Table, cfg *Config) error {
 	return nil
 }
 
-func programChains(table *nf.Table, cfg *Config, lanSet *nf.Set, flowDevices, inputBypass, forwardBypass []string) error {
-	conn := &nf.Conn{}
+func setInputPolicy(conn netlinkConn, table *nf.Table, cfg *Config) {
+	if cfg.InputChainName == "" {
+		return
+	}
+	policy := nf.ChainPolicyAccept
+	if cfg.InputDefaultDrop {
+		policy = nf.ChainPolicyDrop
+	}
+	conn.AddChain(&nf.Chain{
+		Name:     cfg.InputChainName,
+		Table:    table,
+		Hooknum:  nf.ChainHookInput,
+		Type:     nf.ChainTypeFilter,
+		Policy:   &policy,
+		Priority: nf.ChainPriorityRef(nf.ChainPriority(cfg.FilterPriority)),
+	})
+}
+
+// programInputChain lays out the input chain in evaluation order: bypass
+// interfaces, loopback, bans, established/related, GeoIP rules, ICMP limits
+// and essentials, sanity drops, per-source limits and finally the allowed
+// ports.
+func programInputChain(conn netlinkConn, table *nf.Table, cfg *Config, inputBypass []string, lanSet, lan6Set *nf.Set, rateSets []rateLimitSets, geoSets []geoSets) error {
+	chainName := cfg.InputChainName
+	rateLimit := cfg.RateLimit.Enabled && len(rateSets) > 0
+	bans := len(rateSets) > 0
+
+	if err := ensureBypassRule(conn, table, chainName, cfg.InputBypassSetName, inputBypass); err != nil {
+		return err
+	}
+	if cfg.InputDefaultDrop || bans {
+		addLoopbackAcceptRule(conn, table, chainName)
+	}
+	if bans {
+		addBanDropRules(conn, table, chainName, rateSets)
+	}
+	if cfg.InputDefaultDrop || len(geoSets) > 0 {
+		addEstablishedAcceptRule(conn, table, chainName)
+	}
+	addGeoIPRules(conn, table, chainName, geoSets, lanSet, lan6Set)
+	if rateLimit {
+		addICMPRateLimitRules(conn, table, chainName, cfg.RateLimit)
+	}
+	if cfg.InputDefaultDrop {
+		addEssentialICMPRules(conn, table, chainName)
+	}
+	if err := addSanityRules(conn, table, chainName); err != nil {
+		return err
+	}
+	if rateLimit {
+		addNewConnLimitRules(conn, table, chainName, cfg.RateLimit, rateSets, lanSet, lan6Set)
+	}
+	if cfg.InputDefaultDrop {
+		if err := addInputPortRules(conn, table, chainName, cfg.AllowedTCPPorts, cfg.AllowedUDPPorts); err != nil {
+			return err
+		}
+	}
+	// The policy is set in the same transaction as the rules, so the input
+	// chain never drops by default without its accept rules in place.
+	setInputPolicy(conn, table, cfg)
+	return nil
+}
+
+func programChains(table *nf.Table, cfg *Config, lanSet, lan6Set *nf.Set, rateSets []rateLimitSets, geoSets []geoSets, flowDevices, inputBypass, forwardBypass []string) error {
+	conn := newConn()
 
 	if cfg.InputChainName != "" {
 		conn.FlushChain(&nf.Chain{Name: cfg.InputChainName, Table: table})
@@ -75,14 +163,18 @@ func programChains(table *nf.Table, cfg *Config, lanSet *nf.Set, flowDevices, in
 	if cfg.OutputChainName != "" {
 		conn.FlushChain(&nf.Chain{Name: cfg.OutputChainName, Table: table})
 	}
+	if cfg.NAT.Enabled() {
+		conn.FlushChain(&nf.Chain{Name: cfg.NAT.PreroutingChainName, Table: table})
+		conn.FlushChain(&nf.Chain{Name: cfg.NAT.PostroutingChainName, Table: table})
+	}
 
-	if err := ensureBypassRule(conn, table, cfg.InputChainName, cfg.InputBypassSetName, inputBypass); err != nil {
+	if err := programInputChain(conn, table, cfg, inputBypass, lanSet, lan6Set, rateSets, geoSets); err != nil {
 		return err
 	}
-	if err := addSanityRules(conn, table, cfg.InputChainName); err != nil {
+
+	if err := addMSSClampRule(conn, table, cfg); err != nil {
 		return err
 	}
-
 	if err := ensureBypassRule(conn, table, cfg.ForwardChainName, cfg.ForwardBypassSetName, forwardBypass); err != nil {
 		return err
 	}
@@ -90,10 +182,20 @@ func programChains(table *nf.Table, cfg *Config, lanSet *nf.Set, flowDevices, in
 		return err
 	}
 	if len(flowDevices) > 0 && lanSet != nil && lanSet.ID != 0 {
-		if err := addFlowOffloadRules(conn, table, cfg.ForwardChainName, cfg.FlowtableName, lanSet); err != nil {
+		if err := addFlowOffloadRules(conn, table, cfg.ForwardChainName, cfg.FlowtableName, lanSet, false); err != nil {
+			return err
+		}
+	}
+	if len(flowDevices) > 0 && lan6Set != nil && lan6Set.ID != 0 {
+		if err := addFlowOffloadRules(conn, table, cfg.ForwardChainName, cfg.FlowtableName, lan6Set, true); err != nil {
 			return err
 		}
 	}
+	addForwardDNATAcceptRule(conn, table, cfg)
+
+	if cfg.NAT.Enabled() {
+		programNATChains(conn, table, cfg, lanSet, lan6Set)
+	}
 
 	if err := conn.Flush(); err != nil {
 		return firewallError("nftables.programChains.flush", "failed to program nftables chains", err, apperrors.Metadata{
@@ -1,7 +1,9 @@
 package nftables
 
 import (
+	"bytes"
 	"net"
+	"sort"
 	"strings"
 
 	apperrors "GWD/internal/errors"
@@ -41,6 +43,58 @@ func cidrToElements(cidrs []string) ([]nf.SetElement, error) {
 	return elems, nil
 }
 
+// mergeIntervalElements collapses the start/end pairs produced by
+// cidrToElements so that overlapping or adjacent prefixes form a single
+// interval; the kernel rejects overlapping intervals in one set.
+func mergeIntervalElements(elems []nf.SetElement) []nf.SetElement {
+	type interval struct{ start, end []byte }
+
+	intervals := make([]interval, 0, len(elems)/2)
+	for i := 0; i+1 < len(elems); i += 2 {
+		intervals = append(intervals, interval{start: elems[i].Key, end: elems[i+1].Key})
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return bytes.Compare(intervals[i].start, intervals[j].start) < 0
+	})
+
+	var merged []interval
+	for _, iv := range intervals {
+		if n := len(merged); n > 0 && bytes.Compare(iv.start, merged[n-1].end) <= 0 {
+			if bytes.Compare(iv.end, merged[n-1].end) > 0 {
+				merged[n-1].end = iv.end
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+
+	out := make([]nf.SetElement, 0, len(merged)*2)
+	for _, iv := range merged {
+		out = append(out,
+			nf.SetElement{Key: iv.start},
+			nf.SetElement{Key: iv.end, IntervalEnd: true},
+		)
+	}
+	return out
+}
+
+// splitCIDRsByFamily separates IPv4 and IPv6 prefixes. Entries that do not
+// parse stay with IPv4 so cidrToElements reports them.
+func splitCIDRsByFamily(cidrs []string) (v4, v6 []string) {
+	for _, cidr := range cidrs {
+		trimmed := strings.TrimSpace(cidr)
+		if trimmed == "" {
+			continue
+		}
+		if ip, _, err := net.ParseCIDR(trimmed); err == nil && ip.To4() == nil {
+			v6 = append(v6, trimmed)
+			continue
+		}
+		v4 = append(v4, trimmed)
+	}
+	return v4, v6
+}
+
 func cidrRange(n *net.IPNet) ([]byte, []byte, error) {
 	start := networkIP(n)
 	if start == nil {
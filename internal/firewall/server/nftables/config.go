@@ -2,6 +2,7 @@ package nftables
 
 import (
 	"sort"
+	"time"
 
 	nf "github.com/google/nftables"
 )
@@ -10,14 +11,34 @@ const (
 	defaultTableName        = "gwd"
 	defaultFlowtableName    = "gwd_ft"
 	defaultLanSetName       = "gwd_lan_cidrs"
+	defaultLan6SetName      = "gwd_lan6_cidrs"
 	defaultInputChainName   = "gwd_input"
 	defaultForwardChainName = "gwd_forward"
 	defaultOutputChainName  = "gwd_output"
 	defaultInputBypassSet   = "gwd_input_bypass_ifaces"
+	defaultBanSetName       = "gwd_ban4"
+	defaultBan6SetName      = "gwd_ban6"
+	defaultRateSetName      = "gwd_rate4"
+	defaultRate6SetName     = "gwd_rate6"
+	defaultConnSetName      = "gwd_conn4"
+	defaultConn6SetName     = "gwd_conn6"
+	defaultExemptSetName    = "gwd_exempt4"
+	defaultExempt6SetName   = "gwd_exempt6"
 	defaultForwardBypassSet = "gwd_forward_bypass_ifaces"
+	defaultMSSIfaceSet      = "gwd_mss_ifaces"
+	defaultPreroutingChain  = "gwd_prerouting"
+	defaultPostroutingChain = "gwd_postrouting"
 
 	defaultFilterPriority int32 = -151
 	defaultFlowtablePrio  int32 = -300
+
+	defaultNewConnRate       = 50
+	defaultNewConnBurst      = 100
+	defaultMaxConnsPerSource = 512
+	defaultICMPRate          = 10
+	defaultICMPBurst         = 20
+	defaultBanTimeout        = 10 * time.Minute
+	rateMeterTimeout         = time.Minute
 )
 
 var (
@@ -27,6 +48,11 @@ var (
 		"192.168.0.0/16",
 		"100.64.0.0/10",
 	}
+	// defaultLan6CIDRs cover unique local (ULA) and link-local addresses.
+	defaultLan6CIDRs = []string{
+		"fc00::/7",
+		"fe80::/10",
+	}
 	defaultFlowtableExcludeExact = []string{}
 
 	defaultFlowtableExcludePrefixes = []string{}
@@ -41,6 +67,7 @@ type Config struct {
 	TableName        string
 	FlowtableName    string
 	LanSetName       string
+	Lan6SetName      string
 	InputChainName   string
 	ForwardChainName string
 	OutputChainName  string
@@ -49,7 +76,10 @@ type Config struct {
 	FlowtableHook     *nf.FlowtableHook
 	FlowtablePriority int32
 
-	LanCIDRs []string
+	// LanCIDRs feeds the IPv4 LAN set and LanCIDRs6 the IPv6 one; IPv6
+	// prefixes listed in LanCIDRs are moved to the IPv6 set.
+	LanCIDRs  []string
+	LanCIDRs6 []string
 
 	// Flowtable device management.
 	FlowtableDeviceExplicit        []string // if non-empty, use exactly this list
@@ -62,6 +92,53 @@ type Config struct {
 
 	InputBypassSetName   string
 	ForwardBypassSetName string
+
+	// Input allow-list. With InputDefaultDrop the input chain drops every
+	// packet that is not loopback, established/related, essential ICMP or
+	// addressed to one of the allowed ports.
+	InputDefaultDrop bool
+	AllowedTCPPorts  []uint16
+	AllowedUDPPorts  []uint16
+
+	RateLimit RateLimitConfig
+
+	// GeoIP rules restrict or block input traffic by source country.
+	GeoIP GeoIPConfig
+
+	// MSSClamp clamps the TCP MSS of forwarded connections per output
+	// interface.
+	MSSClamp MSSClampConfig
+
+	// NAT adds masquerading and DNAT port forwards in nat chains.
+	NAT NATConfig
+}
+
+// RateLimitConfig throttles the input chain per source address. Sources
+// opening new connections to TCPPorts or UDPPorts faster than NewConnRate/s
+// (after NewConnBurst) are added to the ban sets for BanTimeout; sources
+// holding more than MaxConnsPerSource connections get new ones dropped. LAN
+// sources and ExemptCIDRs are never metered. ICMP echo requests are limited
+// globally to ICMPRate/s.
+type RateLimitConfig struct {
+	Enabled           bool
+	NewConnRate       uint32
+	NewConnBurst      uint32
+	MaxConnsPerSource uint32
+	ICMPRate          uint32
+	ICMPBurst         uint32
+	BanTimeout        time.Duration
+	TCPPorts          []uint16
+	UDPPorts          []uint16
+	ExemptCIDRs       []string
+
+	BanSetName     string
+	Ban6SetName    string
+	RateSetName    string
+	Rate6SetName   string
+	ConnSetName    string
+	Conn6SetName   string
+	ExemptSetName  string
+	Exempt6SetName string
 }
 
 // DefaultConfig returns a configuration populated with safe defaults.
@@ -70,12 +147,14 @@ func DefaultConfig() *Config {
 		TableName:                      defaultTableName,
 		FlowtableName:                  defaultFlowtableName,
 		LanSetName:                     defaultLanSetName,
+		Lan6SetName:                    defaultLan6SetName,
 		InputChainName:                 defaultInputChainName,
 		ForwardChainName:               defaultForwardChainName,
 		OutputChainName:                defaultOutputChainName,
 		FilterPriority:                 defaultFilterPriority,
 		FlowtablePriority:              defaultFlowtablePrio,
 		LanCIDRs:                       append([]string{}, defaultLanCIDRs...),
+		LanCIDRs6:                      append([]string{}, defaultLan6CIDRs...),
 		FlowtableDeviceExclude:         append([]string{}, defaultFlowtableExcludeExact...),
 		FlowtableDeviceExcludePrefixes: append([]string{}, defaultFlowtableExcludePrefixes...),
 		InputBypassIfaces:              append([]string{}, defaultInputBypassIfaces...),
@@ -85,6 +164,7 @@ func DefaultConfig() *Config {
 	}
 
 	cfg.FlowtableHook = nf.FlowtableHookIngress
+	cfg.RateLimit.applyDefaults()
 	return cfg
 }
 
@@ -95,12 +175,28 @@ func (c *Config) clone() *Config {
 
 	clone := *c
 	clone.LanCIDRs = append([]string{}, c.LanCIDRs...)
+	clone.LanCIDRs6 = append([]string{}, c.LanCIDRs6...)
 	clone.FlowtableDeviceExplicit = append([]string{}, c.FlowtableDeviceExplicit...)
 	clone.FlowtableDeviceInclude = append([]string{}, c.FlowtableDeviceInclude...)
 	clone.FlowtableDeviceExclude = append([]string{}, c.FlowtableDeviceExclude...)
 	clone.FlowtableDeviceExcludePrefixes = append([]string{}, c.FlowtableDeviceExcludePrefixes...)
 	clone.InputBypassIfaces = append([]string{}, c.InputBypassIfaces...)
 	clone.ForwardBypassIfaces = append([]string{}, c.ForwardBypassIfaces...)
+	clone.AllowedTCPPorts = append([]uint16{}, c.AllowedTCPPorts...)
+	clone.AllowedUDPPorts = append([]uint16{}, c.AllowedUDPPorts...)
+	clone.RateLimit.TCPPorts = append([]uint16{}, c.RateLimit.TCPPorts...)
+	clone.RateLimit.UDPPorts = append([]uint16{}, c.RateLimit.UDPPorts...)
+	clone.RateLimit.ExemptCIDRs = append([]string{}, c.RateLimit.ExemptCIDRs...)
+	clone.GeoIP.Rules = make([]GeoIPRule, 0, len(c.GeoIP.Rules))
+	for _, rule := range c.GeoIP.Rules {
+		rule.Countries = append([]string{}, rule.Countries...)
+		rule.TCPPorts = append([]uint16{}, rule.TCPPorts...)
+		rule.UDPPorts = append([]uint16{}, rule.UDPPorts...)
+		clone.GeoIP.Rules = append(clone.GeoIP.Rules, rule)
+	}
+	clone.MSSClamp.Ifaces = append([]string{}, c.MSSClamp.Ifaces...)
+	clone.NAT.MasqueradeIfaces = append([]string{}, c.NAT.MasqueradeIfaces...)
+	clone.NAT.Forwards = append([]PortForward{}, c.NAT.Forwards...)
 	clone.InputBypassSetName = c.InputBypassSetName
 	clone.ForwardBypassSetName = c.ForwardBypassSetName
 	return &clone
@@ -116,6 +212,9 @@ func (c *Config) applyDefaults() {
 	if c.LanSetName == "" {
 		c.LanSetName = defaultLanSetName
 	}
+	if c.Lan6SetName == "" {
+		c.Lan6SetName = defaultLan6SetName
+	}
 	if c.InputChainName == "" {
 		c.InputChainName = defaultInputChainName
 	}
@@ -155,5 +254,70 @@ func (c *Config) applyDefaults() {
 	if len(c.LanCIDRs) == 0 {
 		c.LanCIDRs = append([]string{}, defaultLanCIDRs...)
 	}
+	if len(c.LanCIDRs6) == 0 {
+		c.LanCIDRs6 = append([]string{}, defaultLan6CIDRs...)
+	}
+	v4, v6 := splitCIDRsByFamily(c.LanCIDRs)
+	c.LanCIDRs = v4
+	c.LanCIDRs6 = mergeStringSets(c.LanCIDRs6, v6)
 	sort.Strings(c.LanCIDRs)
+	c.RateLimit.applyDefaults()
+	if c.MSSClamp.SetName == "" {
+		c.MSSClamp.SetName = defaultMSSIfaceSet
+	}
+	if c.NAT.PreroutingChainName == "" {
+		c.NAT.PreroutingChainName = defaultPreroutingChain
+	}
+	if c.NAT.PostroutingChainName == "" {
+		c.NAT.PostroutingChainName = defaultPostroutingChain
+	}
+	c.AllowedTCPPorts = uniquePorts(c.AllowedTCPPorts)
+	c.AllowedUDPPorts = uniquePorts(c.AllowedUDPPorts)
+}
+
+func (r *RateLimitConfig) applyDefaults() {
+	if r.NewConnRate == 0 {
+		r.NewConnRate = defaultNewConnRate
+	}
+	if r.NewConnBurst == 0 {
+		r.NewConnBurst = defaultNewConnBurst
+	}
+	if r.MaxConnsPerSource == 0 {
+		r.MaxConnsPerSource = defaultMaxConnsPerSource
+	}
+	if r.ICMPRate == 0 {
+		r.ICMPRate = defaultICMPRate
+	}
+	if r.ICMPBurst == 0 {
+		r.ICMPBurst = defaultICMPBurst
+	}
+	if r.BanTimeout == 0 {
+		r.BanTimeout = defaultBanTimeout
+	}
+	if r.BanSetName == "" {
+		r.BanSetName = defaultBanSetName
+	}
+	if r.Ban6SetName == "" {
+		r.Ban6SetName = defaultBan6SetName
+	}
+	if r.RateSetName == "" {
+		r.RateSetName = defaultRateSetName
+	}
+	if r.Rate6SetName == "" {
+		r.Rate6SetName = defaultRate6SetName
+	}
+	if r.ConnSetName == "" {
+		r.ConnSetName = defaultConnSetName
+	}
+	if r.Conn6SetName == "" {
+		r.Conn6SetName = defaultConn6SetName
+	}
+	if r.ExemptSetName == "" {
+		r.ExemptSetName = defaultExemptSetName
+	}
+	if r.Exempt6SetName == "" {
+		r.Exempt6SetName = defaultExempt6SetName
+	}
+	r.TCPPorts = uniquePorts(r.TCPPorts)
+	r.UDPPorts = uniquePorts(r.UDPPorts)
 }
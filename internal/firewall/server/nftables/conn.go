@@ -0,0 +1,43 @@
+package nftables
+
+import (
+	nf "github.com/google/nftables"
+)
+
+// netlinkConn is the part of *nftables.Conn this package uses. Add*, Del*
+// and FlushChain only queue messages; Flush sends them to the kernel as one
+// transaction.
+type netlinkConn interface {
+	ListTablesOfFamily(family nf.TableFamily) ([]*nf.Table, error)
+	AddTable(t *nf.Table) *nf.Table
+	DelTable(t *nf.Table)
+
+	ListChainsOfTableFamily(family nf.TableFamily) ([]*nf.Chain, error)
+	AddChain(c *nf.Chain) *nf.Chain
+	DelChain(c *nf.Chain)
+	FlushChain(c *nf.Chain)
+
+	GetSets(t *nf.Table) ([]*nf.Set, error)
+	AddSet(s *nf.Set, vals []nf.SetElement) error
+	DelSet(s *nf.Set)
+	GetSetElements(s *nf.Set) ([]nf.SetElement, error)
+	SetAddElements(s *nf.Set, vals []nf.SetElement) error
+	SetDeleteElements(s *nf.Set, vals []nf.SetElement) error
+
+	ListFlowtables(t *nf.Table) ([]*nf.Flowtable, error)
+	AddFlowtable(f *nf.Flowtable) *nf.Flowtable
+	DelFlowtable(f *nf.Flowtable)
+
+	GetRules(t *nf.Table, c *nf.Chain) ([]*nf.Rule, error)
+	AddRule(r *nf.Rule) *nf.Rule
+
+	Flush() error
+}
+
+var _ netlinkConn = (*nf.Conn)(nil)
+
+// newConn opens the connection every operation works on; tests swap it for
+// an in-memory ruleset.
+var newConn = func() netlinkConn {
+	return &nf.Conn{}
+}
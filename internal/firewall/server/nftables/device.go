@@ -8,6 +8,20 @@ import (
 	apperrors "GWD/internal/errors"
 )
 
+// sysClassNetDir lists the network devices of the host.
+var sysClassNetDir = "/sys/class/net"
+
+// FlowtableDevices returns the devices Ensure would attach to the flowtable
+// right now, so callers can tell when interfaces came or went.
+func FlowtableDevices(cfg *Config) ([]string, error) {
+	cfg = normalizedConfig(cfg)
+	auto, _, err := detectFlowtableDevices(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return selectFlowtableDevices(cfg, auto), nil
+}
+
 func selectFlowtableDevices(cfg *Config, auto []string) []string {
 	if len(cfg.FlowtableDeviceExplicit) > 0 {
 		return uniqueStrings(cfg.FlowtableDeviceExplicit)
@@ -33,10 +47,10 @@ func selectFlowtableDevices(cfg *Config, auto []string) []string {
 }
 
 func detectFlowtableDevices(cfg *Config) ([]string, []string, error) {
-	entries, err := os.ReadDir("/sys/class/net")
+	entries, err := os.ReadDir(sysClassNetDir)
 	if err != nil {
 		return nil, nil, firewallError("nftables.detectFlowtableDevices", "failed to read network devices", err, apperrors.Metadata{
-			"path": "/sys/class/net",
+			"path": sysClassNetDir,
 		})
 	}
 
@@ -86,9 +100,11 @@ func detectFlowtableDevices(cfg *Config) ([]string, []string, error) {
 	return autoList, bypassList, nil
 }
 
+// detectDefaultLanCIDRs returns the configured LAN prefixes of both families,
+// or the IPv4 and IPv6 prefixes of the allowed interfaces when none are set.
 func detectDefaultLanCIDRs(cfg *Config) ([]string, error) {
-	if len(cfg.LanCIDRs) > 0 {
-		return uniqueStrings(cfg.LanCIDRs), nil
+	if len(cfg.LanCIDRs) > 0 || len(cfg.LanCIDRs6) > 0 {
+		return mergeStringSets(cfg.LanCIDRs, cfg.LanCIDRs6), nil
 	}
 
 	ifaces, err := net.Interfaces()
@@ -119,7 +135,7 @@ func detectDefaultLanCIDRs(cfg *Config) ([]string, error) {
 
 		for _, addr := range addrs {
 			ipNet, ok := addr.(*net.IPNet)
-			if !ok || ipNet == nil || ipNet.IP.To4() == nil {
+			if !ok || ipNet == nil {
 				continue
 			}
 			cidrs[ipNet.String()] = struct{}{}
@@ -130,6 +146,9 @@ func detectDefaultLanCIDRs(cfg *Config) ([]string, error) {
 		for _, cidr := range defaultLanCIDRs {
 			cidrs[cidr] = struct{}{}
 		}
+		for _, cidr := range defaultLan6CIDRs {
+			cidrs[cidr] = struct{}{}
+		}
 	}
 
 	result := sortedKeys(cidrs)
@@ -0,0 +1,165 @@
+package nftables
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeDeviceDir returns a directory laid out like /sys/class/net.
+func fakeDeviceDir(t *testing.T, devices ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, device := range devices {
+		if err := os.Mkdir(filepath.Join(dir, device), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSelectFlowtableDevices(t *testing.T) {
+	auto := []string{"eth0", "eth1", "veth12", "wg0"}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{
+			name: "auto detected",
+			want: []string{"eth0", "eth1", "veth12", "wg0"},
+		},
+		{
+			name: "explicit list wins",
+			cfg: Config{
+				FlowtableDeviceExplicit: []string{"wg0", "eth0", "wg0"},
+				FlowtableDeviceExclude:  []string{"eth0"},
+			},
+			want: []string{"eth0", "wg0"},
+		},
+		{
+			name: "include adds devices",
+			cfg:  Config{FlowtableDeviceInclude: []string{"ppp0", ""}},
+			want: []string{"eth0", "eth1", "ppp0", "veth12", "wg0"},
+		},
+		{
+			name: "exclude removes devices",
+			cfg:  Config{FlowtableDeviceExclude: []string{"eth1", "missing"}},
+			want: []string{"eth0", "veth12", "wg0"},
+		},
+		{
+			name: "exclude prefixes apply to included devices",
+			cfg: Config{
+				FlowtableDeviceInclude:         []string{"veth99"},
+				FlowtableDeviceExcludePrefixes: []string{"veth", ""},
+			},
+			want: []string{"eth0", "eth1", "wg0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			got := selectFlowtableDevices(&cfg, auto)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("selectFlowtableDevices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFlowtableDevices(t *testing.T) {
+	devices := []string{"eth0", "lo", "veth1", "wg0", ".hidden"}
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		wantAuto   []string
+		wantBypass []string
+	}{
+		{
+			name:       "every device",
+			wantAuto:   []string{"eth0", "lo", "veth1", "wg0"},
+			wantBypass: []string{},
+		},
+		{
+			name: "excluded devices are bypassed",
+			cfg: Config{
+				FlowtableDeviceExclude:         []string{"wg0", "absent0"},
+				FlowtableDeviceExcludePrefixes: []string{"veth"},
+			},
+			wantAuto:   []string{"eth0", "lo"},
+			wantBypass: []string{"absent0", "veth1", "wg0"},
+		},
+		{
+			name: "included devices are not bypassed",
+			cfg: Config{
+				FlowtableDeviceInclude:         []string{"veth1"},
+				FlowtableDeviceExcludePrefixes: []string{"veth"},
+			},
+			wantAuto:   []string{"eth0", "lo", "veth1", "wg0"},
+			wantBypass: []string{},
+		},
+		{
+			name: "explicit mode only keeps listed devices",
+			cfg: Config{
+				FlowtableDeviceExplicit: []string{"eth0", "wg0"},
+				FlowtableDeviceExclude:  []string{"wg0", "lo"},
+			},
+			wantAuto:   []string{"eth0", "wg0"},
+			wantBypass: []string{"lo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRuleset(t, devices...)
+			cfg := tt.cfg
+			auto, bypass, err := detectFlowtableDevices(&cfg)
+			if err != nil {
+				t.Fatalf("detectFlowtableDevices() error = %v", err)
+			}
+			if !reflect.DeepEqual(auto, tt.wantAuto) {
+				t.Errorf("auto devices = %v, want %v", auto, tt.wantAuto)
+			}
+			if !reflect.DeepEqual(bypass, tt.wantBypass) {
+				t.Errorf("bypass devices = %v, want %v", bypass, tt.wantBypass)
+			}
+		})
+	}
+}
+
+func TestDetectFlowtableDevicesMissingDirectory(t *testing.T) {
+	useFakeRuleset(t)
+	sysClassNetDir = filepath.Join(t.TempDir(), "missing")
+
+	if _, _, err := detectFlowtableDevices(&Config{}); err == nil {
+		t.Fatal("detectFlowtableDevices() succeeded without a device directory")
+	}
+}
+
+func TestFlowtableDevicesFollowsInterfaces(t *testing.T) {
+	useFakeRuleset(t, "eth0", "lo")
+	cfg := &Config{FlowtableDeviceExclude: []string{"lo"}}
+
+	before, err := FlowtableDevices(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eth0"}; !reflect.DeepEqual(before, want) {
+		t.Fatalf("FlowtableDevices() = %v, want %v", before, want)
+	}
+
+	if err := os.Mkdir(filepath.Join(sysClassNetDir, "wg0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	after, err := FlowtableDevices(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eth0", "wg0"}; !reflect.DeepEqual(after, want) {
+		t.Fatalf("FlowtableDevices() after wg0 came up = %v, want %v", after, want)
+	}
+}
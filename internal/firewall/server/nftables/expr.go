@@ -1,14 +1,47 @@
 package nftables
 
 import (
+	"time"
+
 	nf "github.com/google/nftables"
 	"github.com/google/nftables/binaryutil"
 	"github.com/google/nftables/expr"
 	"golang.org/x/sys/unix"
 )
 
+// TCP header flag bits and the MSS option kind.
+const (
+	tcpFlagSYN      = 0x02
+	tcpFlagRST      = 0x04
+	tcpOptionMaxseg = 2
+)
+
+// ctStatusDNAT is IPS_DST_NAT from linux/netfilter/nf_conntrack_common.h.
+const ctStatusDNAT = 1 << 5
+
+// withCounter inserts a counter in front of the final statement (verdict or
+// flow offload), so the counter only sees packets the rule matched.
+func withCounter(exprs []expr.Any) []expr.Any {
+	if len(exprs) == 0 {
+		return exprs
+	}
+	last := len(exprs) - 1
+	out := make([]expr.Any, 0, len(exprs)+1)
+	out = append(out, exprs[:last]...)
+	return append(out, &expr.Counter{}, exprs[last])
+}
+
 func ctStateDropExprs(bit uint32) []expr.Any {
-	mask := binaryutil.NativeEndian.PutUint32(bit)
+	return ctStateVerdictExprs(bit, expr.VerdictDrop)
+}
+
+// ctStateVerdictExprs matches when any of the given ct state bits is set.
+func ctStateVerdictExprs(bits uint32, verdict expr.VerdictKind) []expr.Any {
+	return append(ctStateMatchExprs(bits), &expr.Verdict{Kind: verdict})
+}
+
+func ctStateMatchExprs(bits uint32) []expr.Any {
+	mask := binaryutil.NativeEndian.PutUint32(bits)
 	return []expr.Any{
 		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
 		&expr.Bitwise{
@@ -23,7 +56,210 @@ func ctStateDropExprs(bit uint32) []expr.Any {
 			Register: 1,
 			Data:     zeroBytes(4),
 		},
+	}
+}
+
+func iifnameAcceptExprs(name string) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     encodeInterfaceName(name),
+		},
+		&expr.Verdict{Kind: expr.VerdictAccept},
+	}
+}
+
+// icmpTypeAcceptExprs accepts one ICMP (IPPROTO_ICMP) or ICMPv6
+// (IPPROTO_ICMPV6) message type.
+func icmpTypeAcceptExprs(proto byte, icmpType byte) []expr.Any {
+	return append(protoMatchExprs(proto),
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       0,
+			Len:          1,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{icmpType},
+		},
+		&expr.Verdict{Kind: expr.VerdictAccept},
+	)
+}
+
+// dportAcceptExprs accepts TCP or UDP traffic to a destination port.
+func dportAcceptExprs(proto byte, port uint16) []expr.Any {
+	return append(dportMatchExprs(proto, port), &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+func dportMatchExprs(proto byte, port uint16) []expr.Any {
+	return append(protoMatchExprs(proto),
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     binaryutil.BigEndian.PutUint16(port),
+		},
+	)
+}
+
+// srcAddrLoadExprs matches the address family and loads the source address
+// into register 1.
+func srcAddrLoadExprs(ipv6 bool) []expr.Any {
+	offset, addrLen := uint32(12), uint32(4)
+	if ipv6 {
+		offset, addrLen = 8, 16
+	}
+	return append(nfprotoMatchExprs(ipv6), &expr.Payload{
+		DestRegister: 1,
+		Base:         expr.PayloadBaseNetworkHeader,
+		Offset:       offset,
+		Len:          addrLen,
+	})
+}
+
+// dstAddrLoadExprs loads the destination address into register 1; the
+// address family must already be matched.
+func dstAddrLoadExprs(ipv6 bool) expr.Any {
+	offset, addrLen := uint32(16), uint32(4)
+	if ipv6 {
+		offset, addrLen = 24, 16
+	}
+	return &expr.Payload{
+		DestRegister: 1,
+		Base:         expr.PayloadBaseNetworkHeader,
+		Offset:       offset,
+		Len:          addrLen,
+	}
+}
+
+func nfprotoMatchExprs(ipv6 bool) []expr.Any {
+	nfproto := uint32(unix.NFPROTO_IPV4)
+	if ipv6 {
+		nfproto = unix.NFPROTO_IPV6
+	}
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     binaryutil.NativeEndian.PutUint32(nfproto),
+		},
+	}
+}
+
+// srcAddrInSetDropExprs: ip[6] saddr @set drop.
+func srcAddrInSetDropExprs(set *nf.Set, ipv6 bool) []expr.Any {
+	return append(srcAddrLoadExprs(ipv6),
+		&expr.Lookup{SourceRegister: 1, SetName: set.Name, SetID: set.ID},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+// geoDropExprs: [meta l4proto P th dport N] ip[6] saddr @geo drop, or for
+// allow rules ip[6] saddr != @geo ip[6] saddr != @lan drop so LAN clients
+// keep access. A zero proto matches every port.
+func geoDropExprs(geoSet, lanSet *nf.Set, ipv6, allow bool, proto byte, port uint16) []expr.Any {
+	var exprs []expr.Any
+	if proto != 0 {
+		exprs = append(exprs, dportMatchExprs(proto, port)...)
+	}
+	exprs = append(exprs, srcAddrLoadExprs(ipv6)...)
+	exprs = append(exprs, &expr.Lookup{SourceRegister: 1, SetName: geoSet.Name, SetID: geoSet.ID, Invert: allow})
+	if allow && lanSet != nil {
+		exprs = append(exprs, &expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID, Invert: true})
+	}
+	return append(exprs, &expr.Verdict{Kind: expr.VerdictDrop})
+}
+
+// icmpRateLimitDropExprs: meta l4proto P icmp type T limit rate over R/second
+// burst B packets drop.
+func icmpRateLimitDropExprs(proto, icmpType byte, rate, burst uint32) []expr.Any {
+	return append(protoMatchExprs(proto),
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       0,
+			Len:          1,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{icmpType},
+		},
+		overLimit(rate, burst),
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+// rateLimitMatchExprs: meta l4proto P th dport N ct state new ip[6] saddr
+// != @lan ip[6] saddr != @exempt, leaving the source address in register 1.
+func rateLimitMatchExprs(proto byte, port uint16, ipv6 bool, lanSet, exemptSet *nf.Set) []expr.Any {
+	exprs := dportMatchExprs(proto, port)
+	exprs = append(exprs, ctStateMatchExprs(expr.CtStateBitNEW)...)
+	exprs = append(exprs, srcAddrLoadExprs(ipv6)...)
+	for _, set := range []*nf.Set{lanSet, exemptSet} {
+		if set != nil {
+			exprs = append(exprs, &expr.Lookup{SourceRegister: 1, SetName: set.Name, SetID: set.ID, Invert: true})
+		}
+	}
+	return exprs
+}
+
+// newConnRateBanExprs: <match> update @rate { ip[6] saddr limit rate over
+// R/second burst B packets } add @ban { ip[6] saddr timeout T } drop. The
+// match must leave the source address in register 1.
+func newConnRateBanExprs(match []expr.Any, rateSet, banSet *nf.Set, rate, burst uint32, banTimeout time.Duration) []expr.Any {
+	return append(match,
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   rateSet.Name,
+			SetID:     rateSet.ID,
+			Operation: unix.NFT_DYNSET_OP_UPDATE,
+			Timeout:   rateMeterTimeout,
+			Exprs:     []expr.Any{overLimit(rate, burst)},
+		},
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   banSet.Name,
+			SetID:     banSet.ID,
+			Operation: unix.NFT_DYNSET_OP_ADD,
+			Timeout:   banTimeout,
+		},
 		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+// connCountDropExprs: <match> add @conn { ip[6] saddr ct count over N } drop.
+// The match must leave the source address in register 1.
+func connCountDropExprs(match []expr.Any, connSet *nf.Set, max uint32) []expr.Any {
+	return append(match,
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   connSet.Name,
+			SetID:     connSet.ID,
+			Operation: unix.NFT_DYNSET_OP_ADD,
+			Exprs:     []expr.Any{&expr.Connlimit{Count: max, Flags: expr.NFT_CONNLIMIT_F_INV}},
+		},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+func overLimit(rate, burst uint32) expr.Any {
+	return &expr.Limit{
+		Type:  expr.LimitTypePkts,
+		Rate:  uint64(rate),
+		Over:  true,
+		Unit:  expr.LimitTimeSecond,
+		Burst: burst,
 	}
 }
 
@@ -84,24 +320,37 @@ func tcpFlagMaskDropExprs(mask, expect byte, op expr.CmpOp) []expr.Any {
 	return exprs
 }
 
-func flowOffloadExprs(lanSet *nf.Set, flowtableName string, matchSrc bool) []expr.Any {
+// flowOffloadExprs offloads flows whose source (or destination) address is in
+// lanSet. ipv6 selects the NFPROTO and the address offsets/length of the
+// IPv6 header (src 8, dst 24, 16 bytes) instead of IPv4 (src 12, dst 16, 4 bytes).
+func flowOffloadExprs(lanSet *nf.Set, flowtableName string, matchSrc, ipv6 bool) []expr.Any {
+	nfproto := uint32(unix.NFPROTO_IPV4)
 	offset := uint32(12) // IPv4 source
 	if !matchSrc {
 		offset = 16 // IPv4 destination
 	}
+	addrLen := uint32(4)
+	if ipv6 {
+		nfproto = unix.NFPROTO_IPV6
+		offset = 8 // IPv6 source
+		if !matchSrc {
+			offset = 24 // IPv6 destination
+		}
+		addrLen = 16
+	}
 
 	return []expr.Any{
 		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
 			Register: 1,
-			Data:     binaryutil.NativeEndian.PutUint32(uint32(unix.NFPROTO_IPV4)),
+			Data:     binaryutil.NativeEndian.PutUint32(nfproto),
 		},
 		&expr.Payload{
 			DestRegister: 1,
 			Base:         expr.PayloadBaseNetworkHeader,
 			Offset:       offset,
-			Len:          4,
+			Len:          addrLen,
 		},
 		&expr.Lookup{
 			SourceRegister: 1,
@@ -113,12 +362,16 @@ func flowOffloadExprs(lanSet *nf.Set, flowtableName string, matchSrc bool) []exp
 }
 
 func protoTCPMatchExprs() []expr.Any {
+	return protoMatchExprs(unix.IPPROTO_TCP)
+}
+
+func protoMatchExprs(proto byte) []expr.Any {
 	return []expr.Any{
 		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
 			Register: 1,
-			Data:     binaryutil.NativeEndian.PutUint32(uint32(unix.IPPROTO_TCP)),
+			Data:     binaryutil.NativeEndian.PutUint32(uint32(proto)),
 		},
 	}
 }
@@ -131,3 +384,167 @@ func loadTCPFlags() expr.Any {
 		Len:          1,
 	}
 }
+
+// dnatExprs: [iifname I] fib daddr type local meta l4proto P th dport N
+// dnat ip[6] to A:T.
+func dnatExprs(fwd PortForward, proto byte) []expr.Any {
+	addr := fwd.Address.Unmap()
+	ipv6 := addr.Is6()
+	target := fwd.TargetPort
+	if target == 0 {
+		target = fwd.Port
+	}
+
+	exprs := nfprotoMatchExprs(ipv6)
+	if fwd.InIface != "" {
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     encodeInterfaceName(fwd.InIface),
+			},
+		)
+	}
+	exprs = append(exprs,
+		&expr.Fib{Register: 1, FlagDADDR: true, ResultADDRTYPE: true},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     binaryutil.NativeEndian.PutUint32(unix.RTN_LOCAL),
+		},
+	)
+	exprs = append(exprs, dportMatchExprs(proto, fwd.Port)...)
+
+	family := uint32(unix.NFPROTO_IPV4)
+	if ipv6 {
+		family = unix.NFPROTO_IPV6
+	}
+	return append(exprs,
+		&expr.Immediate{Register: 1, Data: addr.AsSlice()},
+		&expr.Immediate{Register: 2, Data: binaryutil.BigEndian.PutUint16(target)},
+		&expr.NAT{
+			Type:        expr.NATTypeDestNAT,
+			Family:      family,
+			RegAddrMin:  1,
+			RegProtoMin: 2,
+			Specified:   true,
+		},
+	)
+}
+
+// lanMasqueradeExprs: ip[6] saddr @lan ip[6] daddr != @lan masquerade.
+func lanMasqueradeExprs(lanSet *nf.Set, ipv6 bool) []expr.Any {
+	return append(srcAddrLoadExprs(ipv6),
+		&expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID},
+		dstAddrLoadExprs(ipv6),
+		&expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID, Invert: true},
+		&expr.Masq{},
+	)
+}
+
+// ifaceMasqueradeExprs: meta nfproto F iifname I ip[6] daddr != @lan masquerade.
+func ifaceMasqueradeExprs(iface string, lanSet *nf.Set, ipv6 bool) []expr.Any {
+	return append(nfprotoMatchExprs(ipv6),
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     encodeInterfaceName(iface),
+		},
+		dstAddrLoadExprs(ipv6),
+		&expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID, Invert: true},
+		&expr.Masq{},
+	)
+}
+
+// hairpinMasqueradeExprs: ct status dnat ip[6] saddr @lan ip[6] daddr @lan
+// masquerade.
+func hairpinMasqueradeExprs(lanSet *nf.Set, ipv6 bool) []expr.Any {
+	exprs := append(ctStatusDNATMatchExprs(), srcAddrLoadExprs(ipv6)...)
+	return append(exprs,
+		&expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID},
+		dstAddrLoadExprs(ipv6),
+		&expr.Lookup{SourceRegister: 1, SetName: lanSet.Name, SetID: lanSet.ID},
+		&expr.Masq{},
+	)
+}
+
+// ctStatusDNATAcceptExprs: ct status dnat accept.
+func ctStatusDNATAcceptExprs() []expr.Any {
+	return append(ctStatusDNATMatchExprs(), &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+func ctStatusDNATMatchExprs() []expr.Any {
+	return []expr.Any{
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATUS},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(ctStatusDNAT),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     zeroBytes(4),
+		},
+	}
+}
+
+// mssClampExprs: oifname @set tcp flags & (syn|rst) == syn tcp option
+// maxseg size set rt mtu, or with a fixed value: ... tcp option maxseg size
+// > N tcp option maxseg size set N.
+func mssClampExprs(ifaceSet *nf.Set, mss uint16) []expr.Any {
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Lookup{SourceRegister: 1, SetName: ifaceSet.Name, SetID: ifaceSet.ID},
+	}
+	exprs = append(exprs, protoTCPMatchExprs()...)
+	exprs = append(exprs,
+		loadTCPFlags(),
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            1,
+			Mask:           []byte{tcpFlagSYN | tcpFlagRST},
+			Xor:            []byte{0x00},
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{tcpFlagSYN},
+		},
+	)
+
+	if mss == 0 {
+		return append(exprs,
+			&expr.Rt{Register: 1, Key: expr.RtTCPMSS},
+			tcpMaxsegExthdr(0, 1),
+		)
+	}
+	value := binaryutil.BigEndian.PutUint16(mss)
+	return append(exprs,
+		tcpMaxsegExthdr(1, 0),
+		&expr.Cmp{
+			Op:       expr.CmpOpGt,
+			Register: 1,
+			Data:     value,
+		},
+		&expr.Immediate{Register: 1, Data: value},
+		tcpMaxsegExthdr(0, 1),
+	)
+}
+
+// tcpMaxsegExthdr loads the TCP MSS option into dest, or writes it from src.
+func tcpMaxsegExthdr(dest, src uint32) *expr.Exthdr {
+	return &expr.Exthdr{
+		DestRegister:   dest,
+		SourceRegister: src,
+		Op:             expr.ExthdrOpTcpopt,
+		Type:           tcpOptionMaxseg,
+		Offset:         2,
+		Len:            2,
+	}
+}
@@ -0,0 +1,616 @@
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	nf "github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// fakeRuleset is the kernel state behind fakeConn. It keeps what the
+// package programmed, plus a few counters the tests assert on.
+type fakeRuleset struct {
+	tables     map[string]*fakeTable
+	nextHandle uint64
+	nextSetID  uint32
+
+	// flushes counts transactions that carried at least one message;
+	// elementWrites counts set elements added or deleted.
+	flushes       int
+	elementWrites int
+
+	// failFlush, when set, is consulted before each transaction is applied.
+	failFlush func(flush int) error
+}
+
+type fakeTable struct {
+	table      nf.Table
+	chains     map[string]*fakeChain
+	sets       map[string]*fakeSet
+	flowtables map[string]*nf.Flowtable
+}
+
+type fakeChain struct {
+	chain nf.Chain
+	rules []*nf.Rule
+}
+
+type fakeSet struct {
+	set      nf.Set
+	elements []nf.SetElement
+}
+
+// fakeConn is an in-memory netlinkConn. Changes are queued and applied by
+// Flush to a copy of the ruleset that only replaces it when every message
+// succeeded, like a kernel transaction. It fails where the kernel does for
+// the cases this package depends on: unknown tables, chains, sets and
+// flowtables, rules referring to missing objects, and deleting objects that
+// rules still use.
+type fakeConn struct {
+	rs      *fakeRuleset
+	pending []func(*fakeRuleset) error
+}
+
+var _ netlinkConn = (*fakeConn)(nil)
+
+// useFakeRuleset points newConn at a fresh in-memory ruleset and a temporary
+// device directory holding devices, restoring both when the test ends.
+func useFakeRuleset(t *testing.T, devices ...string) *fakeRuleset {
+	t.Helper()
+
+	rs := &fakeRuleset{tables: make(map[string]*fakeTable)}
+	previousConn, previousDir := newConn, sysClassNetDir
+	newConn = func() netlinkConn { return &fakeConn{rs: rs} }
+	sysClassNetDir = fakeDeviceDir(t, devices...)
+	t.Cleanup(func() {
+		newConn, sysClassNetDir = previousConn, previousDir
+	})
+	return rs
+}
+
+func errNotFound(kind, name string) error {
+	return fmt.Errorf("%s %q: %w", kind, name, unix.ENOENT)
+}
+
+func errBusy(kind, name string) error {
+	return fmt.Errorf("%s %q: %w", kind, name, unix.EBUSY)
+}
+
+func tableKey(t *nf.Table) string {
+	return fmt.Sprintf("%d/%s", t.Family, t.Name)
+}
+
+func (rs *fakeRuleset) table(t *nf.Table) (*fakeTable, error) {
+	if t == nil {
+		return nil, errNotFound("table", "")
+	}
+	table, ok := rs.tables[tableKey(t)]
+	if !ok {
+		return nil, errNotFound("table", t.Name)
+	}
+	return table, nil
+}
+
+func (rs *fakeRuleset) chain(c *nf.Chain) (*fakeTable, *fakeChain, error) {
+	table, err := rs.table(c.Table)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, ok := table.chains[c.Name]
+	if !ok {
+		return nil, nil, errNotFound("chain", c.Name)
+	}
+	return table, chain, nil
+}
+
+func (rs *fakeRuleset) set(s *nf.Set) (*fakeSet, error) {
+	table, err := rs.table(s.Table)
+	if err != nil {
+		return nil, err
+	}
+	set, ok := table.sets[s.Name]
+	if !ok {
+		return nil, errNotFound("set", s.Name)
+	}
+	return set, nil
+}
+
+func (rs *fakeRuleset) clone() *fakeRuleset {
+	out := *rs
+	out.tables = make(map[string]*fakeTable, len(rs.tables))
+	for key, table := range rs.tables {
+		copied := &fakeTable{
+			table:      table.table,
+			chains:     make(map[string]*fakeChain, len(table.chains)),
+			sets:       make(map[string]*fakeSet, len(table.sets)),
+			flowtables: make(map[string]*nf.Flowtable, len(table.flowtables)),
+		}
+		for name, chain := range table.chains {
+			copied.chains[name] = &fakeChain{chain: chain.chain, rules: append([]*nf.Rule{}, chain.rules...)}
+		}
+		for name, set := range table.sets {
+			copied.sets[name] = &fakeSet{set: set.set, elements: append([]nf.SetElement{}, set.elements...)}
+		}
+		for name, ft := range table.flowtables {
+			ftCopy := *ft
+			ftCopy.Devices = append([]string{}, ft.Devices...)
+			copied.flowtables[name] = &ftCopy
+		}
+		out.tables[key] = copied
+	}
+	return &out
+}
+
+// references reports whether a rule of table uses the named set, flowtable
+// or chain.
+func (t *fakeTable) references(match func(expr.Any) bool) bool {
+	for _, chain := range t.chains {
+		for _, rule := range chain.rules {
+			for _, e := range rule.Exprs {
+				if match(e) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (c *fakeConn) queue(op func(*fakeRuleset) error) {
+	c.pending = append(c.pending, op)
+}
+
+func (c *fakeConn) Flush() error {
+	pending := c.pending
+	c.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+
+	c.rs.flushes++
+	if c.rs.failFlush != nil {
+		if err := c.rs.failFlush(c.rs.flushes); err != nil {
+			return err
+		}
+	}
+	work := c.rs.clone()
+	for _, op := range pending {
+		if err := op(work); err != nil {
+			return err
+		}
+	}
+	*c.rs = *work
+	return nil
+}
+
+func (c *fakeConn) ListTablesOfFamily(family nf.TableFamily) ([]*nf.Table, error) {
+	var tables []*nf.Table
+	for _, table := range c.rs.tables {
+		if table.table.Family == family {
+			copied := table.table
+			tables = append(tables, &copied)
+		}
+	}
+	return tables, nil
+}
+
+func (c *fakeConn) AddTable(t *nf.Table) *nf.Table {
+	copied := nf.Table{Name: t.Name, Family: t.Family}
+	c.queue(func(rs *fakeRuleset) error {
+		if _, ok := rs.tables[tableKey(&copied)]; !ok {
+			rs.tables[tableKey(&copied)] = &fakeTable{
+				table:      copied,
+				chains:     make(map[string]*fakeChain),
+				sets:       make(map[string]*fakeSet),
+				flowtables: make(map[string]*nf.Flowtable),
+			}
+		}
+		return nil
+	})
+	return t
+}
+
+func (c *fakeConn) DelTable(t *nf.Table) {
+	copied := nf.Table{Name: t.Name, Family: t.Family}
+	c.queue(func(rs *fakeRuleset) error {
+		if _, err := rs.table(&copied); err != nil {
+			return err
+		}
+		delete(rs.tables, tableKey(&copied))
+		return nil
+	})
+}
+
+func (c *fakeConn) ListChainsOfTableFamily(family nf.TableFamily) ([]*nf.Chain, error) {
+	var chains []*nf.Chain
+	for _, table := range c.rs.tables {
+		if table.table.Family != family {
+			continue
+		}
+		for _, chain := range table.chains {
+			copied := chain.chain
+			tableCopy := table.table
+			copied.Table = &tableCopy
+			chains = append(chains, &copied)
+		}
+	}
+	return chains, nil
+}
+
+func (c *fakeConn) AddChain(ch *nf.Chain) *nf.Chain {
+	copied := *ch
+	c.queue(func(rs *fakeRuleset) error {
+		table, err := rs.table(copied.Table)
+		if err != nil {
+			return err
+		}
+		if existing, ok := table.chains[copied.Name]; ok {
+			// Re-adding a base chain may only change its policy.
+			if copied.Policy != nil {
+				existing.chain.Policy = copied.Policy
+			}
+			return nil
+		}
+		copied.Table = nil
+		table.chains[copied.Name] = &fakeChain{chain: copied}
+		return nil
+	})
+	return ch
+}
+
+func (c *fakeConn) DelChain(ch *nf.Chain) {
+	copied := *ch
+	c.queue(func(rs *fakeRuleset) error {
+		table, chain, err := rs.chain(&copied)
+		if err != nil {
+			return err
+		}
+		if len(chain.rules) > 0 {
+			return errBusy("chain", copied.Name)
+		}
+		if table.references(func(e expr.Any) bool {
+			v, ok := e.(*expr.Verdict)
+			return ok && v.Chain == copied.Name
+		}) {
+			return errBusy("chain", copied.Name)
+		}
+		delete(table.chains, copied.Name)
+		return nil
+	})
+}
+
+func (c *fakeConn) FlushChain(ch *nf.Chain) {
+	copied := *ch
+	c.queue(func(rs *fakeRuleset) error {
+		_, chain, err := rs.chain(&copied)
+		if err != nil {
+			return err
+		}
+		chain.rules = nil
+		return nil
+	})
+}
+
+func (c *fakeConn) GetSets(t *nf.Table) ([]*nf.Set, error) {
+	table, err := c.rs.table(t)
+	if err != nil {
+		return nil, err
+	}
+	var sets []*nf.Set
+	for _, set := range table.sets {
+		copied := set.set
+		// The kernel does not report the transaction ID a set was
+		// created with.
+		copied.ID = 0
+		copied.Table = &nf.Table{Name: table.table.Name, Family: table.table.Family}
+		sets = append(sets, &copied)
+	}
+	return sets, nil
+}
+
+func (c *fakeConn) AddSet(s *nf.Set, vals []nf.SetElement) error {
+	if s.ID == 0 {
+		c.rs.nextSetID++
+		s.ID = c.rs.nextSetID
+	}
+	copied := *s
+	elements := append([]nf.SetElement{}, vals...)
+	c.queue(func(rs *fakeRuleset) error {
+		table, err := rs.table(copied.Table)
+		if err != nil {
+			return err
+		}
+		if _, ok := table.sets[copied.Name]; !ok {
+			copied.Table = nil
+			table.sets[copied.Name] = &fakeSet{set: copied}
+		}
+		return addFakeElements(rs, table.sets[copied.Name], elements)
+	})
+	return nil
+}
+
+func (c *fakeConn) DelSet(s *nf.Set) {
+	copied := *s
+	c.queue(func(rs *fakeRuleset) error {
+		table, err := rs.table(copied.Table)
+		if err != nil {
+			return err
+		}
+		if _, ok := table.sets[copied.Name]; !ok {
+			return errNotFound("set", copied.Name)
+		}
+		if table.references(func(e expr.Any) bool { return exprSetName(e) == copied.Name }) {
+			return errBusy("set", copied.Name)
+		}
+		delete(table.sets, copied.Name)
+		return nil
+	})
+}
+
+func (c *fakeConn) GetSetElements(s *nf.Set) ([]nf.SetElement, error) {
+	set, err := c.rs.set(s)
+	if err != nil {
+		return nil, err
+	}
+	return append([]nf.SetElement{}, set.elements...), nil
+}
+
+func (c *fakeConn) SetAddElements(s *nf.Set, vals []nf.SetElement) error {
+	copied := *s
+	elements := append([]nf.SetElement{}, vals...)
+	c.queue(func(rs *fakeRuleset) error {
+		set, err := rs.set(&copied)
+		if err != nil {
+			return err
+		}
+		return addFakeElements(rs, set, elements)
+	})
+	return nil
+}
+
+func (c *fakeConn) SetDeleteElements(s *nf.Set, vals []nf.SetElement) error {
+	copied := *s
+	elements := append([]nf.SetElement{}, vals...)
+	c.queue(func(rs *fakeRuleset) error {
+		set, err := rs.set(&copied)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			idx := findFakeElement(set.elements, element)
+			if idx < 0 {
+				return errNotFound("element", fmt.Sprintf("%x", element.Key))
+			}
+			set.elements = append(set.elements[:idx], set.elements[idx+1:]...)
+			rs.elementWrites++
+		}
+		return nil
+	})
+	return nil
+}
+
+// addFakeElements adds elements that are not present yet; like an add
+// without NLM_F_EXCL, existing ones are left untouched. Timeout elements
+// start with their full lifetime left.
+func addFakeElements(rs *fakeRuleset, set *fakeSet, elements []nf.SetElement) error {
+	for _, element := range elements {
+		if findFakeElement(set.elements, element) >= 0 {
+			continue
+		}
+		if element.Timeout == 0 && set.set.HasTimeout {
+			element.Timeout = set.set.Timeout
+		}
+		if element.Expires == 0 {
+			element.Expires = element.Timeout
+		}
+		set.elements = append(set.elements, element)
+		rs.elementWrites++
+	}
+	return nil
+}
+
+func findFakeElement(elements []nf.SetElement, want nf.SetElement) int {
+	for idx, element := range elements {
+		if bytes.Equal(element.Key, want.Key) && element.IntervalEnd == want.IntervalEnd {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (c *fakeConn) ListFlowtables(t *nf.Table) ([]*nf.Flowtable, error) {
+	table, err := c.rs.table(t)
+	if err != nil {
+		return nil, err
+	}
+	var flowtables []*nf.Flowtable
+	for _, ft := range table.flowtables {
+		copied := *ft
+		copied.Devices = append([]string{}, ft.Devices...)
+		copied.Table = &nf.Table{Name: table.table.Name, Family: table.table.Family}
+		flowtables = append(flowtables, &copied)
+	}
+	return flowtables, nil
+}
+
+func (c *fakeConn) AddFlowtable(f *nf.Flowtable) *nf.Flowtable {
+	copied := *f
+	copied.Devices = append([]string{}, f.Devices...)
+	c.queue(func(rs *fakeRuleset) error {
+		table, err := rs.table(copied.Table)
+		if err != nil {
+			return err
+		}
+		if existing, ok := table.flowtables[copied.Name]; ok {
+			// Updating an existing flowtable can only add devices.
+			existing.Devices = mergeStringSets(existing.Devices, copied.Devices)
+			return nil
+		}
+		copied.Table = nil
+		table.flowtables[copied.Name] = &copied
+		return nil
+	})
+	return f
+}
+
+func (c *fakeConn) DelFlowtable(f *nf.Flowtable) {
+	copied := *f
+	c.queue(func(rs *fakeRuleset) error {
+		table, err := rs.table(copied.Table)
+		if err != nil {
+			return err
+		}
+		if _, ok := table.flowtables[copied.Name]; !ok {
+			return errNotFound("flowtable", copied.Name)
+		}
+		if table.references(func(e expr.Any) bool {
+			offload, ok := e.(*expr.FlowOffload)
+			return ok && offload.Name == copied.Name
+		}) {
+			return errBusy("flowtable", copied.Name)
+		}
+		delete(table.flowtables, copied.Name)
+		return nil
+	})
+}
+
+func (c *fakeConn) GetRules(t *nf.Table, ch *nf.Chain) ([]*nf.Rule, error) {
+	_, chain, err := c.rs.chain(&nf.Chain{Name: ch.Name, Table: t})
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*nf.Rule, 0, len(chain.rules))
+	for _, rule := range chain.rules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	return rules, nil
+}
+
+func (c *fakeConn) AddRule(r *nf.Rule) *nf.Rule {
+	copied := *r
+	c.queue(func(rs *fakeRuleset) error {
+		table, chain, err := rs.chain(&nf.Chain{Name: copied.Chain.Name, Table: copied.Table})
+		if err != nil {
+			return err
+		}
+		for _, e := range copied.Exprs {
+			if name := exprSetName(e); name != "" {
+				if _, ok := table.sets[name]; !ok {
+					return errNotFound("set", name)
+				}
+			}
+			switch e := e.(type) {
+			case *expr.FlowOffload:
+				if _, ok := table.flowtables[e.Name]; !ok {
+					return errNotFound("flowtable", e.Name)
+				}
+			case *expr.Verdict:
+				if e.Chain != "" {
+					if _, ok := table.chains[e.Chain]; !ok {
+						return errNotFound("chain", e.Chain)
+					}
+				}
+			}
+		}
+		rs.nextHandle++
+		copied.Handle = rs.nextHandle
+		chain.rules = append(chain.rules, &copied)
+		return nil
+	})
+	return r
+}
+
+// exprSetName returns the set a lookup or dynset expression refers to.
+func exprSetName(e expr.Any) string {
+	switch e := e.(type) {
+	case *expr.Lookup:
+		return e.SetName
+	case *expr.Dynset:
+		return e.SetName
+	}
+	return ""
+}
+
+// chainRules renders the rules of a chain in evaluation order.
+func (rs *fakeRuleset) chainRules(t *testing.T, chain string) []string {
+	t.Helper()
+	table, ok := rs.tables[tableKey(&nf.Table{Name: defaultTableName, Family: nf.TableFamilyINet})]
+	if !ok {
+		t.Fatalf("table %s not found", defaultTableName)
+	}
+	ch, ok := table.chains[chain]
+	if !ok {
+		t.Fatalf("chain %s not found", chain)
+	}
+	rules := make([]string, 0, len(ch.rules))
+	for _, rule := range ch.rules {
+		rules = append(rules, renderRule(rule.Exprs))
+	}
+	return rules
+}
+
+// dump renders the whole ruleset in a stable order, without rule handles,
+// so two states can be compared as text.
+func (rs *fakeRuleset) dump() string {
+	var b strings.Builder
+	keys := make([]string, 0, len(rs.tables))
+	for key := range rs.tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		table := rs.tables[key]
+		fmt.Fprintf(&b, "table %s\n", table.table.Name)
+
+		for _, name := range sortedMapKeys(table.flowtables) {
+			ft := table.flowtables[name]
+			devices := append([]string{}, ft.Devices...)
+			sort.Strings(devices)
+			fmt.Fprintf(&b, "  flowtable %s devices %s\n", name, strings.Join(devices, ","))
+		}
+		for _, name := range sortedMapKeys(table.sets) {
+			set := table.sets[name]
+			var elements []string
+			if set.set.Interval {
+				elements = renderIntervals(append([]nf.SetElement{}, set.elements...))
+			} else {
+				for _, element := range set.elements {
+					elements = append(elements, renderElement(set.set.KeyType, element))
+				}
+				sort.Strings(elements)
+			}
+			fmt.Fprintf(&b, "  set %s { %s }\n", name, strings.Join(elements, ", "))
+		}
+		for _, name := range sortedMapKeys(table.chains) {
+			chain := table.chains[name]
+			policy := ""
+			if chain.chain.Policy != nil {
+				policy = " policy accept"
+				if *chain.chain.Policy == nf.ChainPolicyDrop {
+					policy = " policy drop"
+				}
+			}
+			fmt.Fprintf(&b, "  chain %s (%s %s%s)\n", name, chain.chain.Type, chainHookName(chain.chain.Hooknum), policy)
+			for _, rule := range chain.rules {
+				fmt.Fprintf(&b, "    %s\n", renderRule(rule.Exprs))
+			}
+		}
+	}
+	return b.String()
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
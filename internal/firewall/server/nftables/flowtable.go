@@ -7,7 +7,7 @@ import (
 )
 
 func ensureFlowtable(table *nf.Table, cfg *Config, devices []string) error {
-	conn := &nf.Conn{}
+	conn := newConn()
 
 	existing, err := findFlowtable(conn, table, cfg.FlowtableName)
 	if err != nil {
@@ -53,7 +53,7 @@ func ensureFlowtable(table *nf.Table, cfg *Config, devices []string) error {
 	return nil
 }
 
-func findFlowtable(conn *nf.Conn, table *nf.Table, name string) (*nf.Flowtable, error) {
+func findFlowtable(conn netlinkConn, table *nf.Table, name string) (*nf.Flowtable, error) {
 	flowtables, err := conn.ListFlowtables(table)
 	if err != nil {
 		return nil, firewallError("nftables.findFlowtable", "failed to list flowtables", err, apperrors.Metadata{
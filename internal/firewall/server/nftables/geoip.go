@@ -0,0 +1,288 @@
+package nftables
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+	"golang.org/x/sys/unix"
+)
+
+// GeoIP rule actions.
+const (
+	// GeoIPAllow drops traffic to the rule ports unless the source is in one
+	// of the countries (or the LAN sets).
+	GeoIPAllow = "allow"
+	// GeoIPDeny drops traffic from the countries, to the rule ports or to
+	// every port when none are listed.
+	GeoIPDeny = "deny"
+
+	geoSetPrefix = "gwd_geo_"
+)
+
+var geoRuleNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,16}$`)
+
+// GeoIPConfig attaches country based rules to the input chain. Database is
+// read by LoadCountryCIDRs.
+type GeoIPConfig struct {
+	Database string
+	Rules    []GeoIPRule
+}
+
+// GeoIPRule matches the sources of Countries against a port group. Its
+// addresses live in the interval sets gwd_geo_<Name>4 and gwd_geo_<Name>6.
+type GeoIPRule struct {
+	Name      string
+	Action    string
+	Countries []string
+	TCPPorts  []uint16
+	UDPPorts  []uint16
+}
+
+// geoSets holds the sets of one rule.
+type geoSets struct {
+	rule       GeoIPRule
+	set4, set6 *nf.Set
+}
+
+// Validate checks rule names, actions, countries and port groups.
+func (g GeoIPConfig) Validate() error {
+	if len(g.Rules) == 0 {
+		return nil
+	}
+	if g.Database == "" {
+		return firewallError("nftables.GeoIPConfig.Validate", "GeoIP rules require a database", nil, nil)
+	}
+	seen := make(map[string]struct{}, len(g.Rules))
+	for _, rule := range g.Rules {
+		metadata := apperrors.Metadata{"rule": rule.Name}
+		if !geoRuleNamePattern.MatchString(rule.Name) {
+			return firewallError("nftables.GeoIPConfig.Validate", "GeoIP rule name must be 1-16 characters of a-z, 0-9 or _", nil, metadata)
+		}
+		if _, dup := seen[rule.Name]; dup {
+			return firewallError("nftables.GeoIPConfig.Validate", "duplicate GeoIP rule name", nil, metadata)
+		}
+		seen[rule.Name] = struct{}{}
+
+		switch rule.Action {
+		case GeoIPDeny:
+		case GeoIPAllow:
+			if len(rule.TCPPorts) == 0 && len(rule.UDPPorts) == 0 {
+				return firewallError("nftables.GeoIPConfig.Validate", "GeoIP allow rules need at least one port", nil, metadata)
+			}
+		default:
+			return firewallError("nftables.GeoIPConfig.Validate", `GeoIP rule action must be "allow" or "deny"`, nil, metadata)
+		}
+
+		if len(rule.Countries) == 0 {
+			return firewallError("nftables.GeoIPConfig.Validate", "GeoIP rule needs at least one country", nil, metadata)
+		}
+		for _, country := range rule.Countries {
+			if len(strings.TrimSpace(country)) != 2 {
+				return firewallError("nftables.GeoIPConfig.Validate", "GeoIP country must be a two-letter ISO code", nil, apperrors.Metadata{
+					"rule":    rule.Name,
+					"country": country,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// RefreshGeoIP reloads the GeoIP database into the sets of an applied
+// firewall without touching the chains, so it is safe to run periodically.
+func RefreshGeoIP(cfg *Config) error {
+	cfg = normalizedConfig(cfg)
+	if len(cfg.GeoIP.Rules) == 0 {
+		return nil
+	}
+	table := &nf.Table{Name: cfg.TableName, Family: nf.TableFamilyINet}
+
+	exists, err := tableExists(newConn(), cfg.TableName, nf.TableFamilyINet)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return firewallError("nftables.RefreshGeoIP", "firewall table not found; apply the firewall first", nil, apperrors.Metadata{
+			"table": cfg.TableName,
+		})
+	}
+
+	conn := newConn()
+	for _, rule := range cfg.GeoIP.Rules {
+		for _, name := range []string{geoSetName(rule.Name, false), geoSetName(rule.Name, true)} {
+			set, err := findSet(conn, table, name)
+			if err != nil {
+				return err
+			}
+			if set == nil {
+				return firewallError("nftables.RefreshGeoIP", "GeoIP set not found; apply the firewall first", nil, apperrors.Metadata{
+					"set": name,
+				})
+			}
+		}
+	}
+
+	_, err = ensureGeoIPSets(table, cfg)
+	return err
+}
+
+// ensureGeoIPSets loads the database once and syncs the IPv4 and IPv6 set of
+// every rule.
+func ensureGeoIPSets(table *nf.Table, cfg *Config) ([]geoSets, error) {
+	if len(cfg.GeoIP.Rules) == 0 {
+		return nil, nil
+	}
+	if err := cfg.GeoIP.Validate(); err != nil {
+		return nil, err
+	}
+
+	var countries []string
+	for _, rule := range cfg.GeoIP.Rules {
+		countries = append(countries, rule.Countries...)
+	}
+	byCountry, err := LoadCountryCIDRs(cfg.GeoIP.Database, uniqueStrings(countries))
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newConn()
+	result := make([]geoSets, 0, len(cfg.GeoIP.Rules))
+	for _, rule := range cfg.GeoIP.Rules {
+		var cidrs []string
+		for _, country := range rule.Countries {
+			cidrs = append(cidrs, byCountry[strings.ToUpper(strings.TrimSpace(country))]...)
+		}
+		v4, v6 := splitCIDRsByFamily(cidrs)
+
+		sets := geoSets{rule: rule}
+		for _, family := range []struct {
+			cidrs   []string
+			keyType nf.SetDatatype
+			ipv6    bool
+			target  **nf.Set
+		}{
+			{v4, nf.TypeIPAddr, false, &sets.set4},
+			{v6, nf.TypeIP6Addr, true, &sets.set6},
+		} {
+			cidrs := family.cidrs
+			set, err := ensureSet(conn, table, setEnsureOptions{
+				Name:           geoSetName(rule.Name, family.ipv6),
+				KeyType:        family.keyType,
+				Interval:       true,
+				Operation:      "nftables.ensureGeoIPSets",
+				Entity:         "country CIDRs",
+				SetDescription: fmt.Sprintf("GeoIP set for rule %s", rule.Name),
+			}, func() ([]nf.SetElement, error) {
+				elems, err := cidrToElements(cidrs)
+				if err != nil {
+					return nil, err
+				}
+				return mergeIntervalElements(elems), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			*family.target = set
+		}
+		result = append(result, sets)
+	}
+	return result, nil
+}
+
+// addGeoIPRules drops traffic according to each rule; deny rules come first
+// so a region block wins over a port allow-list.
+func addGeoIPRules(conn netlinkConn, table *nf.Table, chainName string, rules []geoSets, lanSet, lan6Set *nf.Set) {
+	if chainName == "" {
+		return
+	}
+	chain := &nf.Chain{Name: chainName, Table: table}
+
+	for _, action := range []string{GeoIPDeny, GeoIPAllow} {
+		for _, sets := range rules {
+			if sets.rule.Action != action {
+				continue
+			}
+			allow := action == GeoIPAllow
+			for _, family := range []struct {
+				set, lan *nf.Set
+				ipv6     bool
+			}{
+				{sets.set4, lanSet, false},
+				{sets.set6, lan6Set, true},
+			} {
+				if len(sets.rule.TCPPorts) == 0 && len(sets.rule.UDPPorts) == 0 {
+					conn.AddRule(&nf.Rule{
+						Table: table,
+						Chain: chain,
+						Exprs: withCounter(geoDropExprs(family.set, family.lan, family.ipv6, allow, 0, 0)),
+					})
+					continue
+				}
+				for _, group := range []struct {
+					proto byte
+					ports []uint16
+				}{
+					{unix.IPPROTO_TCP, sets.rule.TCPPorts},
+					{unix.IPPROTO_UDP, sets.rule.UDPPorts},
+				} {
+					for _, port := range group.ports {
+						conn.AddRule(&nf.Rule{
+							Table: table,
+							Chain: chain,
+							Exprs: withCounter(geoDropExprs(family.set, family.lan, family.ipv6, allow, group.proto, port)),
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// removeStaleGeoIPSets deletes GeoIP sets of rules that were removed. It
+// runs after the chains were re-programmed, when nothing references them.
+func removeStaleGeoIPSets(table *nf.Table, cfg *Config) error {
+	conn := newConn()
+	sets, err := conn.GetSets(table)
+	if err != nil {
+		return firewallError("nftables.removeStaleGeoIPSets", "failed to enumerate sets", err, apperrors.Metadata{
+			"table": table.Name,
+		})
+	}
+
+	wanted := make(map[string]struct{}, len(cfg.GeoIP.Rules)*2)
+	for _, rule := range cfg.GeoIP.Rules {
+		wanted[geoSetName(rule.Name, false)] = struct{}{}
+		wanted[geoSetName(rule.Name, true)] = struct{}{}
+	}
+
+	stale := false
+	for _, set := range sets {
+		if !strings.HasPrefix(set.Name, geoSetPrefix) {
+			continue
+		}
+		if _, ok := wanted[set.Name]; ok {
+			continue
+		}
+		conn.DelSet(&nf.Set{Table: table, Name: set.Name})
+		stale = true
+	}
+	if !stale {
+		return nil
+	}
+	if err := conn.Flush(); err != nil {
+		return firewallError("nftables.removeStaleGeoIPSets", "failed to delete stale GeoIP sets", err, apperrors.Metadata{
+			"table": table.Name,
+		})
+	}
+	return nil
+}
+
+func geoSetName(rule string, ipv6 bool) string {
+	if ipv6 {
+		return geoSetPrefix + rule + "6"
+	}
+	return geoSetPrefix + rule + "4"
+}
@@ -0,0 +1,222 @@
+package nftables
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+const (
+	maxmindLocationsSuffix = "-Country-Locations-en.csv"
+	maxmindBlocks4Suffix   = "-Country-Blocks-IPv4.csv"
+	maxmindBlocks6Suffix   = "-Country-Blocks-IPv6.csv"
+)
+
+// LoadCountryCIDRs returns the prefixes of each requested country (ISO 3166
+// alpha-2, case-insensitive) from a GeoIP database directory. Two layouts
+// are understood:
+//
+//   - a MaxMind GeoLite2/GeoIP2 Country CSV export
+//     (*-Country-Locations-en.csv plus *-Country-Blocks-IPv4/IPv6.csv);
+//   - per-country CIDR lists such as ipdeny zone files, named after the
+//     country code ("cn.zone", "cn-aggregated.zone", "cn.txt", "cn6.zone"),
+//     one prefix per line with "#" comments.
+//
+// Countries without any prefix are reported as an error so a typo does not
+// silently turn an allow rule into a lockout.
+func LoadCountryCIDRs(database string, countries []string) (map[string][]string, error) {
+	wanted := make(map[string]struct{}, len(countries))
+	for _, country := range countries {
+		wanted[strings.ToUpper(strings.TrimSpace(country))] = struct{}{}
+	}
+
+	entries, err := os.ReadDir(database)
+	if err != nil {
+		return nil, firewallError("nftables.LoadCountryCIDRs", "failed to read GeoIP database directory", err, apperrors.Metadata{
+			"database": database,
+		})
+	}
+
+	var result map[string][]string
+	if locations := findEntry(entries, maxmindLocationsSuffix); locations != "" {
+		result, err = loadMaxMindCSV(database, entries, locations, wanted)
+	} else {
+		result, err = loadCountryLists(database, entries, wanted)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for country := range wanted {
+		if len(result[country]) == 0 {
+			return nil, firewallError("nftables.LoadCountryCIDRs", "no prefixes found for country", nil, apperrors.Metadata{
+				"database": database,
+				"country":  country,
+			})
+		}
+	}
+	return result, nil
+}
+
+func loadMaxMindCSV(dir string, entries []os.DirEntry, locations string, wanted map[string]struct{}) (map[string][]string, error) {
+	geonames := make(map[string]string)
+	err := readCSV(filepath.Join(dir, locations), func(header map[string]int, record []string) {
+		id := csvField(header, record, "geoname_id")
+		code := strings.ToUpper(csvField(header, record, "country_iso_code"))
+		if _, ok := wanted[code]; ok && id != "" {
+			geonames[id] = code
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string)
+	for _, suffix := range []string{maxmindBlocks4Suffix, maxmindBlocks6Suffix} {
+		blocks := findEntry(entries, suffix)
+		if blocks == "" {
+			continue
+		}
+		err := readCSV(filepath.Join(dir, blocks), func(header map[string]int, record []string) {
+			id := csvField(header, record, "geoname_id")
+			if id == "" {
+				id = csvField(header, record, "registered_country_geoname_id")
+			}
+			if code, ok := geonames[id]; ok {
+				result[code] = append(result[code], csvField(header, record, "network"))
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func loadCountryLists(dir string, entries []os.DirEntry, wanted map[string]struct{}) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		code := listCountryCode(entry.Name())
+		if _, ok := wanted[code]; !ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		cidrs, err := readCIDRList(path)
+		if err != nil {
+			return nil, firewallError("nftables.loadCountryLists", "failed to read country CIDR list", err, apperrors.Metadata{
+				"path": path,
+			})
+		}
+		result[code] = append(result[code], cidrs...)
+	}
+	return result, nil
+}
+
+// listCountryCode derives the country code from a list file name:
+// "cn.zone", "CN-aggregated.zone", "cn_v4.txt" and "cn6.zone" all map to CN.
+func listCountryCode(name string) string {
+	base := strings.ToUpper(name)
+	if len(base) < 2 {
+		return ""
+	}
+	code := base[:2]
+	rest := strings.TrimPrefix(base[2:], "6")
+	if rest == "" || strings.ContainsRune(".-_", rune(rest[0])) {
+		return code
+	}
+	return ""
+}
+
+// readCIDRList reads one prefix (or bare address) per line.
+func readCIDRList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cidrs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			ip := net.ParseIP(line)
+			if ip == nil {
+				continue
+			}
+			if ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+		if _, _, err := net.ParseCIDR(line); err != nil {
+			continue
+		}
+		cidrs = append(cidrs, line)
+	}
+	return cidrs, scanner.Err()
+}
+
+func readCSV(path string, fn func(header map[string]int, record []string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return firewallError("nftables.readCSV", "failed to open GeoIP CSV file", err, apperrors.Metadata{"path": path})
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header := make(map[string]int)
+	first, err := reader.Read()
+	if err != nil {
+		return firewallError("nftables.readCSV", "failed to read GeoIP CSV header", err, apperrors.Metadata{"path": path})
+	}
+	for idx, name := range first {
+		header[strings.TrimSpace(name)] = idx
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return firewallError("nftables.readCSV", "failed to parse GeoIP CSV file", err, apperrors.Metadata{"path": path})
+		}
+		fn(header, record)
+	}
+}
+
+func csvField(header map[string]int, record []string, name string) string {
+	idx, ok := header[name]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+func findEntry(entries []os.DirEntry, suffix string) string {
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), suffix) {
+			return entry.Name()
+		}
+	}
+	return ""
+}
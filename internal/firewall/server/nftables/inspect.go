@@ -0,0 +1,271 @@
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+	"github.com/google/nftables/expr"
+)
+
+// Report describes what is programmed in the managed table.
+type Report struct {
+	Table      string            `json:"table"`
+	Chains     []ChainReport     `json:"chains"`
+	Sets       []SetReport       `json:"sets"`
+	Flowtables []FlowtableReport `json:"flowtables"`
+}
+
+// ChainReport is one chain with its rules in evaluation order.
+type ChainReport struct {
+	Name     string       `json:"name"`
+	Type     string       `json:"type,omitempty"`
+	Hook     string       `json:"hook,omitempty"`
+	Priority int32        `json:"priority"`
+	Policy   string       `json:"policy,omitempty"`
+	Rules    []RuleReport `json:"rules"`
+}
+
+// RuleReport is a rule rendered in nft syntax with its counter values.
+type RuleReport struct {
+	Handle  uint64 `json:"handle"`
+	Rule    string `json:"rule"`
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// SetReport lists a set and its elements; interval sets show prefixes or
+// ranges, timeout sets the remaining lifetime of each element.
+type SetReport struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Flags    []string `json:"flags,omitempty"`
+	Count    int      `json:"count"`
+	Elements []string `json:"elements"`
+}
+
+// FlowtableReport lists the devices attached to a flowtable.
+type FlowtableReport struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+// Inspect reads back the managed table. A missing table yields a report
+// without chains, sets or flowtables.
+func Inspect(cfg *Config) (*Report, error) {
+	cfg = normalizedConfig(cfg)
+	conn := newConn()
+	report := &Report{Table: cfg.TableName}
+
+	exists, err := tableExists(conn, cfg.TableName, nf.TableFamilyINet)
+	if err != nil || !exists {
+		return report, err
+	}
+	table := &nf.Table{Name: cfg.TableName, Family: nf.TableFamilyINet}
+
+	if report.Chains, err = inspectChains(conn, table); err != nil {
+		return nil, err
+	}
+	if report.Sets, err = inspectSets(conn, table); err != nil {
+		return nil, err
+	}
+
+	flowtables, err := conn.ListFlowtables(table)
+	if err != nil {
+		return nil, firewallError("nftables.Inspect.flowtables", "failed to list flowtables", err, apperrors.Metadata{
+			"table": table.Name,
+		})
+	}
+	for _, ft := range flowtables {
+		devices := append([]string{}, ft.Devices...)
+		sort.Strings(devices)
+		report.Flowtables = append(report.Flowtables, FlowtableReport{Name: ft.Name, Devices: devices})
+	}
+	return report, nil
+}
+
+func inspectChains(conn netlinkConn, table *nf.Table) ([]ChainReport, error) {
+	chains, err := conn.ListChainsOfTableFamily(table.Family)
+	if err != nil {
+		return nil, firewallError("nftables.inspectChains", "failed to enumerate chains", err, apperrors.Metadata{
+			"table": table.Name,
+		})
+	}
+
+	var reports []ChainReport
+	for _, chain := range chains {
+		if chain.Table == nil || chain.Table.Name != table.Name {
+			continue
+		}
+		report := ChainReport{
+			Name: chain.Name,
+			Type: string(chain.Type),
+			Hook: chainHookName(chain.Hooknum),
+		}
+		if chain.Priority != nil {
+			report.Priority = int32(*chain.Priority)
+		}
+		if chain.Policy != nil {
+			report.Policy = "accept"
+			if *chain.Policy == nf.ChainPolicyDrop {
+				report.Policy = "drop"
+			}
+		}
+
+		rules, err := conn.GetRules(table, &nf.Chain{Name: chain.Name, Table: table})
+		if err != nil {
+			return nil, firewallError("nftables.inspectChains.rules", "failed to list chain rules", err, apperrors.Metadata{
+				"chain": chain.Name,
+			})
+		}
+		for _, rule := range rules {
+			entry := RuleReport{Handle: rule.Handle, Rule: renderRule(rule.Exprs)}
+			for _, e := range rule.Exprs {
+				if counter, ok := e.(*expr.Counter); ok {
+					entry.Packets += counter.Packets
+					entry.Bytes += counter.Bytes
+				}
+			}
+			report.Rules = append(report.Rules, entry)
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports, nil
+}
+
+func inspectSets(conn netlinkConn, table *nf.Table) ([]SetReport, error) {
+	sets, err := conn.GetSets(table)
+	if err != nil {
+		return nil, firewallError("nftables.inspectSets", "failed to enumerate sets", err, apperrors.Metadata{
+			"table": table.Name,
+		})
+	}
+
+	var reports []SetReport
+	for _, set := range sets {
+		if set.Anonymous {
+			continue
+		}
+		set.Table = table
+		elements, err := conn.GetSetElements(set)
+		if err != nil {
+			return nil, firewallError("nftables.inspectSets.elements", "failed to read set elements", err, apperrors.Metadata{
+				"set": set.Name,
+			})
+		}
+
+		report := SetReport{Name: set.Name, Type: set.KeyType.Name}
+		for flag, on := range map[string]bool{"interval": set.Interval, "timeout": set.HasTimeout, "dynamic": set.Dynamic} {
+			if on {
+				report.Flags = append(report.Flags, flag)
+			}
+		}
+		sort.Strings(report.Flags)
+
+		if set.Interval {
+			report.Elements = renderIntervals(elements)
+		} else {
+			for _, element := range elements {
+				report.Elements = append(report.Elements, renderElement(set.KeyType, element))
+			}
+			sort.Strings(report.Elements)
+		}
+		report.Count = len(report.Elements)
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports, nil
+}
+
+// renderIntervals pairs the start and end elements of an interval set and
+// prints each interval as a prefix when it is one, else as a range.
+func renderIntervals(elements []nf.SetElement) []string {
+	sortSetElements(elements)
+
+	var out []string
+	var start []byte
+	for _, element := range elements {
+		if !element.IntervalEnd {
+			start = element.Key
+			continue
+		}
+		if start == nil || bytes.Compare(start, element.Key) >= 0 {
+			// The kernel reports a leading end element for the gap below
+			// the first interval.
+			continue
+		}
+		out = append(out, renderRange(start, element.Key))
+		start = nil
+	}
+	return out
+}
+
+// renderRange prints [first, end) as a prefix or "first-last".
+func renderRange(first, end []byte) string {
+	from, ok1 := netip.AddrFromSlice(first)
+	to, ok2 := netip.AddrFromSlice(end)
+	if !ok1 || !ok2 {
+		return fmt.Sprintf("%x-%x", first, end)
+	}
+	last := to.Prev()
+	for bits := 0; bits <= from.BitLen(); bits++ {
+		prefix := netip.PrefixFrom(from, bits)
+		if prefix.Masked().Addr() != from {
+			continue
+		}
+		if lastInPrefix(prefix) == last {
+			return prefix.String()
+		}
+	}
+	return from.String() + "-" + last.String()
+}
+
+func lastInPrefix(prefix netip.Prefix) netip.Addr {
+	raw := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(raw)*8; bit++ {
+		raw[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return addr
+}
+
+func renderElement(keyType nf.SetDatatype, element nf.SetElement) string {
+	var text string
+	switch keyType.Name {
+	case nf.TypeIFName.Name:
+		text = string(bytes.TrimRight(element.Key, "\x00"))
+	default:
+		if addr, ok := netip.AddrFromSlice(element.Key); ok && (keyType.Name == nf.TypeIPAddr.Name || keyType.Name == nf.TypeIP6Addr.Name) {
+			text = addr.String()
+		} else {
+			text = fmt.Sprintf("0x%x", element.Key)
+		}
+	}
+	if element.Expires > 0 {
+		text += " expires " + element.Expires.Truncate(1e9).String()
+	}
+	return text
+}
+
+func chainHookName(hook *nf.ChainHook) string {
+	if hook == nil {
+		return ""
+	}
+	names := map[nf.ChainHook]string{
+		*nf.ChainHookPrerouting:  "prerouting",
+		*nf.ChainHookInput:       "input",
+		*nf.ChainHookForward:     "forward",
+		*nf.ChainHookOutput:      "output",
+		*nf.ChainHookPostrouting: "postrouting",
+	}
+	if name, ok := names[*hook]; ok {
+		return name
+	}
+	return fmt.Sprintf("hook %d", *hook)
+}
@@ -15,6 +15,13 @@ func Ensure(cfg *Config) error {
 		cfg.applyDefaults()
 	}
 
+	if err := cfg.NAT.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.MSSClamp.Validate(); err != nil {
+		return err
+	}
+
 	tableRef := &nf.Table{
 		Name:   cfg.TableName,
 		Family: nf.TableFamilyINet,
@@ -43,11 +50,30 @@ func Ensure(cfg *Config) error {
 		return err
 	}
 
+	lan6Set, err := ensureLan6CIDRSet(tableRef, cfg)
+	if err != nil {
+		return err
+	}
+
+	rateSets, err := ensureRateLimitSets(tableRef, cfg)
+	if err != nil {
+		return err
+	}
+
+	geoSets, err := ensureGeoIPSets(tableRef, cfg)
+	if err != nil {
+		return err
+	}
+
 	if err := ensureBaseChains(tableRef, cfg); err != nil {
 		return err
 	}
 
-	if err := programChains(tableRef, cfg, lanSet, flowDevices, inputBypass, forwardBypass); err != nil {
+	if err := programChains(tableRef, cfg, lanSet, lan6Set, rateSets, geoSets, flowDevices, inputBypass, forwardBypass); err != nil {
+		return err
+	}
+
+	if err := removeStaleGeoIPSets(tableRef, cfg); err != nil {
 		return err
 	}
 
@@ -63,7 +89,7 @@ func Remove(cfg *Config) error {
 		cfg.applyDefaults()
 	}
 
-	conn := &nf.Conn{}
+	conn := newConn()
 
 	exists, err := tableExists(conn, cfg.TableName, nf.TableFamilyINet)
 	if err != nil {
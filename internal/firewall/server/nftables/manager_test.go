@@ -0,0 +1,334 @@
+package nftables
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testDevices = []string{"eth0", "lo", "wg0"}
+
+// fullConfig enables every feature Ensure programs.
+func fullConfig(t *testing.T) *Config {
+	t.Helper()
+	database := t.TempDir()
+	if err := os.WriteFile(filepath.Join(database, "cn.zone"), []byte("1.0.1.0/24\n1.0.2.0/23\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(database, "cn6.zone"), []byte("2001:250::/35\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.FlowtableDeviceExclude = []string{"lo"}
+	cfg.InputDefaultDrop = true
+	cfg.AllowedTCPPorts = []uint16{443, 22, 80}
+	cfg.AllowedUDPPorts = []uint16{443}
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.TCPPorts = []uint16{443}
+	cfg.RateLimit.UDPPorts = []uint16{443}
+	cfg.RateLimit.ExemptCIDRs = []string{"203.0.113.0/24", "2001:db8::/32"}
+	cfg.GeoIP = GeoIPConfig{
+		Database: database,
+		Rules: []GeoIPRule{
+			{Name: "ssh", Action: GeoIPAllow, Countries: []string{"cn"}, TCPPorts: []uint16{22}},
+		},
+	}
+	cfg.MSSClamp = MSSClampConfig{Ifaces: []string{"wg0"}}
+	cfg.NAT = NATConfig{
+		Masquerade:       true,
+		MasqueradeIfaces: []string{"wg0"},
+		Hairpin:          true,
+		Forwards: []PortForward{
+			{Protocol: "tcp", Port: 8443, Address: netip.MustParseAddr("192.168.1.10"), TargetPort: 443},
+		},
+	}
+	return cfg
+}
+
+func TestEnsureIsIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) *Config
+	}{
+		{name: "defaults", cfg: func(*testing.T) *Config { return nil }},
+		{name: "every feature", cfg: fullConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := useFakeRuleset(t, testDevices...)
+			cfg := tt.cfg(t)
+
+			if err := Ensure(cfg); err != nil {
+				t.Fatalf("first Ensure() error = %v", err)
+			}
+			first := rs.dump()
+
+			rs.elementWrites = 0
+			if err := Ensure(cfg); err != nil {
+				t.Fatalf("second Ensure() error = %v", err)
+			}
+			if second := rs.dump(); second != first {
+				t.Fatalf("second Ensure() changed the ruleset\nfirst:\n%s\nsecond:\n%s", first, second)
+			}
+			if rs.elementWrites != 0 {
+				t.Fatalf("second Ensure() rewrote %d set elements", rs.elementWrites)
+			}
+		})
+	}
+}
+
+func TestEnsureProgramsInputAllowList(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	if err := Ensure(fullConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := rs.dump()
+	for _, want := range []string{
+		"chain gwd_input (filter input policy drop)",
+		"chain gwd_prerouting (nat prerouting policy accept)",
+		"chain gwd_postrouting (nat postrouting policy accept)",
+		"flowtable gwd_ft devices eth0,wg0",
+		"set gwd_lan_cidrs { 10.0.0.0/8, 100.64.0.0/10, 172.16.0.0/12, 192.168.0.0/16 }",
+		"set gwd_geo_ssh4 { 1.0.1.0-1.0.3.255 }",
+		"set gwd_mss_ifaces { wg0 }",
+		"set gwd_exempt4 { 203.0.113.0/24 }",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("ruleset lacks %q\n%s", want, dump)
+		}
+	}
+
+	input := rs.chainRules(t, defaultInputChainName)
+	for _, want := range []string{
+		`iifname "lo" counter accept`,
+		"ct state established,related counter accept",
+		"meta l4proto tcp tcp dport 22 ip saddr != @gwd_geo_ssh4 ip saddr != @gwd_lan_cidrs counter drop",
+		"meta l4proto tcp tcp dport 22 counter accept",
+		"meta l4proto udp udp dport 443 counter accept",
+		"meta l4proto tcp tcp dport 443 ct state new ip saddr != @gwd_lan_cidrs ip saddr != @gwd_exempt4 add @gwd_conn4 { ip saddr ct count over 512 } counter drop",
+	} {
+		if !slices.Contains(input, want) {
+			t.Errorf("input chain lacks %q\n%s", want, strings.Join(input, "\n"))
+		}
+	}
+	// Only the rate limited ports are metered.
+	for _, rule := range input {
+		if strings.Contains(rule, "@gwd_rate4") && !strings.Contains(rule, "dport 443 ") {
+			t.Errorf("rule meters a port outside RateLimit.TCPPorts/UDPPorts: %q", rule)
+		}
+	}
+	// The GeoIP drop must be evaluated before the port is accepted.
+	if slices.Index(input, "meta l4proto tcp tcp dport 22 counter accept") <
+		slices.Index(input, "meta l4proto tcp tcp dport 22 ip saddr != @gwd_geo_ssh4 ip saddr != @gwd_lan_cidrs counter drop") {
+		t.Error("port accept precedes the GeoIP allow-list drop")
+	}
+
+	forward := rs.chainRules(t, defaultForwardChainName)
+	if len(forward) == 0 || !strings.HasPrefix(forward[0], "oifname @gwd_mss_ifaces") {
+		t.Errorf("forward chain does not start with the MSS clamp rule\n%s", strings.Join(forward, "\n"))
+	}
+	if !slices.Contains(forward, "ct status dnat counter accept") {
+		t.Errorf("forward chain does not accept DNAT traffic\n%s", strings.Join(forward, "\n"))
+	}
+
+	prerouting := rs.chainRules(t, defaultPreroutingChain)
+	if want := []string{"fib daddr type local meta l4proto tcp tcp dport 8443 counter dnat ip to 192.168.1.10:443"}; !slices.Equal(prerouting, want) {
+		t.Errorf("prerouting chain = %q, want %q", prerouting, want)
+	}
+}
+
+func TestEnsureFollowsConfigChanges(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	cfg := fullConfig(t)
+	if err := Ensure(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.LanCIDRs = []string{"10.8.0.0/24"}
+	cfg.GeoIP.Rules = nil
+	cfg.NAT = NATConfig{}
+	cfg.MSSClamp = MSSClampConfig{}
+	cfg.InputDefaultDrop = false
+	if err := Ensure(cfg); err != nil {
+		t.Fatalf("Ensure() with reduced config error = %v", err)
+	}
+
+	dump := rs.dump()
+	for _, gone := range []string{"gwd_geo_ssh", "gwd_prerouting", "gwd_postrouting", "policy drop", "masquerade", "maxseg"} {
+		if strings.Contains(dump, gone) {
+			t.Errorf("ruleset still contains %q\n%s", gone, dump)
+		}
+	}
+	if !strings.Contains(dump, "set gwd_lan_cidrs { 10.8.0.0/24 }") {
+		t.Errorf("LAN set was not updated\n%s", dump)
+	}
+
+	if err := Ensure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if again := rs.dump(); again != dump {
+		t.Fatalf("Ensure() is not idempotent after a change\nbefore:\n%s\nafter:\n%s", dump, again)
+	}
+}
+
+func TestEnsureKeepsRulesWhenProgrammingFails(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	cfg := fullConfig(t)
+	if err := Ensure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	before := rs.chainRules(t, defaultInputChainName)
+
+	// Fail every transaction of the next Ensure.
+	flushes := rs.flushes
+	rs.failFlush = func(flush int) error {
+		if flush > flushes {
+			return errors.New("injected failure")
+		}
+		return nil
+	}
+	cfg.AllowedTCPPorts = []uint16{2222}
+	if err := Ensure(cfg); err == nil {
+		t.Fatal("Ensure() succeeded despite the failing transaction")
+	}
+	rs.failFlush = nil
+
+	if after := rs.chainRules(t, defaultInputChainName); !slices.Equal(after, before) {
+		t.Fatalf("failed Ensure() left a partial input chain\n%s", strings.Join(after, "\n"))
+	}
+}
+
+func TestEnsureRejectsInvalidConfig(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	cfg := DefaultConfig()
+	cfg.NAT.Forwards = []PortForward{{Protocol: "sctp", Port: 80, Address: netip.MustParseAddr("10.0.0.2")}}
+
+	if err := Ensure(cfg); err == nil {
+		t.Fatal("Ensure() accepted an invalid port forward")
+	}
+	if len(rs.tables) != 0 {
+		t.Fatal("Ensure() changed the ruleset before validating")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	if err := Ensure(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(nil); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if len(rs.tables) != 0 {
+		t.Fatalf("Remove() left tables behind:\n%s", rs.dump())
+	}
+	if err := Remove(nil); err != nil {
+		t.Fatalf("Remove() without a table error = %v", err)
+	}
+}
+
+func TestBans(t *testing.T) {
+	useFakeRuleset(t, testDevices...)
+	addr := netip.MustParseAddr("203.0.113.7")
+
+	if err := BanAddress(nil, addr, time.Minute); err == nil {
+		t.Fatal("BanAddress() succeeded before the firewall was applied")
+	}
+	if err := Ensure(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BanAddress(nil, addr, time.Minute); err != nil {
+		t.Fatalf("BanAddress() error = %v", err)
+	}
+	if err := BanAddress(nil, netip.MustParseAddr("2001:db8::1"), 2*time.Minute); err != nil {
+		t.Fatalf("BanAddress() IPv6 error = %v", err)
+	}
+	bans, err := ListBans(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bans) != 2 || bans[0].Address.String() != "2001:db8::1" || bans[1].Address != addr {
+		t.Fatalf("ListBans() = %+v", bans)
+	}
+
+	removed, err := UnbanAddress(nil, netip.MustParseAddr("::ffff:203.0.113.7"))
+	if err != nil || !removed {
+		t.Fatalf("UnbanAddress() = %v, %v", removed, err)
+	}
+	removed, err = UnbanAddress(nil, addr)
+	if err != nil || removed {
+		t.Fatalf("UnbanAddress() of an address that is not banned = %v, %v", removed, err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	useFakeRuleset(t, testDevices...)
+
+	report, err := Inspect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Chains) != 0 || len(report.Sets) != 0 {
+		t.Fatalf("Inspect() without a table = %+v", report)
+	}
+
+	if err := Ensure(fullConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Inspect(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var input *ChainReport
+	for idx := range report.Chains {
+		if report.Chains[idx].Name == defaultInputChainName {
+			input = &report.Chains[idx]
+		}
+	}
+	if input == nil || input.Hook != "input" || input.Policy != "drop" || len(input.Rules) == 0 {
+		t.Fatalf("Inspect() input chain = %+v", input)
+	}
+	if len(report.Flowtables) != 1 || !slices.Equal(report.Flowtables[0].Devices, []string{"eth0", "wg0"}) {
+		t.Fatalf("Inspect() flowtables = %+v", report.Flowtables)
+	}
+	for _, set := range report.Sets {
+		if set.Name == defaultLanSetName && set.Count != 4 {
+			t.Fatalf("Inspect() LAN set = %+v", set)
+		}
+	}
+}
+
+func TestRefreshGeoIPRequiresAppliedFirewall(t *testing.T) {
+	rs := useFakeRuleset(t, testDevices...)
+	cfg := fullConfig(t)
+	if err := RefreshGeoIP(cfg); err == nil {
+		t.Fatal("RefreshGeoIP() succeeded without the table")
+	}
+	if err := Ensure(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(cfg.GeoIP.Database, "cn.zone"), []byte("1.0.8.0/21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules := rs.chainRules(t, defaultInputChainName)
+	if err := RefreshGeoIP(cfg); err != nil {
+		t.Fatalf("RefreshGeoIP() error = %v", err)
+	}
+	if !strings.Contains(rs.dump(), "set gwd_geo_ssh4 { 1.0.8.0/21 }") {
+		t.Fatalf("RefreshGeoIP() did not reload the set\n%s", rs.dump())
+	}
+	if !slices.Equal(rs.chainRules(t, defaultInputChainName), rules) {
+		t.Fatal("RefreshGeoIP() touched the input chain")
+	}
+}
@@ -0,0 +1,49 @@
+package nftables
+
+import (
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+)
+
+// minClampMSS is the smallest MSS every IPv4 host must accept (RFC 879).
+const minClampMSS = 536
+
+// MSSClampConfig rewrites the MSS option of forwarded TCP SYNs leaving
+// through Ifaces, which avoids PMTU black holes behind WireGuard tunnels and
+// PPPoE uplinks. With MSS zero the value follows the route MTU (rt mtu);
+// otherwise larger values are lowered to MSS.
+type MSSClampConfig struct {
+	Ifaces  []string
+	MSS     uint16
+	SetName string
+}
+
+// Validate rejects fixed values below the minimum MSS.
+func (m MSSClampConfig) Validate() error {
+	if m.MSS != 0 && m.MSS < minClampMSS {
+		return firewallError("nftables.MSSClampConfig.Validate", "MSS clamp value must be at least 536", nil, apperrors.Metadata{
+			"mss": m.MSS,
+		})
+	}
+	return nil
+}
+
+// addMSSClampRule keeps the output interface set in sync and, when it has
+// members, clamps the MSS of SYNs routed out of them. It must come before
+// any accept in the forward chain.
+func addMSSClampRule(conn netlinkConn, table *nf.Table, cfg *Config) error {
+	if cfg.ForwardChainName == "" {
+		return nil
+	}
+	ifaceSet, err := ensureIfaceSet(conn, table, cfg.MSSClamp.SetName, cfg.MSSClamp.Ifaces)
+	if err != nil || ifaceSet == nil || len(cfg.MSSClamp.Ifaces) == 0 {
+		return err
+	}
+
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: &nf.Chain{Name: cfg.ForwardChainName, Table: table},
+		Exprs: withCounter(mssClampExprs(ifaceSet, cfg.MSSClamp.MSS)),
+	})
+	return nil
+}
@@ -0,0 +1,147 @@
+package nftables
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+	"golang.org/x/sys/unix"
+)
+
+// NATConfig adds the nat chains. IP forwarding itself (net.ipv4.ip_forward)
+// is not managed here.
+type NATConfig struct {
+	// Masquerade rewrites the source of traffic from the LAN sets to
+	// destinations outside them; MasqueradeIfaces does the same for
+	// traffic arriving on those interfaces, e.g. WireGuard peers.
+	Masquerade       bool
+	MasqueradeIfaces []string
+
+	// Forwards DNAT public ports to internal hosts. Hairpin masquerades LAN
+	// clients that reach a forward through the public address, so the
+	// replies return through this host instead of going direct.
+	Forwards []PortForward
+	Hairpin  bool
+
+	PreroutingChainName  string
+	PostroutingChainName string
+}
+
+// PortForward sends Protocol traffic addressed to one of the host's own
+// addresses on Port to Address:TargetPort. The address family of Address
+// selects the IPv4 or IPv6 rule.
+type PortForward struct {
+	Protocol   string // "tcp" or "udp"
+	Port       uint16
+	Address    netip.Addr
+	TargetPort uint16 // zero keeps Port
+	InIface    string // optional; restricts the forward to one interface
+}
+
+// Enabled reports whether any nat rule is configured.
+func (n NATConfig) Enabled() bool {
+	return n.Masquerade || len(n.MasqueradeIfaces) > 0 || len(n.Forwards) > 0
+}
+
+// Validate checks protocols, ports and addresses of the forwards.
+func (n NATConfig) Validate() error {
+	seen := make(map[string]struct{}, len(n.Forwards))
+	for _, fwd := range n.Forwards {
+		metadata := apperrors.Metadata{"protocol": fwd.Protocol, "port": fwd.Port}
+		if _, ok := forwardProto(fwd.Protocol); !ok {
+			return firewallError("nftables.NATConfig.Validate", `port forward protocol must be "tcp" or "udp"`, nil, metadata)
+		}
+		if fwd.Port == 0 {
+			return firewallError("nftables.NATConfig.Validate", "port forward needs a public port", nil, metadata)
+		}
+		if !fwd.Address.IsValid() || fwd.Address.IsUnspecified() {
+			return firewallError("nftables.NATConfig.Validate", "port forward needs a target address", nil, metadata)
+		}
+		// One public port per family and interface can only go to one host.
+		family := "ip6"
+		if fwd.Address.Unmap().Is4() {
+			family = "ip"
+		}
+		key := family + "/" + strings.ToLower(fwd.Protocol) + "/" + fwd.InIface + "/" + strconv.Itoa(int(fwd.Port))
+		if _, dup := seen[key]; dup {
+			return firewallError("nftables.NATConfig.Validate", "duplicate port forward", nil, metadata)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
+func forwardProto(protocol string) (byte, bool) {
+	switch strings.ToLower(protocol) {
+	case "tcp":
+		return unix.IPPROTO_TCP, true
+	case "udp":
+		return unix.IPPROTO_UDP, true
+	}
+	return 0, false
+}
+
+// programNATChains fills the prerouting chain with the DNAT forwards and the
+// postrouting chain with the masquerade and hairpin rules.
+func programNATChains(conn netlinkConn, table *nf.Table, cfg *Config, lanSet, lan6Set *nf.Set) {
+	nat := cfg.NAT
+	prerouting := &nf.Chain{Name: nat.PreroutingChainName, Table: table}
+	postrouting := &nf.Chain{Name: nat.PostroutingChainName, Table: table}
+
+	for _, fwd := range nat.Forwards {
+		proto, _ := forwardProto(fwd.Protocol)
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: prerouting,
+			Exprs: withCounter(dnatExprs(fwd, proto)),
+		})
+	}
+
+	for _, family := range []struct {
+		lan  *nf.Set
+		ipv6 bool
+	}{
+		{lanSet, false},
+		{lan6Set, true},
+	} {
+		if family.lan == nil {
+			continue
+		}
+		if nat.Masquerade {
+			conn.AddRule(&nf.Rule{
+				Table: table,
+				Chain: postrouting,
+				Exprs: withCounter(lanMasqueradeExprs(family.lan, family.ipv6)),
+			})
+		}
+		for _, iface := range uniqueStrings(nat.MasqueradeIfaces) {
+			conn.AddRule(&nf.Rule{
+				Table: table,
+				Chain: postrouting,
+				Exprs: withCounter(ifaceMasqueradeExprs(iface, family.lan, family.ipv6)),
+			})
+		}
+		if nat.Hairpin && len(nat.Forwards) > 0 {
+			conn.AddRule(&nf.Rule{
+				Table: table,
+				Chain: postrouting,
+				Exprs: withCounter(hairpinMasqueradeExprs(family.lan, family.ipv6)),
+			})
+		}
+	}
+}
+
+// addForwardDNATAcceptRule accepts forwarded connections that were DNATed by
+// the prerouting chain, so they pass gwd_forward regardless of what follows.
+func addForwardDNATAcceptRule(conn netlinkConn, table *nf.Table, cfg *Config) {
+	if cfg.ForwardChainName == "" || len(cfg.NAT.Forwards) == 0 {
+		return
+	}
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: &nf.Chain{Name: cfg.ForwardChainName, Table: table},
+		Exprs: withCounter(ctStatusDNATAcceptExprs()),
+	})
+}
@@ -0,0 +1,235 @@
+package nftables
+
+import (
+	nf "github.com/google/nftables"
+	"golang.org/x/sys/unix"
+)
+
+// rateLimitSets holds the dynamic sets of one address family and the
+// interval set of sources exempt from the per-source limits.
+type rateLimitSets struct {
+	ban    *nf.Set
+	rate   *nf.Set
+	conn   *nf.Set
+	exempt *nf.Set
+	ipv6   bool
+}
+
+type rateLimitFamily struct {
+	keyType                    nf.SetDatatype
+	ban, rate, connSet, exempt string
+	ipv6                       bool
+}
+
+func rateLimitFamilies(rl RateLimitConfig) []rateLimitFamily {
+	return []rateLimitFamily{
+		{nf.TypeIPAddr, rl.BanSetName, rl.RateSetName, rl.ConnSetName, rl.ExemptSetName, false},
+		{nf.TypeIP6Addr, rl.Ban6SetName, rl.Rate6SetName, rl.Conn6SetName, rl.Exempt6SetName, true},
+	}
+}
+
+// ensureRateLimitSets creates the ban sets for both families and, when rate
+// limiting is enabled, the meter, connection-count and exempt sets. The ban
+// sets always exist so BanAddress works without rate limiting. Elements of
+// the dynamic sets are owned by the kernel (and BanAddress), so existing
+// entries survive a re-run of Ensure.
+func ensureRateLimitSets(table *nf.Table, cfg *Config) ([]rateLimitSets, error) {
+	conn := newConn()
+	rl := cfg.RateLimit
+	exempt4, exempt6 := splitCIDRsByFamily(rl.ExemptCIDRs)
+
+	families := rateLimitFamilies(rl)
+
+	result := make([]rateLimitSets, 0, len(families))
+	for _, family := range families {
+		ban, err := ensureSet(conn, table, setEnsureOptions{
+			Name:           family.ban,
+			KeyType:        family.keyType,
+			HasTimeout:     true,
+			Dynamic:        true,
+			Timeout:        rl.BanTimeout,
+			Operation:      "nftables.ensureRateLimitSets.ban",
+			Entity:         "banned addresses",
+			SetDescription: "ban set",
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !rl.Enabled {
+			result = append(result, rateLimitSets{ban: ban, ipv6: family.ipv6})
+			continue
+		}
+
+		rate, err := ensureSet(conn, table, setEnsureOptions{
+			Name:           family.rate,
+			KeyType:        family.keyType,
+			HasTimeout:     true,
+			Dynamic:        true,
+			Timeout:        rateMeterTimeout,
+			Operation:      "nftables.ensureRateLimitSets.rate",
+			Entity:         "rate meters",
+			SetDescription: "new connection meter set",
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		connSet, err := ensureSet(conn, table, setEnsureOptions{
+			Name:           family.connSet,
+			KeyType:        family.keyType,
+			Dynamic:        true,
+			Operation:      "nftables.ensureRateLimitSets.conn",
+			Entity:         "connection counters",
+			SetDescription: "connection count set",
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		exemptCIDRs := exempt4
+		if family.ipv6 {
+			exemptCIDRs = exempt6
+		}
+		exempt, err := ensureSet(conn, table, setEnsureOptions{
+			Name:           family.exempt,
+			KeyType:        family.keyType,
+			Interval:       true,
+			Operation:      "nftables.ensureRateLimitSets.exempt",
+			Entity:         "CIDRs",
+			SetDescription: "rate limit exempt set",
+		}, func() ([]nf.SetElement, error) {
+			return exemptElements(exemptCIDRs)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, rateLimitSets{ban: ban, rate: rate, conn: connSet, exempt: exempt, ipv6: family.ipv6})
+	}
+	return result, nil
+}
+
+// SetRateLimitExemptions replaces the sources exempt from the per-source
+// limits without rebuilding the ruleset. It does nothing while rate limiting
+// is not applied.
+func SetRateLimitExemptions(cfg *Config, cidrs []string) error {
+	cfg = normalizedConfig(cfg)
+	conn := newConn()
+
+	exists, err := tableExists(conn, cfg.TableName, nf.TableFamilyINet)
+	if err != nil || !exists {
+		return err
+	}
+	table := &nf.Table{Name: cfg.TableName, Family: nf.TableFamilyINet}
+
+	exempt4, exempt6 := splitCIDRsByFamily(cidrs)
+	for _, family := range rateLimitFamilies(cfg.RateLimit) {
+		set, err := findSet(conn, table, family.exempt)
+		if err != nil {
+			return err
+		}
+		if set == nil {
+			continue
+		}
+		exemptCIDRs := exempt4
+		if family.ipv6 {
+			exemptCIDRs = exempt6
+		}
+		elements, err := exemptElements(exemptCIDRs)
+		if err != nil {
+			return err
+		}
+		if _, err := syncSetElements(conn, set, elements, setUpdateContext{
+			Operation: "nftables.SetRateLimitExemptions",
+			Entity:    "CIDRs",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exemptElements merges the exempt CIDRs, which may overlap, into intervals.
+func exemptElements(cidrs []string) ([]nf.SetElement, error) {
+	elements, err := cidrToElements(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return mergeIntervalElements(elements), nil
+}
+
+// addBanDropRules drops every packet from a banned source.
+func addBanDropRules(conn netlinkConn, table *nf.Table, chainName string, sets []rateLimitSets) {
+	if chainName == "" {
+		return
+	}
+	chain := &nf.Chain{Name: chainName, Table: table}
+	for _, family := range sets {
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: withCounter(srcAddrInSetDropExprs(family.ban, family.ipv6)),
+		})
+	}
+}
+
+// addICMPRateLimitRules drops echo requests above the global ICMP rate. They
+// must precede the essential ICMP accept rules.
+func addICMPRateLimitRules(conn netlinkConn, table *nf.Table, chainName string, rl RateLimitConfig) {
+	if chainName == "" {
+		return
+	}
+	chain := &nf.Chain{Name: chainName, Table: table}
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: chain,
+		Exprs: withCounter(icmpRateLimitDropExprs(unix.IPPROTO_ICMP, 8, rl.ICMPRate, rl.ICMPBurst)),
+	})
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: chain,
+		Exprs: withCounter(icmpRateLimitDropExprs(unix.IPPROTO_ICMPV6, 128, rl.ICMPRate, rl.ICMPBurst)),
+	})
+}
+
+// addNewConnLimitRules meters new connections to the rate limited ports per
+// source, banning sources that exceed the rate and refusing new connections
+// above the concurrent cap. LAN and exempt sources are left alone.
+func addNewConnLimitRules(conn netlinkConn, table *nf.Table, chainName string, rl RateLimitConfig, sets []rateLimitSets, lanSet, lan6Set *nf.Set) {
+	if chainName == "" {
+		return
+	}
+	chain := &nf.Chain{Name: chainName, Table: table}
+	ports := []struct {
+		proto byte
+		ports []uint16
+	}{
+		{unix.IPPROTO_TCP, rl.TCPPorts},
+		{unix.IPPROTO_UDP, rl.UDPPorts},
+	}
+	for _, family := range sets {
+		if family.rate == nil || family.conn == nil {
+			continue
+		}
+		lan := lanSet
+		if family.ipv6 {
+			lan = lan6Set
+		}
+		for _, group := range ports {
+			for _, port := range group.ports {
+				match := rateLimitMatchExprs(group.proto, port, family.ipv6, lan, family.exempt)
+				conn.AddRule(&nf.Rule{
+					Table: table,
+					Chain: chain,
+					Exprs: withCounter(newConnRateBanExprs(match, family.rate, family.ban, rl.NewConnRate, rl.NewConnBurst, rl.BanTimeout)),
+				})
+				match = rateLimitMatchExprs(group.proto, port, family.ipv6, lan, family.exempt)
+				conn.AddRule(&nf.Rule{
+					Table: table,
+					Chain: chain,
+					Exprs: withCounter(connCountDropExprs(match, family.conn, rl.MaxConnsPerSource)),
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package nftables
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// operandKind tells renderCmp how to format the bytes a register holds.
+type operandKind int
+
+const (
+	operandRaw operandKind = iota
+	operandNFProto
+	operandL4Proto
+	operandIfname
+	operandAddr
+	operandPort
+	operandICMPType
+	operandCtState
+	operandTCPFlags
+	operandCtStatus
+	operandAddrType
+	operandImmediate
+)
+
+type operand struct {
+	name string
+	kind operandKind
+	mask []byte
+	data []byte // value loaded by an immediate
+}
+
+var (
+	l4ProtoNames = map[byte]string{
+		unix.IPPROTO_TCP:    "tcp",
+		unix.IPPROTO_UDP:    "udp",
+		unix.IPPROTO_ICMP:   "icmp",
+		unix.IPPROTO_ICMPV6: "icmpv6",
+	}
+	icmpTypeNames = map[byte]string{
+		0: "echo-reply", 3: "destination-unreachable", 8: "echo-request",
+		11: "time-exceeded", 12: "parameter-problem",
+	}
+	icmpv6TypeNames = map[byte]string{
+		1: "destination-unreachable", 2: "packet-too-big", 3: "time-exceeded",
+		4: "parameter-problem", 128: "echo-request", 129: "echo-reply",
+		130: "mld-listener-query", 131: "mld-listener-report", 132: "mld-listener-done",
+		133: "nd-router-solicit", 134: "nd-router-advert", 135: "nd-neighbor-solicit",
+		136: "nd-neighbor-advert", 143: "mld2-listener-report",
+	}
+	ctStateNames = []struct {
+		bit  uint32
+		name string
+	}{
+		{expr.CtStateBitINVALID, "invalid"},
+		{expr.CtStateBitESTABLISHED, "established"},
+		{expr.CtStateBitRELATED, "related"},
+		{expr.CtStateBitNEW, "new"},
+		{expr.CtStateBitUNTRACKED, "untracked"},
+	}
+	tcpFlagNames  = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ecn", "cwr"}
+	addrTypeNames = map[uint32]string{
+		unix.RTN_UNICAST: "unicast", unix.RTN_LOCAL: "local", unix.RTN_BROADCAST: "broadcast",
+		unix.RTN_ANYCAST: "anycast", unix.RTN_MULTICAST: "multicast",
+	}
+)
+
+// ruleRenderer tracks what each register holds while walking a rule, so
+// comparisons and lookups can name their operand the way nft does.
+type ruleRenderer struct {
+	regs    map[uint32]operand
+	l4proto byte
+	nfproto uint32
+	parts   []string
+}
+
+// renderRule formats rule expressions in nft-like syntax. It understands the
+// expressions the rule builders in this package emit; anything else is
+// shown by its expression type.
+func renderRule(exprs []expr.Any) string {
+	r := &ruleRenderer{regs: make(map[uint32]operand)}
+	for _, e := range exprs {
+		r.render(e)
+	}
+	return strings.Join(r.parts, " ")
+}
+
+func (r *ruleRenderer) emit(format string, args ...any) {
+	r.parts = append(r.parts, fmt.Sprintf(format, args...))
+}
+
+func (r *ruleRenderer) render(e expr.Any) {
+	switch e := e.(type) {
+	case *expr.Meta:
+		r.regs[e.Register] = r.metaOperand(e.Key)
+	case *expr.Ct:
+		switch e.Key {
+		case expr.CtKeySTATE:
+			r.regs[e.Register] = operand{name: "ct state", kind: operandCtState}
+		case expr.CtKeySTATUS:
+			r.regs[e.Register] = operand{name: "ct status", kind: operandCtStatus}
+		default:
+			r.regs[e.Register] = operand{name: fmt.Sprintf("ct key %d", e.Key)}
+		}
+	case *expr.Payload:
+		r.regs[e.DestRegister] = r.payloadOperand(e)
+	case *expr.Bitwise:
+		op := r.regs[e.SourceRegister]
+		op.mask = e.Mask
+		r.regs[e.DestRegister] = op
+	case *expr.Cmp:
+		r.renderCmp(r.regs[e.Register], e)
+	case *expr.Lookup:
+		r.emit("%s %s@%s", r.regs[e.SourceRegister].name, negation(e.Invert), e.SetName)
+	case *expr.Dynset:
+		r.renderDynset(e)
+	case *expr.Limit:
+		r.emit("%s", renderLimit(e))
+	case *expr.Connlimit:
+		r.emit("%s", renderConnlimit(e))
+	case *expr.Counter:
+		r.emit("counter")
+	case *expr.Verdict:
+		r.emit("%s", renderVerdict(e))
+	case *expr.FlowOffload:
+		r.emit("flow add @%s", e.Name)
+	case *expr.Fib:
+		if e.ResultADDRTYPE && e.FlagDADDR {
+			r.regs[e.Register] = operand{name: "fib daddr type", kind: operandAddrType}
+		} else {
+			r.regs[e.Register] = operand{name: "fib"}
+		}
+	case *expr.Rt:
+		if e.Key == expr.RtTCPMSS {
+			r.regs[e.Register] = operand{name: "rt mtu"}
+		} else {
+			r.regs[e.Register] = operand{name: fmt.Sprintf("rt key %d", e.Key)}
+		}
+	case *expr.Exthdr:
+		r.renderExthdr(e)
+	case *expr.Immediate:
+		r.regs[e.Register] = operand{kind: operandImmediate, data: e.Data}
+	case *expr.NAT:
+		r.emit("%s", r.renderNAT(e))
+	case *expr.Masq:
+		r.emit("masquerade")
+	default:
+		r.emit("<%s>", strings.TrimPrefix(fmt.Sprintf("%T", e), "*expr."))
+	}
+}
+
+func (r *ruleRenderer) metaOperand(key expr.MetaKey) operand {
+	switch key {
+	case expr.MetaKeyL4PROTO:
+		return operand{name: "meta l4proto", kind: operandL4Proto}
+	case expr.MetaKeyNFPROTO:
+		return operand{name: "meta nfproto", kind: operandNFProto}
+	case expr.MetaKeyIIFNAME:
+		return operand{name: "iifname", kind: operandIfname}
+	case expr.MetaKeyOIFNAME:
+		return operand{name: "oifname", kind: operandIfname}
+	default:
+		return operand{name: fmt.Sprintf("meta key %d", key)}
+	}
+}
+
+func (r *ruleRenderer) payloadOperand(p *expr.Payload) operand {
+	switch p.Base {
+	case expr.PayloadBaseNetworkHeader:
+		family := "ip"
+		if p.Len == 16 || r.nfproto == unix.NFPROTO_IPV6 {
+			family = "ip6"
+		}
+		switch {
+		case family == "ip" && p.Offset == 12 && p.Len == 4,
+			family == "ip6" && p.Offset == 8 && p.Len == 16:
+			return operand{name: family + " saddr", kind: operandAddr}
+		case family == "ip" && p.Offset == 16 && p.Len == 4,
+			family == "ip6" && p.Offset == 24 && p.Len == 16:
+			return operand{name: family + " daddr", kind: operandAddr}
+		}
+	case expr.PayloadBaseTransportHeader:
+		proto := "th"
+		if name, ok := l4ProtoNames[r.l4proto]; ok {
+			proto = name
+		}
+		switch {
+		case p.Offset == 0 && p.Len == 1 && (r.l4proto == unix.IPPROTO_ICMP || r.l4proto == unix.IPPROTO_ICMPV6):
+			return operand{name: proto + " type", kind: operandICMPType}
+		case p.Offset == 0 && p.Len == 2:
+			return operand{name: proto + " sport", kind: operandPort}
+		case p.Offset == 2 && p.Len == 2:
+			return operand{name: proto + " dport", kind: operandPort}
+		case p.Offset == 13 && p.Len == 1 && r.l4proto == unix.IPPROTO_TCP:
+			return operand{name: "tcp flags", kind: operandTCPFlags}
+		}
+	}
+	bases := map[expr.PayloadBase]string{
+		expr.PayloadBaseLLHeader:        "@ll",
+		expr.PayloadBaseNetworkHeader:   "@nh",
+		expr.PayloadBaseTransportHeader: "@th",
+	}
+	return operand{name: fmt.Sprintf("%s,%d,%d", bases[p.Base], p.Offset*8, p.Len*8)}
+}
+
+func (r *ruleRenderer) renderCmp(op operand, c *expr.Cmp) {
+	cmpOp := cmpOperator(c.Op)
+	switch op.kind {
+	case operandNFProto:
+		// Implied by the ip/ip6 address expressions that follow.
+		r.nfproto = uint32(nativeValue(c.Data))
+		if c.Op != expr.CmpOpEq {
+			r.emit("meta nfproto %s%d", cmpOp, r.nfproto)
+		}
+		return
+	case operandL4Proto:
+		r.l4proto = byte(nativeValue(c.Data))
+		name, ok := l4ProtoNames[r.l4proto]
+		if !ok {
+			name = fmt.Sprintf("%d", r.l4proto)
+		}
+		r.emit("meta l4proto %s%s", cmpOp, name)
+	case operandIfname:
+		r.emit("%s %s%q", op.name, cmpOp, string(bytes.TrimRight(c.Data, "\x00")))
+	case operandAddr:
+		r.emit("%s %s%s", op.name, cmpOp, net.IP(c.Data))
+	case operandPort:
+		r.emit("%s %s%d", op.name, cmpOp, binary.BigEndian.Uint16(c.Data))
+	case operandICMPType:
+		names := icmpTypeNames
+		if r.l4proto == unix.IPPROTO_ICMPV6 {
+			names = icmpv6TypeNames
+		}
+		value := c.Data[0]
+		if name, ok := names[value]; ok {
+			r.emit("%s %s%s", op.name, cmpOp, name)
+		} else {
+			r.emit("%s %s%d", op.name, cmpOp, value)
+		}
+	case operandCtState:
+		if op.mask != nil && c.Op == expr.CmpOpNeq && isZero(c.Data) {
+			r.emit("ct state %s", ctStateList(uint32(nativeValue(op.mask))))
+			return
+		}
+		r.emit("ct state %s%s", cmpOp, ctStateList(uint32(nativeValue(c.Data))))
+	case operandCtStatus:
+		if op.mask != nil && c.Op == expr.CmpOpNeq && isZero(c.Data) && nativeValue(op.mask) == ctStatusDNAT {
+			r.emit("ct status dnat")
+			return
+		}
+		r.emit("ct status %s0x%x", cmpOp, nativeValue(c.Data))
+	case operandAddrType:
+		value := uint32(nativeValue(c.Data))
+		if name, ok := addrTypeNames[value]; ok {
+			r.emit("%s %s%s", op.name, cmpOp, name)
+		} else {
+			r.emit("%s %s%d", op.name, cmpOp, value)
+		}
+	case operandTCPFlags:
+		if op.mask != nil {
+			r.emit("tcp flags & (%s) %s %s", tcpFlagList(op.mask[0], "|"), cmpSymbol(c.Op), tcpFlagList(c.Data[0], "|"))
+			return
+		}
+		r.emit("tcp flags %s%s", cmpOp, tcpFlagList(c.Data[0], ","))
+	default:
+		if op.mask != nil {
+			r.emit("%s & 0x%x %s 0x%x", op.name, op.mask, cmpSymbol(c.Op), c.Data)
+			return
+		}
+		r.emit("%s %s0x%x", op.name, cmpOp, c.Data)
+	}
+}
+
+func (r *ruleRenderer) renderDynset(d *expr.Dynset) {
+	verb := "add"
+	if d.Operation == unix.NFT_DYNSET_OP_UPDATE {
+		verb = "update"
+	}
+	inner := []string{r.regs[d.SrcRegKey].name}
+	if d.Timeout > 0 {
+		inner = append(inner, "timeout "+d.Timeout.String())
+	}
+	for _, e := range d.Exprs {
+		switch e := e.(type) {
+		case *expr.Limit:
+			inner = append(inner, renderLimit(e))
+		case *expr.Connlimit:
+			inner = append(inner, renderConnlimit(e))
+		default:
+			inner = append(inner, renderRule([]expr.Any{e}))
+		}
+	}
+	r.emit("%s @%s { %s }", verb, d.SetName, strings.Join(inner, " "))
+}
+
+// renderExthdr handles the TCP MSS option: a load feeds a later comparison,
+// a write prints the statement with the value held by its source register.
+func (r *ruleRenderer) renderExthdr(e *expr.Exthdr) {
+	name := fmt.Sprintf("tcp option %d", e.Type)
+	if e.Op == expr.ExthdrOpTcpopt && e.Type == tcpOptionMaxseg && e.Offset == 2 && e.Len == 2 {
+		name = "tcp option maxseg size"
+	}
+	if e.SourceRegister == 0 {
+		r.regs[e.DestRegister] = operand{name: name, kind: operandPort}
+		return
+	}
+	src := r.regs[e.SourceRegister]
+	value := src.name
+	if src.kind == operandImmediate && len(src.data) == 2 {
+		value = fmt.Sprintf("%d", binary.BigEndian.Uint16(src.data))
+	}
+	r.emit("%s set %s", name, value)
+}
+
+// renderNAT prints dnat/snat with the address and port loaded by the
+// preceding immediates.
+func (r *ruleRenderer) renderNAT(n *expr.NAT) string {
+	verb := "snat"
+	if n.Type == expr.NATTypeDestNAT {
+		verb = "dnat"
+	}
+	family := "ip"
+	if n.Family == unix.NFPROTO_IPV6 {
+		family = "ip6"
+	}
+	target := ""
+	if n.RegAddrMin != 0 {
+		target = net.IP(r.regs[n.RegAddrMin].data).String()
+		if family == "ip6" {
+			target = "[" + target + "]"
+		}
+	}
+	if n.RegProtoMin != 0 {
+		if port := r.regs[n.RegProtoMin].data; len(port) == 2 {
+			target += fmt.Sprintf(":%d", binary.BigEndian.Uint16(port))
+		}
+	}
+	return fmt.Sprintf("%s %s to %s", verb, family, target)
+}
+
+func renderLimit(l *expr.Limit) string {
+	units := map[expr.LimitTime]string{
+		expr.LimitTimeSecond: "second",
+		expr.LimitTimeMinute: "minute",
+		expr.LimitTimeHour:   "hour",
+		expr.LimitTimeDay:    "day",
+		expr.LimitTimeWeek:   "week",
+	}
+	over := ""
+	if l.Over {
+		over = "over "
+	}
+	if l.Type == expr.LimitTypePktBytes {
+		return fmt.Sprintf("limit rate %s%d bytes/%s burst %d bytes", over, l.Rate, units[l.Unit], l.Burst)
+	}
+	return fmt.Sprintf("limit rate %s%d/%s burst %d packets", over, l.Rate, units[l.Unit], l.Burst)
+}
+
+func renderConnlimit(c *expr.Connlimit) string {
+	if c.Flags&expr.NFT_CONNLIMIT_F_INV != 0 {
+		return fmt.Sprintf("ct count over %d", c.Count)
+	}
+	return fmt.Sprintf("ct count %d", c.Count)
+}
+
+func renderVerdict(v *expr.Verdict) string {
+	switch v.Kind {
+	case expr.VerdictAccept:
+		return "accept"
+	case expr.VerdictDrop:
+		return "drop"
+	case expr.VerdictReturn:
+		return "return"
+	case expr.VerdictContinue:
+		return "continue"
+	case expr.VerdictJump:
+		return "jump " + v.Chain
+	case expr.VerdictGoto:
+		return "goto " + v.Chain
+	default:
+		return fmt.Sprintf("verdict %d", v.Kind)
+	}
+}
+
+// cmpOperator returns the operator prefix nft prints before a value; equality
+// is implicit.
+func cmpOperator(op expr.CmpOp) string {
+	if op == expr.CmpOpEq {
+		return ""
+	}
+	return cmpSymbol(op) + " "
+}
+
+func cmpSymbol(op expr.CmpOp) string {
+	switch op {
+	case expr.CmpOpEq:
+		return "=="
+	case expr.CmpOpNeq:
+		return "!="
+	case expr.CmpOpLt:
+		return "<"
+	case expr.CmpOpLte:
+		return "<="
+	case expr.CmpOpGt:
+		return ">"
+	case expr.CmpOpGte:
+		return ">="
+	default:
+		return "?"
+	}
+}
+
+func negation(invert bool) string {
+	if invert {
+		return "!= "
+	}
+	return ""
+}
+
+func ctStateList(bits uint32) string {
+	var names []string
+	for _, state := range ctStateNames {
+		if bits&state.bit != 0 {
+			names = append(names, state.name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, ",")
+}
+
+func tcpFlagList(bits byte, sep string) string {
+	var names []string
+	for idx, name := range tcpFlagNames {
+		if bits&(1<<idx) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "0x0"
+	}
+	return strings.Join(names, sep)
+}
+
+// nativeValue decodes a host-endian register value of up to four bytes.
+func nativeValue(data []byte) uint64 {
+	switch len(data) {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(binaryutil.NativeEndian.Uint16(data))
+	case 4:
+		return uint64(binaryutil.NativeEndian.Uint32(data))
+	case 8:
+		return binaryutil.NativeEndian.Uint64(data)
+	}
+	return 0
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
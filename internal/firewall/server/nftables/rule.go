@@ -3,9 +3,18 @@ package nftables
 import (
 	nf "github.com/google/nftables"
 	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
 )
 
-func ensureBypassRule(conn *nf.Conn, table *nf.Table, chainName, setName string, ifaces []string) error {
+// ICMP types kept open by the input allow-list: error reporting needed for
+// PMTU discovery and traceroute, echo, and IPv6 neighbour/router discovery
+// and multicast listener messages.
+var (
+	essentialICMPTypes   = []byte{0, 3, 8, 11, 12}
+	essentialICMPv6Types = []byte{1, 2, 3, 4, 128, 129, 130, 131, 132, 133, 134, 135, 136, 143}
+)
+
+func ensureBypassRule(conn netlinkConn, table *nf.Table, chainName, setName string, ifaces []string) error {
 	if chainName == "" || setName == "" {
 		return nil
 	}
@@ -19,17 +28,17 @@ func ensureBypassRule(conn *nf.Conn, table *nf.Table, chainName, setName string,
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: []expr.Any{
+		Exprs: withCounter([]expr.Any{
 			&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
 			&expr.Lookup{SourceRegister: 1, SetName: ifaceSet.Name, SetID: ifaceSet.ID},
 			&expr.Verdict{Kind: expr.VerdictAccept},
-		},
+		}),
 	})
 
 	return nil
 }
 
-func addSanityRules(conn *nf.Conn, table *nf.Table, chainName string) error {
+func addSanityRules(conn netlinkConn, table *nf.Table, chainName string) error {
 	if chainName == "" {
 		return nil
 	}
@@ -39,43 +48,119 @@ func addSanityRules(conn *nf.Conn, table *nf.Table, chainName string) error {
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: ctStateDropExprs(expr.CtStateBitINVALID),
+		Exprs: withCounter(ctStateDropExprs(expr.CtStateBitINVALID)),
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: tcpNewWithoutSynExprs(),
+		Exprs: withCounter(tcpNewWithoutSynExprs()),
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: tcpFlagMaskDropExprs(0x03, 0x03, expr.CmpOpEq), // FIN|SYN
+		Exprs: withCounter(tcpFlagMaskDropExprs(0x03, 0x03, expr.CmpOpEq)), // FIN|SYN
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: tcpFlagMaskDropExprs(0x06, 0x06, expr.CmpOpEq), // SYN|RST
+		Exprs: withCounter(tcpFlagMaskDropExprs(0x06, 0x06, expr.CmpOpEq)), // SYN|RST
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: tcpFlagMaskDropExprs(0x3f, 0x00, expr.CmpOpEq), // NULL
+		Exprs: withCounter(tcpFlagMaskDropExprs(0x3f, 0x00, expr.CmpOpEq)), // NULL
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: tcpFlagMaskDropExprs(0x29, 0x29, expr.CmpOpEq), // XMAS (FIN|PSH|URG)
+		Exprs: withCounter(tcpFlagMaskDropExprs(0x29, 0x29, expr.CmpOpEq)), // XMAS (FIN|PSH|URG)
 	})
 
 	return nil
 }
 
-func addFlowOffloadRules(conn *nf.Conn, table *nf.Table, chainName, flowtableName string, lanSet *nf.Set) error {
+// addLoopbackAcceptRule accepts everything arriving on lo, so local
+// services (nginx to vtrui, the resolver) are never filtered or metered.
+func addLoopbackAcceptRule(conn netlinkConn, table *nf.Table, chainName string) {
+	if chainName == "" {
+		return
+	}
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: &nf.Chain{Name: chainName, Table: table},
+		Exprs: withCounter(iifnameAcceptExprs("lo")),
+	})
+}
+
+func addEstablishedAcceptRule(conn netlinkConn, table *nf.Table, chainName string) {
+	if chainName == "" {
+		return
+	}
+	conn.AddRule(&nf.Rule{
+		Table: table,
+		Chain: &nf.Chain{Name: chainName, Table: table},
+		Exprs: withCounter(ctStateVerdictExprs(expr.CtStateBitESTABLISHED|expr.CtStateBitRELATED, expr.VerdictAccept)),
+	})
+}
+
+// addEssentialICMPRules accepts the essential ICMP and ICMPv6 types. They
+// precede the sanity rules so ICMPv6 neighbour discovery is never caught by
+// the ct invalid drop.
+func addEssentialICMPRules(conn netlinkConn, table *nf.Table, chainName string) {
+	if chainName == "" {
+		return
+	}
+
+	chain := &nf.Chain{Name: chainName, Table: table}
+
+	for _, icmpType := range essentialICMPTypes {
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: withCounter(icmpTypeAcceptExprs(unix.IPPROTO_ICMP, icmpType)),
+		})
+	}
+	for _, icmpType := range essentialICMPv6Types {
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: withCounter(icmpTypeAcceptExprs(unix.IPPROTO_ICMPV6, icmpType)),
+		})
+	}
+}
+
+// addInputPortRules accepts new connections to the allowed TCP and UDP ports.
+func addInputPortRules(conn netlinkConn, table *nf.Table, chainName string, tcpPorts, udpPorts []uint16) error {
+	if chainName == "" {
+		return nil
+	}
+
+	chain := &nf.Chain{Name: chainName, Table: table}
+
+	for _, port := range tcpPorts {
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: withCounter(dportAcceptExprs(unix.IPPROTO_TCP, port)),
+		})
+	}
+	for _, port := range udpPorts {
+		conn.AddRule(&nf.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: withCounter(dportAcceptExprs(unix.IPPROTO_UDP, port)),
+		})
+	}
+
+	return nil
+}
+
+func addFlowOffloadRules(conn netlinkConn, table *nf.Table, chainName, flowtableName string, lanSet *nf.Set, ipv6 bool) error {
 	if chainName == "" || lanSet == nil || flowtableName == "" {
 		return nil
 	}
@@ -85,13 +170,13 @@ func addFlowOffloadRules(conn *nf.Conn, table *nf.Table, chainName, flowtableNam
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: flowOffloadExprs(lanSet, flowtableName, true),
+		Exprs: withCounter(flowOffloadExprs(lanSet, flowtableName, true, ipv6)),
 	})
 
 	conn.AddRule(&nf.Rule{
 		Table: table,
 		Chain: chain,
-		Exprs: flowOffloadExprs(lanSet, flowtableName, false),
+		Exprs: withCounter(flowOffloadExprs(lanSet, flowtableName, false, ipv6)),
 	})
 	return nil
 }
@@ -5,7 +5,7 @@ import (
 )
 
 func ensureLanCIDRSet(table *nf.Table, cfg *Config) (*nf.Set, error) {
-	conn := &nf.Conn{}
+	conn := newConn()
 
 	opts := setEnsureOptions{
 		Name:           cfg.LanSetName,
@@ -23,7 +23,26 @@ func ensureLanCIDRSet(table *nf.Table, cfg *Config) (*nf.Set, error) {
 	return ensureSet(conn, table, opts, builder)
 }
 
-func updateLanSet(conn *nf.Conn, set *nf.Set, cidrs []string) error {
+func ensureLan6CIDRSet(table *nf.Table, cfg *Config) (*nf.Set, error) {
+	conn := newConn()
+
+	opts := setEnsureOptions{
+		Name:           cfg.Lan6SetName,
+		KeyType:        nf.TypeIP6Addr,
+		Interval:       true,
+		Operation:      "nftables.ensureLan6CIDRSet",
+		Entity:         "CIDRs",
+		SetDescription: "IPv6 LAN CIDR set",
+	}
+
+	builder := func() ([]nf.SetElement, error) {
+		return cidrToElements(cfg.LanCIDRs6)
+	}
+
+	return ensureSet(conn, table, opts, builder)
+}
+
+func updateLanSet(conn netlinkConn, set *nf.Set, cidrs []string) error {
 	elements, err := cidrToElements(cidrs)
 	if err != nil {
 		return err
@@ -36,7 +55,7 @@ func updateLanSet(conn *nf.Conn, set *nf.Set, cidrs []string) error {
 	return err
 }
 
-func ensureIfaceSet(conn *nf.Conn, table *nf.Table, name string, ifaces []string) (*nf.Set, error) {
+func ensureIfaceSet(conn netlinkConn, table *nf.Table, name string, ifaces []string) (*nf.Set, error) {
 	if name == "" {
 		return nil, nil
 	}
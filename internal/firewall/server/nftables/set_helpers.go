@@ -4,15 +4,24 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"time"
 
 	apperrors "GWD/internal/errors"
 	nf "github.com/google/nftables"
 )
 
+const (
+	maxElementsPerMessage = 1024
+	maxElementsPerBatch   = 4096
+)
+
 type setEnsureOptions struct {
 	Name           string
 	KeyType        nf.SetDatatype
 	Interval       bool
+	HasTimeout     bool
+	Dynamic        bool
+	Timeout        time.Duration
 	Operation      string
 	Entity         string
 	SetDescription string
@@ -23,7 +32,7 @@ type setUpdateContext struct {
 	Entity    string
 }
 
-func ensureSet(conn *nf.Conn, table *nf.Table, opts setEnsureOptions, elementsBuilder func() ([]nf.SetElement, error)) (*nf.Set, error) {
+func ensureSet(conn netlinkConn, table *nf.Table, opts setEnsureOptions, elementsBuilder func() ([]nf.SetElement, error)) (*nf.Set, error) {
 	tableRef := &nf.Table{Name: table.Name, Family: table.Family}
 
 	set, err := findSet(conn, tableRef, opts.Name)
@@ -33,10 +42,13 @@ func ensureSet(conn *nf.Conn, table *nf.Table, opts setEnsureOptions, elementsBu
 
 	if set == nil {
 		set = &nf.Set{
-			Table:    tableRef,
-			Name:     opts.Name,
-			KeyType:  opts.KeyType,
-			Interval: opts.Interval,
+			Table:      tableRef,
+			Name:       opts.Name,
+			KeyType:    opts.KeyType,
+			Interval:   opts.Interval,
+			HasTimeout: opts.HasTimeout,
+			Dynamic:    opts.Dynamic,
+			Timeout:    opts.Timeout,
 		}
 		if err := conn.AddSet(set, nil); err != nil {
 			return nil, firewallError(opts.Operation+".addSet", fmt.Sprintf("failed to create %s", opts.SetDescription), err, apperrors.Metadata{
@@ -60,6 +72,12 @@ func ensureSet(conn *nf.Conn, table *nf.Table, opts setEnsureOptions, elementsBu
 		}
 	}
 
+	// Dynamic sets are filled from the packet path; leave their elements alone.
+	if elementsBuilder == nil {
+		set.Table = table
+		return set, nil
+	}
+
 	desired, err := elementsBuilder()
 	if err != nil {
 		return nil, err
@@ -76,7 +94,7 @@ func ensureSet(conn *nf.Conn, table *nf.Table, opts setEnsureOptions, elementsBu
 	return set, nil
 }
 
-func findSet(conn *nf.Conn, table *nf.Table, name string) (*nf.Set, error) {
+func findSet(conn netlinkConn, table *nf.Table, name string) (*nf.Set, error) {
 	sets, err := conn.GetSets(table)
 	if err != nil {
 		return nil, firewallError("nftables.findSet", "failed to enumerate sets", err, apperrors.Metadata{
@@ -91,7 +109,7 @@ func findSet(conn *nf.Conn, table *nf.Table, name string) (*nf.Set, error) {
 	return nil, nil
 }
 
-func syncSetElements(conn *nf.Conn, set *nf.Set, desired []nf.SetElement, ctx setUpdateContext) (bool, error) {
+func syncSetElements(conn netlinkConn, set *nf.Set, desired []nf.SetElement, ctx setUpdateContext) (bool, error) {
 	metadata := apperrors.Metadata{
 		"set": set.Name,
 	}
@@ -106,28 +124,46 @@ func syncSetElements(conn *nf.Conn, set *nf.Set, desired []nf.SetElement, ctx se
 
 	toAdd, toDel := diffSetElements(current, desired)
 
-	changed := false
-	if len(toDel) > 0 {
-		if err := conn.SetDeleteElements(set, toDel); err != nil {
-			return false, firewallError(ctx.Operation+".deleteElements", fmt.Sprintf("failed to prune stale %s from set", ctx.Entity), err, metadata)
-		}
-		changed = true
+	changed := len(toAdd) > 0 || len(toDel) > 0
+	if !changed {
+		return false, nil
 	}
 
-	if len(toAdd) > 0 {
-		if err := conn.SetAddElements(set, toAdd); err != nil {
-			return false, firewallError(ctx.Operation+".addElements", fmt.Sprintf("failed to add %s to set", ctx.Entity), err, metadata)
+	// Large sets (GeoIP lists) are written in chunks: one message must stay
+	// below the netlink attribute size limit and one batch below the socket
+	// buffer, so big updates span several transactions.
+	queued := 0
+	queue := func(elems []nf.SetElement, write func(*nf.Set, []nf.SetElement) error, op, message string) error {
+		for start := 0; start < len(elems); start += maxElementsPerMessage {
+			end := min(start+maxElementsPerMessage, len(elems))
+			if err := write(set, elems[start:end]); err != nil {
+				return firewallError(ctx.Operation+op, message, err, metadata)
+			}
+			queued += end - start
+			if queued >= maxElementsPerBatch {
+				if err := conn.Flush(); err != nil {
+					return firewallError(ctx.Operation+".flush", fmt.Sprintf("failed to apply %s updates to set", ctx.Entity), err, metadata)
+				}
+				queued = 0
+			}
 		}
-		changed = true
+		return nil
+	}
+
+	if err := queue(toDel, conn.SetDeleteElements, ".deleteElements", fmt.Sprintf("failed to prune stale %s from set", ctx.Entity)); err != nil {
+		return false, err
+	}
+	if err := queue(toAdd, conn.SetAddElements, ".addElements", fmt.Sprintf("failed to add %s to set", ctx.Entity)); err != nil {
+		return false, err
 	}
 
-	if changed {
+	if queued > 0 {
 		if err := conn.Flush(); err != nil {
 			return false, firewallError(ctx.Operation+".flush", fmt.Sprintf("failed to apply %s updates to set", ctx.Entity), err, metadata)
 		}
 	}
 
-	return changed, nil
+	return true, nil
 }
 
 func sortSetElements(elems []nf.SetElement) {
@@ -0,0 +1,193 @@
+package nftables
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"testing"
+
+	nf "github.com/google/nftables"
+)
+
+func ifaceElements(names ...string) []nf.SetElement {
+	elements := make([]nf.SetElement, 0, len(names))
+	for _, name := range names {
+		elements = append(elements, nf.SetElement{Key: encodeInterfaceName(name)})
+	}
+	return elements
+}
+
+func elementKeys(elements []nf.SetElement) []string {
+	keys := make([]string, 0, len(elements))
+	for _, element := range elements {
+		keys = append(keys, elementKey(element))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDiffSetElements(t *testing.T) {
+	start := nf.SetElement{Key: []byte{10, 0, 0, 0}}
+	end := nf.SetElement{Key: []byte{10, 0, 0, 0}, IntervalEnd: true}
+
+	tests := []struct {
+		name             string
+		current, desired []nf.SetElement
+		wantAdd, wantDel []nf.SetElement
+	}{
+		{
+			name:    "empty set",
+			desired: ifaceElements("eth0", "wg0"),
+			wantAdd: ifaceElements("eth0", "wg0"),
+		},
+		{
+			name:    "in sync",
+			current: ifaceElements("wg0", "eth0"),
+			desired: ifaceElements("eth0", "wg0"),
+		},
+		{
+			name:    "add and remove",
+			current: ifaceElements("eth0", "ppp0"),
+			desired: ifaceElements("eth0", "wg0"),
+			wantAdd: ifaceElements("wg0"),
+			wantDel: ifaceElements("ppp0"),
+		},
+		{
+			name:    "clear",
+			current: ifaceElements("eth0"),
+			wantDel: ifaceElements("eth0"),
+		},
+		{
+			name:    "interval end differs from start with the same key",
+			current: []nf.SetElement{start},
+			desired: []nf.SetElement{end},
+			wantAdd: []nf.SetElement{end},
+			wantDel: []nf.SetElement{start},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toAdd, toDel := diffSetElements(tt.current, tt.desired)
+			if got, want := elementKeys(toAdd), elementKeys(tt.wantAdd); !reflect.DeepEqual(got, want) {
+				t.Errorf("toAdd = %v, want %v", got, want)
+			}
+			if got, want := elementKeys(toDel), elementKeys(tt.wantDel); !reflect.DeepEqual(got, want) {
+				t.Errorf("toDel = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// newFakeSet creates an empty set in a fresh fake ruleset.
+func newFakeSet(t *testing.T, opts setEnsureOptions) (*fakeRuleset, netlinkConn, *nf.Set) {
+	t.Helper()
+	rs := useFakeRuleset(t)
+	table := &nf.Table{Name: defaultTableName, Family: nf.TableFamilyINet}
+	if err := ensureTableExists(table); err != nil {
+		t.Fatal(err)
+	}
+	conn := newConn()
+	set, err := ensureSet(conn, table, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs, conn, set
+}
+
+func TestSyncSetElements(t *testing.T) {
+	rs, conn, set := newFakeSet(t, setEnsureOptions{Name: "ifaces", KeyType: nf.TypeIFName, Operation: "test"})
+	ctx := setUpdateContext{Operation: "test", Entity: "interfaces"}
+
+	changed, err := syncSetElements(conn, set, ifaceElements("eth0", "wg0"), ctx)
+	if err != nil || !changed {
+		t.Fatalf("initial sync: changed = %v, err = %v", changed, err)
+	}
+
+	rs.elementWrites, rs.flushes = 0, 0
+	changed, err = syncSetElements(conn, set, ifaceElements("wg0", "eth0"), ctx)
+	if err != nil || changed {
+		t.Fatalf("repeated sync: changed = %v, err = %v", changed, err)
+	}
+	if rs.elementWrites != 0 || rs.flushes != 0 {
+		t.Fatalf("repeated sync wrote %d elements in %d transactions", rs.elementWrites, rs.flushes)
+	}
+
+	changed, err = syncSetElements(conn, set, ifaceElements("eth0", "ppp0"), ctx)
+	if err != nil || !changed {
+		t.Fatalf("update: changed = %v, err = %v", changed, err)
+	}
+	if rs.elementWrites != 2 {
+		t.Fatalf("update wrote %d elements, want 2 (delete wg0, add ppp0)", rs.elementWrites)
+	}
+	current, err := conn.GetSetElements(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := elementKeys(current), elementKeys(ifaceElements("eth0", "ppp0")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("set holds %v, want %v", got, want)
+	}
+}
+
+func TestSyncSetElementsSplitsLargeUpdates(t *testing.T) {
+	rs, conn, set := newFakeSet(t, setEnsureOptions{Name: "addrs", KeyType: nf.TypeIPAddr, Operation: "test"})
+	ctx := setUpdateContext{Operation: "test", Entity: "addresses"}
+
+	const count = maxElementsPerBatch + maxElementsPerMessage/2
+	desired := make([]nf.SetElement, 0, count)
+	for i := 0; i < count; i++ {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, 0x0a000000+uint32(i))
+		desired = append(desired, nf.SetElement{Key: key})
+	}
+
+	rs.flushes = 0
+	if _, err := syncSetElements(conn, set, desired, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rs.flushes != 2 {
+		t.Fatalf("update of %d elements used %d transactions, want 2", count, rs.flushes)
+	}
+	current, err := conn.GetSetElements(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != count {
+		t.Fatalf("set holds %d elements, want %d", len(current), count)
+	}
+}
+
+func TestEnsureSetCreatesOnce(t *testing.T) {
+	rs, conn, _ := newFakeSet(t, setEnsureOptions{Name: "lan", KeyType: nf.TypeIPAddr, Interval: true, Operation: "test"})
+	table := &nf.Table{Name: defaultTableName, Family: nf.TableFamilyINet}
+	opts := setEnsureOptions{Name: "lan", KeyType: nf.TypeIPAddr, Interval: true, Operation: "test", Entity: "CIDRs"}
+	build := func() ([]nf.SetElement, error) { return cidrToElements([]string{"10.0.0.0/8"}) }
+
+	if _, err := ensureSet(conn, table, opts, build); err != nil {
+		t.Fatal(err)
+	}
+	rs.flushes = 0
+	set, err := ensureSet(conn, table, opts, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.flushes != 0 {
+		t.Fatalf("second ensureSet used %d transactions, want 0", rs.flushes)
+	}
+	if set.Table != table {
+		t.Fatal("ensureSet did not attach the caller's table")
+	}
+}
+
+func TestMergeIntervalElements(t *testing.T) {
+	elements, err := cidrToElements([]string{"10.1.0.0/16", "10.0.0.0/16", "10.0.128.0/17", "192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := renderIntervals(mergeIntervalElements(elements))
+	want := []string{"10.0.0.0/15", "192.168.1.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged intervals = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	nf "github.com/google/nftables"
+)
+
+const nftBinary = "nft"
+
+// SaveTable returns an nft script that puts the managed table back into its
+// current state when loaded with RestoreTable. When the table does not exist
+// yet, the script only removes it.
+func SaveTable(cfg *Config) ([]byte, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	} else {
+		cfg = cfg.clone()
+		cfg.applyDefaults()
+	}
+
+	// "add" followed by "delete" is valid whether or not the table exists at
+	// restore time, and nft applies the whole file as one transaction.
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "add table inet %s\n", cfg.TableName)
+	fmt.Fprintf(&script, "delete table inet %s\n", cfg.TableName)
+
+	exists, err := tableExists(newConn(), cfg.TableName, nf.TableFamilyINet)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return script.Bytes(), nil
+	}
+
+	output, err := exec.Command(nftBinary, "list", "table", "inet", cfg.TableName).CombinedOutput()
+	if err != nil {
+		return nil, firewallError("nftables.SaveTable", "failed to list nftables table", err, apperrors.Metadata{
+			"table":  cfg.TableName,
+			"output": strings.TrimSpace(string(output)),
+		})
+	}
+	script.Write(output)
+	return script.Bytes(), nil
+}
+
+// RestoreTable loads a script produced by SaveTable atomically. Flowtable
+// devices that do not exist (yet) are left out, since nft refuses to load a
+// flowtable bound to a missing interface; before the network is up at boot
+// that would be wg0, ppp0 or a NIC not renamed yet. Ensure adds them back
+// once they appear.
+func RestoreTable(script []byte) error {
+	script = withPresentFlowtableDevices(script, interfaceExists)
+	cmd := exec.Command(nftBinary, "-f", "-")
+	cmd.Stdin = bytes.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return firewallError("nftables.RestoreTable", "failed to restore nftables table", err, apperrors.Metadata{
+			"output": strings.TrimSpace(string(output)),
+		})
+	}
+	return nil
+}
+
+// withPresentFlowtableDevices rewrites the "devices = { ... }" lines of an
+// nft script to the devices present reports, dropping lines left empty.
+func withPresentFlowtableDevices(script []byte, present func(string) bool) []byte {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(string(script), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "devices = {") || !strings.HasSuffix(trimmed, "}") {
+			out.WriteString(line)
+			continue
+		}
+
+		var kept []string
+		list := strings.TrimSuffix(strings.TrimPrefix(trimmed, "devices = {"), "}")
+		for _, device := range strings.Split(list, ",") {
+			device = strings.Trim(strings.TrimSpace(device), `"`)
+			if device != "" && present(device) {
+				kept = append(kept, `"`+device+`"`)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		newline := ""
+		if strings.HasSuffix(line, "\n") {
+			newline = "\n"
+		}
+		fmt.Fprintf(&out, "%sdevices = { %s }%s", indent, strings.Join(kept, ", "), newline)
+	}
+	return []byte(out.String())
+}
+
+func interfaceExists(name string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNetDir, name))
+	return err == nil
+}
@@ -0,0 +1,47 @@
+package nftables
+
+import (
+	"strings"
+	"testing"
+)
+
+const savedTable = `add table inet gwd
+delete table inet gwd
+table inet gwd {
+	flowtable gwd_ft {
+		hook ingress priority filter + -300
+		devices = { eth0, wg0 }
+	}
+
+	chain gwd_forward {
+		type filter hook forward priority filter - 151; policy accept;
+		meta l4proto { tcp, udp } flow add @gwd_ft
+	}
+}
+`
+
+// At boot the revert runs before wg0 exists; the saved devices must not make
+// the whole restore fail.
+func TestRestoreScriptDropsMissingFlowtableDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []string
+		want    string
+	}{
+		{name: "all present", devices: []string{"eth0", "wg0"}, want: "\t\tdevices = { \"eth0\", \"wg0\" }\n"},
+		{name: "wg0 missing", devices: []string{"eth0"}, want: "\t\tdevices = { \"eth0\" }\n"},
+		{name: "none present", devices: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRuleset(t, tt.devices...)
+			got := string(withPresentFlowtableDevices([]byte(savedTable), interfaceExists))
+
+			want := strings.Replace(savedTable, "\t\tdevices = { eth0, wg0 }\n", tt.want, 1)
+			if got != want {
+				t.Fatalf("restore script =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func ensureTableExists(table *nf.Table) error {
-	conn := &nf.Conn{}
+	conn := newConn()
 	exists, err := tableExists(conn, table.Name, table.Family)
 	if err != nil {
 		return err
@@ -28,7 +28,7 @@ func ensureTableExists(table *nf.Table) error {
 	return nil
 }
 
-func tableExists(conn *nf.Conn, name string, family nf.TableFamily) (bool, error) {
+func tableExists(conn netlinkConn, name string, family nf.TableFamily) (bool, error) {
 	tables, err := conn.ListTablesOfFamily(family)
 	if err != nil {
 		return false, firewallError("nftables.tableExists", "failed to list tables", err, apperrors.Metadata{
@@ -93,3 +93,20 @@ func sortedKeys(set map[string]struct{}) []string {
 	sort.Strings(keys)
 	return keys
 }
+
+func uniquePorts(ports []uint16) []uint16 {
+	set := make(map[uint16]struct{}, len(ports))
+	result := make([]uint16, 0, len(ports))
+	for _, port := range ports {
+		if port == 0 {
+			continue
+		}
+		if _, ok := set[port]; ok {
+			continue
+		}
+		set[port] = struct{}{}
+		result = append(result, port)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
@@ -0,0 +1,133 @@
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "GWD/internal/errors"
+)
+
+func (m *Menu) handleBans() error {
+	if m.bans == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"ban manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleBans")
+	}
+
+	return m.runSubMenu("Banned addresses", []MenuOption{
+		{Label: "1. Show bans", Handler: m.handleShowBans, Color: "green", Enabled: true},
+		{Label: "2. Ban address", Handler: m.handleBanAddress, Color: "red", Enabled: true},
+		{Label: "3. Unban address", Handler: m.handleUnbanAddress, Color: "green", Enabled: true},
+		{Label: "4. Whitelist address or CIDR", Handler: m.handleBanAllow, Color: "yellow", Enabled: true},
+		{Label: "5. Remove whitelist entry", Handler: m.handleBanUnallow, Color: "yellow", Enabled: true},
+		{Label: "6. Toggle nginx log watcher", Handler: m.handleToggleBanWatch, Color: "cyan", Enabled: true},
+	})
+}
+
+func (m *Menu) handleShowBans() error {
+	cfg, err := m.bans.Settings()
+	if err != nil {
+		return err
+	}
+	bans, err := m.bans.Bans()
+	if err != nil {
+		return err
+	}
+
+	m.writeLine("Log watcher: %s", onOff(cfg.Enabled && m.bans.Watching()))
+	m.writeLine("Whitelist:   %s", listOrNone(cfg.Whitelist))
+	m.writeLine("")
+	if len(bans) == 0 {
+		m.writeLine("No banned addresses")
+		return nil
+	}
+	m.writeLine("%-40s  %s", "ADDRESS", "EXPIRES IN")
+	for _, ban := range bans {
+		m.writeLine("%-40s  %s", ban.Address, ban.Expires.Truncate(time.Second))
+	}
+	return nil
+}
+
+func (m *Menu) handleBanAddress() error {
+	address, err := m.promptText("IP address to ban", "", required)
+	if err != nil {
+		return err
+	}
+	cfg, err := m.bans.Settings()
+	if err != nil {
+		return err
+	}
+	value, err := m.promptText("Ban length in minutes", strconv.Itoa(cfg.BanMinutes), func(input string) error {
+		if minutes, err := strconv.Atoi(strings.TrimSpace(input)); err != nil || minutes < 1 {
+			return errors.New("enter a positive number of minutes")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	minutes, _ := strconv.Atoi(value)
+	return m.bans.Ban(address, minutes)
+}
+
+func (m *Menu) handleUnbanAddress() error {
+	bans, err := m.bans.Bans()
+	if err != nil {
+		return err
+	}
+	if len(bans) == 0 {
+		return errors.New("no banned addresses")
+	}
+	items := make([]string, 0, len(bans))
+	for _, ban := range bans {
+		items = append(items, fmt.Sprintf("%s (%s left)", ban.Address, ban.Expires.Truncate(time.Second)))
+	}
+	idx, err := m.promptChoice("Select address to unban", items)
+	if err != nil {
+		return err
+	}
+	return m.bans.Unban(bans[idx].Address.String())
+}
+
+func (m *Menu) handleBanAllow() error {
+	entry, err := m.promptText("Address or CIDR that is never banned", "", required)
+	if err != nil {
+		return err
+	}
+	return m.bans.Allow(entry)
+}
+
+func (m *Menu) handleBanUnallow() error {
+	cfg, err := m.bans.Settings()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Whitelist) == 0 {
+		return errors.New("whitelist is empty")
+	}
+	idx, err := m.promptChoice("Select entry", cfg.Whitelist)
+	if err != nil {
+		return err
+	}
+	return m.bans.Unallow(cfg.Whitelist[idx])
+}
+
+func (m *Menu) handleToggleBanWatch() error {
+	cfg, err := m.bans.Settings()
+	if err != nil {
+		return err
+	}
+	enable := !cfg.Enabled
+	if !m.promptConfirm(fmt.Sprintf("Turn the nginx log watcher %s", onOff(enable))) {
+		return nil
+	}
+	return m.bans.SetWatching(enable)
+}
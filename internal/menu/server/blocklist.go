@@ -0,0 +1,129 @@
+package menu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"GWD/internal/blocklist"
+	apperrors "GWD/internal/errors"
+)
+
+func (m *Menu) handleBlocklist() error {
+	if m.blocklist == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"blocklist manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleBlocklist")
+	}
+
+	return m.runSubMenu("DNS blocklists", []MenuOption{
+		{Label: "1. Statistics", Handler: m.handleBlocklistStats, Color: "green", Enabled: true},
+		{Label: "2. Add source", Handler: m.handleAddBlocklistSource, Color: "green", Enabled: true},
+		{Label: "3. Remove source", Handler: m.handleRemoveBlocklistSource, Color: "red", Enabled: true},
+		{Label: "4. Allow domain", Handler: m.handleAllowDomain, Color: "yellow", Enabled: true},
+		{Label: "5. Remove allowed domain", Handler: m.handleUnallowDomain, Color: "yellow", Enabled: true},
+		{Label: "6. Refresh now", Handler: m.handleRefreshBlocklist, Color: "green", Enabled: true},
+	})
+}
+
+func (m *Menu) handleBlocklistStats() error {
+	cfg, err := m.blocklist.Blocklist()
+	if err != nil {
+		return err
+	}
+	m.printBlocklistStats(cfg.Stats, len(cfg.Sources))
+	if len(cfg.Allowlist) > 0 {
+		m.writeLine("Allowlist: %s", listOrNone(cfg.Allowlist))
+	}
+	return nil
+}
+
+func (m *Menu) handleAddBlocklistSource() error {
+	source, err := m.promptText("List URL or absolute file path (hosts or AdBlock format)", "", required)
+	if err != nil {
+		return err
+	}
+	return m.blocklist.AddSource(context.Background(), source)
+}
+
+func (m *Menu) handleRemoveBlocklistSource() error {
+	cfg, err := m.blocklist.Blocklist()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Sources) == 0 {
+		return errors.New("no blocklist sources configured")
+	}
+	idx, err := m.promptChoice("Select source to remove", cfg.Sources)
+	if err != nil {
+		return err
+	}
+	if !m.promptConfirm(fmt.Sprintf("Remove %s", cfg.Sources[idx])) {
+		return nil
+	}
+	return m.blocklist.RemoveSource(context.Background(), cfg.Sources[idx])
+}
+
+func (m *Menu) handleAllowDomain() error {
+	domain, err := m.promptText("Domain to allow (subdomains included)", "", required)
+	if err != nil {
+		return err
+	}
+	return m.blocklist.Allow(context.Background(), domain)
+}
+
+func (m *Menu) handleUnallowDomain() error {
+	cfg, err := m.blocklist.Blocklist()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Allowlist) == 0 {
+		return errors.New("allowlist is empty")
+	}
+	idx, err := m.promptChoice("Select domain", cfg.Allowlist)
+	if err != nil {
+		return err
+	}
+	return m.blocklist.Unallow(context.Background(), cfg.Allowlist[idx])
+}
+
+func (m *Menu) handleRefreshBlocklist() error {
+	stats, err := m.blocklist.Refresh(context.Background())
+	if err != nil {
+		return err
+	}
+	cfg, err := m.blocklist.Blocklist()
+	if err != nil {
+		return err
+	}
+	m.printBlocklistStats(stats, len(cfg.Sources))
+	return nil
+}
+
+func (m *Menu) printBlocklistStats(stats blocklist.Stats, sources int) {
+	if sources == 0 {
+		m.writeLine("No blocklist sources configured")
+		return
+	}
+	if stats.UpdatedAt.IsZero() {
+		m.writeLine("Blocklist has not been compiled yet")
+		return
+	}
+	m.writeLine("%-60s  %s", "SOURCE", "DOMAINS")
+	for _, source := range stats.Sources {
+		count := fmt.Sprintf("%d", source.Domains)
+		if source.Error != "" {
+			count = "failed: " + source.Error
+		}
+		m.writeLine("%-60s  %s", source.Source, count)
+	}
+	m.writeLine("")
+	m.writeLine("Blocked domains:   %d", stats.Blocked)
+	m.writeLine("Allowed domains:   %d", stats.Allowed)
+	m.writeLine("Last refresh:      %s", stats.UpdatedAt.Format("2006-01-02 15:04:05"))
+}
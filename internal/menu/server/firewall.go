@@ -0,0 +1,71 @@
+package menu
+
+import (
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// maxSetElements caps the elements shown per set; large GeoIP sets would
+// otherwise scroll the rules away.
+const maxSetElements = 10
+
+func (m *Menu) handleFirewallStatus() error {
+	if m.firewall == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"firewall inspector is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleFirewallStatus")
+	}
+
+	report, err := m.firewall.Inspect()
+	if err != nil {
+		return err
+	}
+
+	if len(report.Chains) == 0 && len(report.Sets) == 0 {
+		m.writeLine("Firewall table %s is not loaded", report.Table)
+		m.waitForUserInput("\nPress Enter to continue...")
+		return nil
+	}
+
+	for _, chain := range report.Chains {
+		if chain.Hook != "" {
+			m.writeLine("Chain %s (hook %s, priority %d, policy %s)", chain.Name, chain.Hook, chain.Priority, chain.Policy)
+		} else {
+			m.writeLine("Chain %s", chain.Name)
+		}
+		m.writeLine("  %12s  %14s  %s", "PACKETS", "BYTES", "RULE")
+		for _, rule := range chain.Rules {
+			m.writeLine("  %12d  %14d  %s", rule.Packets, rule.Bytes, rule.Rule)
+		}
+		m.writeLine("")
+	}
+
+	for _, set := range report.Sets {
+		flags := ""
+		if len(set.Flags) > 0 {
+			flags = ", " + strings.Join(set.Flags, ",")
+		}
+		m.writeLine("Set %s (%s%s): %d elements", set.Name, set.Type, flags, set.Count)
+		for idx, element := range set.Elements {
+			if idx == maxSetElements {
+				m.writeLine("  ... %d more", set.Count-idx)
+				break
+			}
+			m.writeLine("  %s", element)
+		}
+	}
+
+	for _, ft := range report.Flowtables {
+		m.writeLine("")
+		m.writeLine("Flowtable %s devices: %s", ft.Name, listOrNone(ft.Devices))
+	}
+
+	m.waitForUserInput("\nPress Enter to continue...")
+	return nil
+}
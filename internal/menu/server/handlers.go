@@ -1,6 +1,9 @@
 package menu
 
 import (
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
 	apperrors "GWD/internal/errors"
 )
 
@@ -36,7 +39,50 @@ func (m *Menu) handleInstallGWD() error {
 		domainInfo.CloudflareConfig = cf
 	}
 
-	m.logger.Info("Domain: %s, Port: %s", domainInfo.Domain, domainInfo.Port)
+	inbounds, err := m.promptInbounds()
+	if err != nil {
+		return apperrors.New(
+			apperrors.ErrCategoryValidation,
+			apperrors.CodeValidationGeneric,
+			"failed to capture inbound selection",
+			err,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleInstallGWD")
+	}
+	domainInfo.Inbounds = inbounds
+
+	resolvers := configserver.DNSResolvers()
+	resolverIdx, err := m.promptChoice("Select local DNS resolver", resolvers)
+	if err != nil {
+		return apperrors.New(
+			apperrors.ErrCategoryValidation,
+			apperrors.CodeValidationGeneric,
+			"failed to capture DNS resolver selection",
+			err,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleInstallGWD")
+	}
+	domainInfo.Resolver = resolvers[resolverIdx]
+
+	dohPaths, err := m.promptText("DoH paths (comma separated)", "/dq", func(value string) error {
+		_, err := configserver.NormalizeDoHOptions(configserver.DoHOptions{Paths: strings.Split(value, ",")})
+		return err
+	})
+	if err != nil {
+		return apperrors.New(
+			apperrors.ErrCategoryValidation,
+			apperrors.CodeValidationGeneric,
+			"failed to capture DoH paths",
+			err,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleInstallGWD")
+	}
+	domainInfo.DoHPaths = strings.Split(dohPaths, ",")
+
+	m.logger.Info("Domain: %s, Port: %s, Resolver: %s, DoH: %s", domainInfo.Domain, domainInfo.Port, domainInfo.Resolver, dohPaths)
 
 	if m.installHandler == nil {
 		return apperrors.New(
@@ -64,3 +110,20 @@ func (m *Menu) handleInstallGWD() error {
 
 	return nil
 }
+
+func (m *Menu) handleShowNodeInfo() error {
+	infos, err := m.nodeInfo.NodeInfo()
+	if err != nil {
+		return err
+	}
+
+	if len(infos) == 0 {
+		m.writeLine("No vtrui users configured; add one from \"Manage users\"")
+	}
+	for _, info := range infos {
+		m.printer.PrintNodeInfo(info)
+	}
+
+	m.waitForUserInput("\nPress Enter to continue...")
+	return nil
+}
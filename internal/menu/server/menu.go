@@ -1,11 +1,14 @@
 package menu
 
 import (
+	"errors"
 	"fmt"
 
 	"GWD/internal/logger"
 	"GWD/internal/system"
 	ui "GWD/internal/ui/server"
+
+	"github.com/manifoldco/promptui"
 )
 
 // Menu coordinates interactive workflow for the server deployment UI.
@@ -16,6 +19,15 @@ type Menu struct {
 	printer        *ui.Printer
 	sysProbe       SystemProbe
 	installHandler func(*DomainInfo) error
+	userManager    UserManager
+	nodeInfo       NodeInfoProvider
+	routing        RoutingManager
+	warp           WarpManager
+	forwards       PortForwardManager
+	traffic        TrafficManager
+	blocklist      BlocklistManager
+	bans           BanManager
+	firewall       FirewallInspector
 }
 
 // NewMenu creates a new menu manager instance.
@@ -41,6 +53,51 @@ func (m *Menu) SetInstallHandler(handler func(*DomainInfo) error) {
 	m.installHandler = handler
 }
 
+// SetUserManager registers the backend used by the user management entries.
+func (m *Menu) SetUserManager(manager UserManager) {
+	m.userManager = manager
+}
+
+// SetNodeInfoProvider registers the backend used by the node info entry.
+func (m *Menu) SetNodeInfoProvider(provider NodeInfoProvider) {
+	m.nodeInfo = provider
+}
+
+// SetRoutingManager registers the backend used by the routing rules entry.
+func (m *Menu) SetRoutingManager(manager RoutingManager) {
+	m.routing = manager
+}
+
+// SetWarpManager registers the backend used by the WARP upstream entry.
+func (m *Menu) SetWarpManager(manager WarpManager) {
+	m.warp = manager
+}
+
+// SetPortForwardManager registers the backend used by the port forwarding entry.
+func (m *Menu) SetPortForwardManager(manager PortForwardManager) {
+	m.forwards = manager
+}
+
+// SetTrafficManager registers the backend used by the traffic statistics entry.
+func (m *Menu) SetTrafficManager(manager TrafficManager) {
+	m.traffic = manager
+}
+
+// SetBlocklistManager registers the backend used by the DNS blocklist entry.
+func (m *Menu) SetBlocklistManager(manager BlocklistManager) {
+	m.blocklist = manager
+}
+
+// SetBanManager registers the backend used by the banned addresses entry.
+func (m *Menu) SetBanManager(manager BanManager) {
+	m.bans = manager
+}
+
+// SetFirewallInspector registers the backend used by the firewall status entry.
+func (m *Menu) SetFirewallInspector(inspector FirewallInspector) {
+	m.firewall = inspector
+}
+
 // ShowMainMenu displays the interactive menu until the user quits.
 func (m *Menu) ShowMainMenu() error {
 	for {
@@ -76,12 +133,108 @@ func (m *Menu) buildMenuOptions() []MenuOption {
 			Color:       "green",
 			Enabled:     true,
 		},
+		{
+			Label:       "2. Manage users",
+			Description: "Add, remove, list or rename vtrui client accounts",
+			Handler:     m.handleManageUsers,
+			Color:       "cyan",
+			Enabled:     m.userManager != nil,
+		},
+		{
+			Label:       "3. Show node info",
+			Description: "Print share links and QR codes for each user",
+			Handler:     m.handleShowNodeInfo,
+			Color:       "cyan",
+			Enabled:     m.nodeInfo != nil,
+		},
+		{
+			Label:       "4. Routing rules",
+			Description: "Block lists, geo rules and per-domain outbound overrides",
+			Handler:     m.handleRoutingRules,
+			Color:       "cyan",
+			Enabled:     m.routing != nil,
+		},
+		{
+			Label:       "5. WARP upstream",
+			Description: "Enable or disable the Cloudflare WARP WireGuard outbound",
+			Handler:     m.handleWarp,
+			Color:       "cyan",
+			Enabled:     m.warp != nil,
+		},
+		{
+			Label:       "6. Port forwarding",
+			Description: "HAProxy TCP forwards from local ports to remote hosts",
+			Handler:     m.handlePortForwarding,
+			Color:       "cyan",
+			Enabled:     m.forwards != nil,
+		},
+		{
+			Label:       "7. Traffic statistics",
+			Description: "Per-user usage report and monthly quotas",
+			Handler:     m.handleTraffic,
+			Color:       "cyan",
+			Enabled:     m.traffic != nil,
+		},
+		{
+			Label:       "8. DNS blocklists",
+			Description: "Ad/tracker blocking in the local resolver",
+			Handler:     m.handleBlocklist,
+			Color:       "cyan",
+			Enabled:     m.blocklist != nil,
+		},
+		{
+			Label:       "9. Banned addresses",
+			Description: "Firewall bans fed by the nginx log watcher",
+			Handler:     m.handleBans,
+			Color:       "cyan",
+			Enabled:     m.bans != nil,
+		},
+		{
+			Label:       "10. Firewall status",
+			Description: "Chains, rules with counters, sets and flowtable devices",
+			Handler:     m.handleFirewallStatus,
+			Color:       "cyan",
+			Enabled:     m.firewall != nil,
+		},
 	}
 
 	// Placeholder for future non-container specific options.
 	return options
 }
 
+// runSubMenu shows options until the user picks "Back" or presses Ctrl+C.
+func (m *Menu) runSubMenu(title string, options []MenuOption) error {
+	options = append(options, MenuOption{
+		Label:   fmt.Sprintf("%d. Back", len(options)+1),
+		Color:   "",
+		Enabled: true,
+	})
+
+	for {
+		m.clearScreen()
+		m.printer.PrintSeparator("=", 57)
+		m.writeLine("%s", title)
+		m.printer.PrintSeparator("=", 57)
+
+		selected, err := m.promptUserSelection(options)
+		if err != nil {
+			if errors.Is(err, promptui.ErrInterrupt) {
+				return nil
+			}
+			return fmt.Errorf("failed to process user input: %w", err)
+		}
+
+		handler := options[selected].Handler
+		if handler == nil {
+			return nil
+		}
+		if err := handler(); err != nil {
+			m.logger.Error("Operation failed: %v", err)
+		}
+		m.waitForUserInput("\nPress Enter to continue...")
+	}
+}
+
 func (m *Menu) clearScreen() {
 	fmt.Print("\033[H\033[2J")
 }
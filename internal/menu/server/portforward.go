@@ -0,0 +1,133 @@
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+)
+
+func (m *Menu) handlePortForwarding() error {
+	if m.forwards == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"port forward manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handlePortForwarding")
+	}
+
+	return m.runSubMenu("HAProxy TCP port forwarding", []MenuOption{
+		{Label: "1. List forwards", Handler: m.handleListForwards, Color: "green", Enabled: true},
+		{Label: "2. Add forward", Handler: m.handleAddForward, Color: "green", Enabled: true},
+		{Label: "3. Remove forward", Handler: m.handleRemoveForward, Color: "red", Enabled: true},
+	})
+}
+
+func (m *Menu) handleListForwards() error {
+	forwards, err := m.forwards.ListForwards()
+	if err != nil {
+		return err
+	}
+	m.printForwards(forwards)
+	return nil
+}
+
+func (m *Menu) handleAddForward() error {
+	listenPort, err := m.promptPort("Local listen port", "")
+	if err != nil {
+		return err
+	}
+	target, err := m.promptText("Target host", "", required)
+	if err != nil {
+		return err
+	}
+	targetPort, err := m.promptPort("Target port", strconv.Itoa(listenPort))
+	if err != nil {
+		return err
+	}
+
+	proxyOptions := []string{"None", "PROXY protocol v1", "PROXY protocol v2"}
+	proxyValues := []string{configserver.ProxyProtocolNone, configserver.ProxyProtocolV1, configserver.ProxyProtocolV2}
+	idx, err := m.promptChoice("Send PROXY protocol header", proxyOptions)
+	if err != nil {
+		return err
+	}
+
+	name, err := m.promptText("Name (optional)", "", nil)
+	if err != nil {
+		return err
+	}
+
+	fwd, err := m.forwards.AddForward(configserver.PortForward{
+		Name:          name,
+		ListenPort:    listenPort,
+		TargetHost:    target,
+		TargetPort:    targetPort,
+		ProxyProtocol: proxyValues[idx],
+	})
+	if err != nil {
+		return err
+	}
+	m.printForwards([]configserver.PortForward{fwd})
+	return nil
+}
+
+func (m *Menu) handleRemoveForward() error {
+	forwards, err := m.forwards.ListForwards()
+	if err != nil {
+		return err
+	}
+	if len(forwards) == 0 {
+		return errors.New("no port forwards configured")
+	}
+
+	items := make([]string, 0, len(forwards))
+	for _, fwd := range forwards {
+		items = append(items, fmt.Sprintf("%-20s :%d -> %s", fwd.Name, fwd.ListenPort, fwd.TargetAddress()))
+	}
+	idx, err := m.promptChoice("Select forward to remove", items)
+	if err != nil {
+		return err
+	}
+	if !m.promptConfirm(fmt.Sprintf("Remove forward %s", forwards[idx].Name)) {
+		return nil
+	}
+
+	_, err = m.forwards.RemoveForward(forwards[idx].Name)
+	return err
+}
+
+func (m *Menu) promptPort(label, defaultValue string) (int, error) {
+	value, err := m.promptText(label, defaultValue, func(input string) error {
+		port, err := strconv.Atoi(strings.TrimSpace(input))
+		if err != nil || port < 1 || port > 65535 {
+			return errors.New("port must be between 1 and 65535")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func (m *Menu) printForwards(forwards []configserver.PortForward) {
+	if len(forwards) == 0 {
+		m.writeLine("No port forwards configured")
+		return
+	}
+	m.writeLine("%-20s  %-6s  %-30s  %s", "NAME", "PORT", "TARGET", "PROXY")
+	for _, fwd := range forwards {
+		proxy := fwd.ProxyProtocol
+		if proxy == "" {
+			proxy = "-"
+		}
+		m.writeLine("%-20s  %-6d  %-30s  %s", fwd.Name, fwd.ListenPort, fwd.TargetAddress(), proxy)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"strings"
 
+	configserver "GWD/internal/configurator/server"
+
 	"github.com/manifoldco/promptui"
 	runewidth "github.com/mattn/go-runewidth"
 )
@@ -183,6 +185,96 @@ func (m *Menu) promptCloudflareConfig() (*CloudflareConfig, error) {
 	return &CloudflareConfig{APIKey: apiKey, Email: email}, nil
 }
 
+func (m *Menu) promptText(label, defaultValue string, validate func(string) error) (string, error) {
+	prompt := promptui.Prompt{
+		Label:    label,
+		Default:  defaultValue,
+		Validate: validate,
+	}
+
+	value, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func (m *Menu) promptConfirm(label string) bool {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	_, err := prompt.Run()
+	return err == nil
+}
+
+func (m *Menu) promptChoice(label string, items []string) (int, error) {
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+		Size:  10,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}:",
+			Active:   "▶ {{ . | cyan }}",
+			Inactive: "  {{ . }}",
+			Selected: "✅ {{ . | green }}",
+		},
+	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		return -1, err
+	}
+	return index, nil
+}
+
+// promptInbounds asks for one or more protocol/transport combinations that
+// will run side by side behind nginx.
+func (m *Menu) promptInbounds() ([]configserver.VtruiInboundSpec, error) {
+	protocols := configserver.VtruiProtocols()
+	transports := configserver.VtruiTransports()
+	var specs []configserver.VtruiInboundSpec
+	usedPaths := make(map[string]struct{})
+
+	for {
+		protocolIdx, err := m.promptChoice("Select vtrui protocol", protocols)
+		if err != nil {
+			return nil, err
+		}
+		transportIdx, err := m.promptChoice("Select transport", transports)
+		if err != nil {
+			return nil, err
+		}
+
+		protocol := protocols[protocolIdx]
+		transport := transports[transportIdx]
+		path, err := m.promptText("Public path", configserver.DefaultVtruiInboundPath(protocol, transport), func(input string) error {
+			input = strings.TrimSpace(input)
+			if !strings.HasPrefix(input, "/") {
+				return errors.New("path must start with /")
+			}
+			if _, used := usedPaths[input]; used {
+				return errors.New("path already used by another inbound")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		usedPaths[path] = struct{}{}
+
+		specs = append(specs, configserver.VtruiInboundSpec{
+			Protocol:  protocol,
+			Transport: transport,
+			Path:      path,
+		})
+
+		if !m.promptConfirm("Add another inbound") {
+			return specs, nil
+		}
+	}
+}
+
 func (m *Menu) waitForUserInput(message string) {
 	prompt := promptui.Prompt{Label: message}
 	_, _ = prompt.Run()
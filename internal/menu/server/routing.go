@@ -0,0 +1,178 @@
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+)
+
+func (m *Menu) handleRoutingRules() error {
+	if m.routing == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"routing manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleRoutingRules")
+	}
+
+	return m.runSubMenu("vtrui routing rules", []MenuOption{
+		{Label: "1. Show rules", Handler: m.handleShowRouting, Color: "green", Enabled: true},
+		{Label: "2. Toggle private IP blocking", Handler: m.toggleRouting(func(p *configserver.VtruiRoutingPolicy) *bool { return &p.BlockPrivateIP }), Color: "yellow", Enabled: true},
+		{Label: "3. Toggle ads/tracking blocking", Handler: m.toggleRouting(func(p *configserver.VtruiRoutingPolicy) *bool { return &p.BlockAds }), Color: "yellow", Enabled: true},
+		{Label: "4. Toggle BitTorrent blocking", Handler: m.toggleRouting(func(p *configserver.VtruiRoutingPolicy) *bool { return &p.BlockBitTorrent }), Color: "yellow", Enabled: true},
+		{Label: "5. Edit blocked geoip codes", Handler: m.handleEditBlockedGeoIP, Color: "yellow", Enabled: true},
+		{Label: "6. Edit blocked geosite categories", Handler: m.handleEditBlockedGeoSite, Color: "yellow", Enabled: true},
+		{Label: "7. Add domain rule", Handler: m.handleAddDomainRule, Color: "green", Enabled: true},
+		{Label: "8. Remove domain rule", Handler: m.handleRemoveDomainRule, Color: "red", Enabled: true},
+	})
+}
+
+func (m *Menu) handleShowRouting() error {
+	policy, err := m.routing.RoutingPolicy()
+	if err != nil {
+		return err
+	}
+	m.printRouting(policy)
+	return nil
+}
+
+func (m *Menu) toggleRouting(field func(*configserver.VtruiRoutingPolicy) *bool) func() error {
+	return func() error {
+		return m.updateRouting(func(policy *configserver.VtruiRoutingPolicy) error {
+			value := field(policy)
+			*value = !*value
+			return nil
+		})
+	}
+}
+
+func (m *Menu) handleEditBlockedGeoIP() error {
+	return m.updateRouting(func(policy *configserver.VtruiRoutingPolicy) error {
+		input, err := m.promptText("Blocked geoip codes (comma separated, e.g. cn,ir)", strings.Join(policy.BlockGeoIP, ","), nil)
+		if err != nil {
+			return err
+		}
+		policy.BlockGeoIP = splitList(input)
+		return nil
+	})
+}
+
+func (m *Menu) handleEditBlockedGeoSite() error {
+	return m.updateRouting(func(policy *configserver.VtruiRoutingPolicy) error {
+		input, err := m.promptText("Blocked geosite categories (comma separated, e.g. category-porn)", strings.Join(policy.BlockGeoSite, ","), nil)
+		if err != nil {
+			return err
+		}
+		policy.BlockGeoSite = splitList(input)
+		return nil
+	})
+}
+
+func (m *Menu) handleAddDomainRule() error {
+	tags, err := m.routing.OutboundTags()
+	if err != nil {
+		return err
+	}
+
+	return m.updateRouting(func(policy *configserver.VtruiRoutingPolicy) error {
+		domain, err := m.promptText("Domain (plain, or domain:/full:/keyword:/regexp:/geosite: prefix)", "", func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("domain is required")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		idx, err := m.promptChoice("Route to outbound", tags)
+		if err != nil {
+			return err
+		}
+
+		policy.DomainRules = append(policy.DomainRules, configserver.VtruiDomainRule{Domain: domain, Outbound: tags[idx]})
+		return nil
+	})
+}
+
+func (m *Menu) handleRemoveDomainRule() error {
+	return m.updateRouting(func(policy *configserver.VtruiRoutingPolicy) error {
+		if len(policy.DomainRules) == 0 {
+			return errors.New("no domain rules configured")
+		}
+
+		items := make([]string, 0, len(policy.DomainRules))
+		for _, rule := range policy.DomainRules {
+			items = append(items, fmt.Sprintf("%s -> %s", rule.Domain, rule.Outbound))
+		}
+		idx, err := m.promptChoice("Select rule to remove", items)
+		if err != nil {
+			return err
+		}
+
+		policy.DomainRules = append(policy.DomainRules[:idx], policy.DomainRules[idx+1:]...)
+		return nil
+	})
+}
+
+// updateRouting loads the policy, applies edit and saves the result.
+func (m *Menu) updateRouting(edit func(*configserver.VtruiRoutingPolicy) error) error {
+	policy, err := m.routing.RoutingPolicy()
+	if err != nil {
+		return err
+	}
+	if err := edit(&policy); err != nil {
+		return err
+	}
+	if err := m.routing.UpdateRouting(policy); err != nil {
+		return err
+	}
+	m.printRouting(policy)
+	return nil
+}
+
+func (m *Menu) printRouting(policy configserver.VtruiRoutingPolicy) {
+	m.writeLine("Block private IPs:   %s", onOff(policy.BlockPrivateIP))
+	m.writeLine("Block ads/tracking:  %s", onOff(policy.BlockAds))
+	m.writeLine("Block BitTorrent:    %s", onOff(policy.BlockBitTorrent))
+	m.writeLine("Blocked geoip:       %s", listOrNone(policy.BlockGeoIP))
+	m.writeLine("Blocked geosite:     %s", listOrNone(policy.BlockGeoSite))
+	if len(policy.DomainRules) == 0 {
+		m.writeLine("Domain rules:        none")
+		return
+	}
+	m.writeLine("Domain rules:")
+	for _, rule := range policy.DomainRules {
+		m.writeLine("  %-40s -> %s", rule.Domain, rule.Outbound)
+	}
+}
+
+func splitList(input string) []string {
+	var values []string
+	for _, value := range strings.Split(input, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
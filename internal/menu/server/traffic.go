@@ -0,0 +1,127 @@
+package menu
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+	"GWD/internal/traffic"
+)
+
+const bytesPerGiB = 1 << 30
+
+func (m *Menu) handleTraffic() error {
+	if m.traffic == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"traffic manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleTraffic")
+	}
+
+	return m.runSubMenu("Traffic statistics", []MenuOption{
+		{Label: "1. Current month report", Handler: func() error { return m.showTrafficReport("") }, Color: "green", Enabled: true},
+		{Label: "2. Previous months", Handler: m.handleTrafficHistory, Color: "green", Enabled: true},
+		{Label: "3. Set monthly quota", Handler: m.handleSetQuota, Color: "yellow", Enabled: true},
+		{Label: "4. Resume suspended user", Handler: m.handleResumeUser, Color: "yellow", Enabled: true},
+	})
+}
+
+func (m *Menu) handleTrafficHistory() error {
+	periods, err := m.traffic.Periods()
+	if err != nil {
+		return err
+	}
+	if len(periods) == 0 {
+		return errors.New("no traffic recorded yet")
+	}
+	idx, err := m.promptChoice("Select month", periods)
+	if err != nil {
+		return err
+	}
+	return m.showTrafficReport(periods[idx])
+}
+
+func (m *Menu) showTrafficReport(period string) error {
+	rows, err := m.traffic.Report(period)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		m.writeLine("No traffic recorded")
+		return nil
+	}
+
+	m.writeLine("%-24s  %12s  %12s  %12s  %12s  %s", "EMAIL", "UPLINK", "DOWNLINK", "TOTAL", "QUOTA", "STATUS")
+	for _, row := range rows {
+		quota, status := "-", "active"
+		if row.Quota > 0 {
+			quota = traffic.FormatBytes(row.Quota)
+		}
+		if row.Suspended {
+			status = "suspended"
+		}
+		m.writeLine("%-24s  %12s  %12s  %12s  %12s  %s", row.Email,
+			traffic.FormatBytes(row.Usage.Uplink),
+			traffic.FormatBytes(row.Usage.Downlink),
+			traffic.FormatBytes(row.Usage.Total()),
+			quota,
+			status,
+		)
+	}
+	return nil
+}
+
+func (m *Menu) handleSetQuota() error {
+	if m.userManager == nil {
+		return errors.New("user manager is not configured")
+	}
+	user, err := m.selectUser("Select user")
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return errors.New("quotas require an email tag; rename the user first")
+	}
+
+	value, err := m.promptText("Monthly quota in GiB (0 removes the quota)", "0", func(input string) error {
+		gib, err := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		if err != nil || gib < 0 {
+			return errors.New("enter a non-negative number")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	gib, _ := strconv.ParseFloat(value, 64)
+
+	return m.traffic.SetQuota(user.Email, int64(gib*bytesPerGiB))
+}
+
+func (m *Menu) handleResumeUser() error {
+	rows, err := m.traffic.Report("")
+	if err != nil {
+		return err
+	}
+
+	var suspended []string
+	for _, row := range rows {
+		if row.Suspended {
+			suspended = append(suspended, row.Email)
+		}
+	}
+	if len(suspended) == 0 {
+		return errors.New("no suspended users")
+	}
+
+	idx, err := m.promptChoice("Select user to resume", suspended)
+	if err != nil {
+		return err
+	}
+	return m.traffic.ResumeUser(suspended[idx])
+}
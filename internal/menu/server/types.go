@@ -1,5 +1,16 @@
 package menu
 
+import (
+	"context"
+
+	"GWD/internal/banwatch"
+	"GWD/internal/blocklist"
+	configserver "GWD/internal/configurator/server"
+	"GWD/internal/firewall/server/nftables"
+	"GWD/internal/traffic"
+	ui "GWD/internal/ui/server"
+)
+
 // MenuOption represents a selectable option shown to the user.
 type MenuOption struct {
 	Label       string
@@ -15,6 +26,9 @@ type DomainInfo struct {
 	TopDomain        string
 	Port             string
 	CloudflareConfig *CloudflareConfig
+	Inbounds         []configserver.VtruiInboundSpec
+	Resolver         string
+	DoHPaths         []string
 }
 
 // CloudflareConfig stores Cloudflare API credentials for certificate automation.
@@ -22,3 +36,73 @@ type CloudflareConfig struct {
 	APIKey string
 	Email  string
 }
+
+// UserManager manages the vtrui client accounts exposed through the menu.
+type UserManager interface {
+	ListUsers() ([]configserver.VtruiUser, error)
+	AddUser(email string) (configserver.VtruiUser, error)
+	RemoveUser(ref string) (configserver.VtruiUser, error)
+	RenameUser(ref, email string) (configserver.VtruiUser, error)
+}
+
+// NodeInfoProvider supplies the connection details shown by "Show node info".
+type NodeInfoProvider interface {
+	NodeInfo() ([]ui.NodeInfo, error)
+}
+
+// RoutingManager edits the vtrui routing policy exposed through the menu.
+type RoutingManager interface {
+	RoutingPolicy() (configserver.VtruiRoutingPolicy, error)
+	OutboundTags() ([]string, error)
+	UpdateRouting(policy configserver.VtruiRoutingPolicy) error
+}
+
+// WarpManager toggles the Cloudflare WARP (WireGuard) upstream.
+type WarpManager interface {
+	WarpEnabled() (bool, error)
+	LoadWgcfProfile(path string) (configserver.WireGuardConfig, error)
+	EnableWarp(cfg configserver.WireGuardConfig, domains []string) error
+	DisableWarp() error
+}
+
+// PortForwardManager manages HAProxy TCP port forwards exposed through the menu.
+type PortForwardManager interface {
+	ListForwards() ([]configserver.PortForward, error)
+	AddForward(fwd configserver.PortForward) (configserver.PortForward, error)
+	RemoveForward(ref string) (configserver.PortForward, error)
+}
+
+// TrafficManager reports per-user traffic and manages monthly quotas.
+type TrafficManager interface {
+	Report(period string) ([]traffic.UserReport, error)
+	Periods() ([]string, error)
+	SetQuota(email string, bytes int64) error
+	ResumeUser(email string) error
+}
+
+// BlocklistManager manages DNS blocklist sources, the allowlist and refreshes.
+type BlocklistManager interface {
+	Blocklist() (*blocklist.Config, error)
+	AddSource(ctx context.Context, source string) error
+	RemoveSource(ctx context.Context, source string) error
+	Allow(ctx context.Context, domain string) error
+	Unallow(ctx context.Context, domain string) error
+	Refresh(ctx context.Context) (blocklist.Stats, error)
+}
+
+// BanManager manages the firewall ban sets and the nginx log watcher.
+type BanManager interface {
+	Settings() (*banwatch.Config, error)
+	Bans() ([]nftables.Ban, error)
+	Ban(address string, minutes int) error
+	Unban(address string) error
+	Allow(entry string) error
+	Unallow(entry string) error
+	SetWatching(enabled bool) error
+	Watching() bool
+}
+
+// FirewallInspector reads back the applied firewall.
+type FirewallInspector interface {
+	Inspect() (*nftables.Report, error)
+}
@@ -0,0 +1,122 @@
+package menu
+
+import (
+	"errors"
+	"fmt"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+)
+
+func (m *Menu) handleManageUsers() error {
+	if m.userManager == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"user manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleManageUsers")
+	}
+
+	return m.runSubMenu("vtrui user management", []MenuOption{
+		{Label: "1. List users", Handler: m.handleListUsers, Color: "green", Enabled: true},
+		{Label: "2. Add user", Handler: m.handleAddUser, Color: "green", Enabled: true},
+		{Label: "3. Remove user", Handler: m.handleRemoveUser, Color: "red", Enabled: true},
+		{Label: "4. Rename user", Handler: m.handleRenameUser, Color: "yellow", Enabled: true},
+	})
+}
+
+func (m *Menu) handleListUsers() error {
+	users, err := m.userManager.ListUsers()
+	if err != nil {
+		return err
+	}
+	m.printUsers(users)
+	return nil
+}
+
+func (m *Menu) handleAddUser() error {
+	email, err := m.promptText("Email tag (empty for an automatic tag)", "", validateUserEmail)
+	if err != nil {
+		return err
+	}
+
+	user, err := m.userManager.AddUser(email)
+	if err != nil {
+		return err
+	}
+	m.printUsers([]configserver.VtruiUser{user})
+	return nil
+}
+
+func (m *Menu) handleRemoveUser() error {
+	user, err := m.selectUser("Select user to remove")
+	if err != nil {
+		return err
+	}
+	if !m.promptConfirm(fmt.Sprintf("Remove user %s", user.Label())) {
+		m.logger.Info("Removal cancelled")
+		return nil
+	}
+
+	_, err = m.userManager.RemoveUser(user.ID)
+	return err
+}
+
+func (m *Menu) handleRenameUser() error {
+	user, err := m.selectUser("Select user to rename")
+	if err != nil {
+		return err
+	}
+
+	email, err := m.promptText("New email tag", user.Email, validateUserEmail)
+	if err != nil {
+		return err
+	}
+
+	updated, err := m.userManager.RenameUser(user.ID, email)
+	if err != nil {
+		return err
+	}
+	m.printUsers([]configserver.VtruiUser{updated})
+	return nil
+}
+
+func (m *Menu) selectUser(label string) (configserver.VtruiUser, error) {
+	users, err := m.userManager.ListUsers()
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	if len(users) == 0 {
+		return configserver.VtruiUser{}, errors.New("no vtrui users configured")
+	}
+
+	items := make([]string, 0, len(users))
+	for _, user := range users {
+		items = append(items, fmt.Sprintf("%s  %s", user.ID, user.Email))
+	}
+
+	idx, err := m.promptChoice(label, items)
+	if err != nil {
+		return configserver.VtruiUser{}, err
+	}
+	return users[idx], nil
+}
+
+func (m *Menu) printUsers(users []configserver.VtruiUser) {
+	if len(users) == 0 {
+		m.writeLine("No vtrui users configured")
+		return
+	}
+	m.writeLine("%-36s  %s", "UUID", "EMAIL")
+	for _, user := range users {
+		m.writeLine("%-36s  %s", user.ID, user.Email)
+	}
+}
+
+func validateUserEmail(input string) error {
+	_, err := configserver.NormalizeVtruiEmail(input)
+	return err
+}
@@ -0,0 +1,130 @@
+package menu
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	configserver "GWD/internal/configurator/server"
+	apperrors "GWD/internal/errors"
+)
+
+const (
+	defaultWarpDomains     = "geosite:openai,geosite:netflix"
+	defaultWgcfProfilePath = "/root/wgcf-profile.conf"
+)
+
+func (m *Menu) handleWarp() error {
+	if m.warp == nil {
+		return apperrors.New(
+			apperrors.ErrCategoryConfig,
+			apperrors.CodeConfigGeneric,
+			"WARP manager is not configured",
+			nil,
+		).
+			WithModule("menu").
+			WithOperation("menu.handleWarp")
+	}
+
+	enabled, err := m.warp.WarpEnabled()
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		if !m.promptConfirm("WARP upstream is enabled. Disable it") {
+			return nil
+		}
+		if err := m.warp.DisableWarp(); err != nil {
+			return err
+		}
+		m.waitForUserInput("\nPress Enter to continue...")
+		return nil
+	}
+
+	cfg, err := m.promptWireGuardConfig()
+	if err != nil {
+		return err
+	}
+
+	domains, err := m.promptText("Domains routed through WARP (comma separated)", defaultWarpDomains, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := m.warp.EnableWarp(cfg, splitList(domains)); err != nil {
+		return err
+	}
+	m.waitForUserInput("\nPress Enter to continue...")
+	return nil
+}
+
+func (m *Menu) promptWireGuardConfig() (configserver.WireGuardConfig, error) {
+	sources := []string{"Import wgcf profile file", "Enter keys manually"}
+	idx, err := m.promptChoice("WireGuard configuration source", sources)
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+
+	if idx == 0 {
+		path, err := m.promptText("Path to wgcf-profile.conf", defaultWgcfProfilePath, required)
+		if err != nil {
+			return configserver.WireGuardConfig{}, err
+		}
+		return m.warp.LoadWgcfProfile(path)
+	}
+
+	// Pre-fill from the wgcf profile when one is present, so the peer key
+	// follows whatever Cloudflare issued instead of a value baked in here.
+	defaults := configserver.WireGuardConfig{
+		Addresses: []string{"172.16.0.2/32"},
+		Endpoint:  "engage.cloudflareclient.com:2408",
+		MTU:       1280,
+	}
+	if profile, err := m.warp.LoadWgcfProfile(defaultWgcfProfilePath); err == nil {
+		defaults = profile
+	}
+
+	privateKey, err := m.promptText("Interface private key", "", required)
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+	addresses, err := m.promptText("Interface addresses (comma separated CIDRs)", strings.Join(defaults.Addresses, ","), required)
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+	peerKey, err := m.promptText("Peer public key", defaults.PeerPublicKey, required)
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+	endpoint, err := m.promptText("Peer endpoint", defaults.Endpoint, required)
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+	mtu, err := m.promptText("MTU", strconv.Itoa(defaults.MTU), func(input string) error {
+		if _, err := strconv.Atoi(strings.TrimSpace(input)); err != nil {
+			return errors.New("MTU must be a number")
+		}
+		return nil
+	})
+	if err != nil {
+		return configserver.WireGuardConfig{}, err
+	}
+	mtuValue, _ := strconv.Atoi(mtu)
+
+	cfg := configserver.WireGuardConfig{
+		PrivateKey:    privateKey,
+		Addresses:     splitList(addresses),
+		PeerPublicKey: peerKey,
+		Endpoint:      endpoint,
+		MTU:           mtuValue,
+	}
+	return cfg, cfg.Validate()
+}
+
+func required(input string) error {
+	if strings.TrimSpace(input) == "" {
+		return errors.New("value is required")
+	}
+	return nil
+}
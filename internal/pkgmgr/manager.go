@@ -113,6 +113,22 @@ func (m *Manager) UpgradeSystem() error {
 	return nil
 }
 
+// EnsurePackages installs the given optional packages when they are missing.
+func (m *Manager) EnsurePackages(packages ...string) error {
+	installed, err := m.installedPackageSet()
+	if err != nil {
+		return dpkgError("dpkg.installedPackageSet", "failed to list installed packages", err, nil)
+	}
+
+	var missing []string
+	for _, pkg := range packages {
+		if _, exists := installed[pkg]; !exists {
+			missing = append(missing, pkg)
+		}
+	}
+	return m.installPackages(missing)
+}
+
 func (m *Manager) getMissingPackages() ([]string, error) {
 	installed, err := m.installedPackageSet()
 	if err != nil {
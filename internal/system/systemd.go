@@ -0,0 +1,38 @@
+package system
+
+import (
+	"os/exec"
+	"strings"
+
+	apperrors "GWD/internal/errors"
+)
+
+// UnitActive reports whether systemd currently runs the given unit.
+func UnitActive(unit string) bool {
+	return exec.Command("systemctl", "is-active", "--quiet", unit).Run() == nil
+}
+
+// UnitExists reports whether systemd knows the given unit.
+func UnitExists(unit string) bool {
+	return exec.Command("systemctl", "cat", unit).Run() == nil
+}
+
+// Systemctl invokes systemctl with args and wraps failures with the command output.
+func Systemctl(operation string, args ...string) error {
+	return runCommand(operation, "systemctl command failed", "systemctl", args...)
+}
+
+// Run executes name with args and wraps failures with the command output.
+func Run(operation, name string, args ...string) error {
+	return runCommand(operation, "command failed", name, args...)
+}
+
+func runCommand(operation, message, name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return newSystemError(operation, message, err, apperrors.Metadata{
+			"command": strings.TrimSpace(name + " " + strings.Join(args, " ")),
+			"output":  strings.TrimSpace(string(output)),
+		})
+	}
+	return nil
+}
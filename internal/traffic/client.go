@@ -0,0 +1,147 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "GWD/internal/errors"
+)
+
+const (
+	defaultVtruiBinary = "/usr/local/bin/vtrui"
+	defaultAPIServer   = "127.0.0.1:10085"
+	userStatPrefix     = "user>>>"
+	queryTimeout       = 10 * time.Second
+)
+
+// Usage holds uplink and downlink byte counters for one user.
+type Usage struct {
+	Uplink   int64 `json:"uplink"`
+	Downlink int64 `json:"downlink"`
+}
+
+// Total returns uplink plus downlink.
+func (u Usage) Total() int64 {
+	return u.Uplink + u.Downlink
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{Uplink: u.Uplink + other.Uplink, Downlink: u.Downlink + other.Downlink}
+}
+
+// Client queries the vtrui stats API through "vtrui api statsquery".
+type Client struct {
+	Binary string
+	Server string
+}
+
+// NewClient returns a Client for the local vtrui API inbound.
+func NewClient() *Client {
+	return &Client{Binary: defaultVtruiBinary, Server: defaultAPIServer}
+}
+
+// QueryUsers returns per-user counters keyed by user email. With reset the
+// counters are zeroed atomically on the vtrui side, so callers can add the
+// returned deltas to a persistent store without double counting.
+func (c *Client) QueryUsers(ctx context.Context, reset bool) (map[string]Usage, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []string{"api", "statsquery", "--server=" + c.Server, "-pattern", userStatPrefix}
+	if reset {
+		args = append(args, "-reset")
+	}
+
+	output, err := exec.CommandContext(ctx, c.Binary, args...).Output()
+	if err != nil {
+		appErr := trafficError("traffic.Client.QueryUsers", "vtrui stats query failed", err).
+			WithField("server", c.Server)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			appErr.WithField("stderr", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, appErr
+	}
+
+	return parseStatsQuery(output)
+}
+
+// statValue accepts both numeric and string encoded int64 values; protojson
+// renders int64 as a string.
+type statValue int64
+
+func (v *statValue) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*v = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = statValue(n)
+	return nil
+}
+
+func parseStatsQuery(output []byte) (map[string]Usage, error) {
+	var resp struct {
+		Stat []struct {
+			Name  string    `json:"name"`
+			Value statValue `json:"value"`
+		} `json:"stat"`
+	}
+	if len(strings.TrimSpace(string(output))) > 0 {
+		if err := json.Unmarshal(output, &resp); err != nil {
+			return nil, trafficError("traffic.parseStatsQuery", "failed to parse vtrui stats output", err)
+		}
+	}
+
+	usage := make(map[string]Usage)
+	for _, stat := range resp.Stat {
+		// user>>>{email}>>>traffic>>>{uplink|downlink}
+		parts := strings.Split(stat.Name, ">>>")
+		if len(parts) != 4 || parts[0] != "user" || parts[2] != "traffic" {
+			continue
+		}
+		current := usage[parts[1]]
+		switch parts[3] {
+		case "uplink":
+			current.Uplink += int64(stat.Value)
+		case "downlink":
+			current.Downlink += int64(stat.Value)
+		default:
+			continue
+		}
+		usage[parts[1]] = current
+	}
+	return usage, nil
+}
+
+// FormatBytes renders n with binary units, e.g. "1.50 GiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func trafficError(operation, message string, err error) *apperrors.AppError {
+	return apperrors.New(apperrors.ErrCategorySystem, apperrors.CodeSystemGeneric, message, err).
+		WithModule("traffic").
+		WithOperation(operation)
+}
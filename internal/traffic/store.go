@@ -0,0 +1,194 @@
+package traffic
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"GWD/internal/system"
+)
+
+// DefaultStorePath is where accumulated counters and quotas are persisted.
+const DefaultStorePath = "/opt/GWD/traffic.json"
+
+const periodLayout = "2006-01"
+
+// SuspendedUser records a client removed from vtrui because it exceeded its quota.
+type SuspendedUser struct {
+	ID     string `json:"id"`
+	Period string `json:"period"`
+}
+
+// Store accumulates per-user traffic for the current calendar month and keeps
+// closed months as history for billing. Pending holds the vtrui counters
+// already added to Users but not yet reset on the vtrui side.
+type Store struct {
+	Period    string                      `json:"period"`
+	Users     map[string]Usage            `json:"users"`
+	History   map[string]map[string]Usage `json:"history,omitempty"`
+	Quotas    map[string]int64            `json:"quotas,omitempty"`
+	Suspended map[string]SuspendedUser    `json:"suspended,omitempty"`
+	Pending   map[string]Usage            `json:"pending,omitempty"`
+	UpdatedAt time.Time                   `json:"updated_at"`
+
+	path string
+}
+
+// UserReport is one row of a monthly usage report.
+type UserReport struct {
+	Email     string
+	Usage     Usage
+	Quota     int64
+	Suspended bool
+}
+
+// LoadStore reads the store at path, returning an empty store when it does not exist yet.
+func LoadStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, trafficError("traffic.LoadStore", "failed to read traffic store", err).WithField("path", path)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, store); err != nil {
+			return nil, trafficError("traffic.LoadStore", "failed to parse traffic store", err).WithField("path", path)
+		}
+	}
+
+	if store.Users == nil {
+		store.Users = make(map[string]Usage)
+	}
+	if store.History == nil {
+		store.History = make(map[string]map[string]Usage)
+	}
+	if store.Quotas == nil {
+		store.Quotas = make(map[string]int64)
+	}
+	if store.Suspended == nil {
+		store.Suspended = make(map[string]SuspendedUser)
+	}
+	return store, nil
+}
+
+// Save writes the store atomically.
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return trafficError("traffic.Store.Save", "failed to encode traffic store", err)
+	}
+
+	if err := system.WriteFileAtomic(s.path, append(data, '\n'), 0o600); err != nil {
+		return trafficError("traffic.Store.Save", "failed to write traffic store", err).WithField("path", s.path)
+	}
+	return nil
+}
+
+// Rollover closes the current month into History when now is in a later
+// month. It reports whether a rollover happened.
+func (s *Store) Rollover(now time.Time) bool {
+	period := now.Format(periodLayout)
+	if s.Period == period {
+		return false
+	}
+	if s.Period != "" && len(s.Users) > 0 {
+		s.History[s.Period] = s.Users
+	}
+	s.Period = period
+	s.Users = make(map[string]Usage)
+	return true
+}
+
+// Absorb adds the growth of vtrui's cumulative counters since they were last
+// absorbed to the current month and remembers them as Pending. A counter
+// below its pending value means vtrui restarted, so it is taken as-is.
+func (s *Store) Absorb(counters map[string]Usage, now time.Time) {
+	for email, current := range counters {
+		delta := current
+		if prev, ok := s.Pending[email]; ok && current.Uplink >= prev.Uplink && current.Downlink >= prev.Downlink {
+			delta = Usage{Uplink: current.Uplink - prev.Uplink, Downlink: current.Downlink - prev.Downlink}
+		}
+		s.Users[email] = s.Users[email].Add(delta)
+	}
+	s.Pending = counters
+	s.UpdatedAt = now
+}
+
+// ClearPending forgets the pending counters once vtrui has reset them.
+func (s *Store) ClearPending() {
+	s.Pending = nil
+}
+
+// SetQuota sets a monthly quota in bytes; zero removes it.
+func (s *Store) SetQuota(email string, bytes int64) {
+	if bytes <= 0 {
+		delete(s.Quotas, email)
+		return
+	}
+	s.Quotas[email] = bytes
+}
+
+// OverQuota lists users of the current month whose usage reached their quota
+// and who are not suspended yet.
+func (s *Store) OverQuota() []string {
+	var emails []string
+	for email, quota := range s.Quotas {
+		if _, suspended := s.Suspended[email]; suspended {
+			continue
+		}
+		if s.Users[email].Total() >= quota {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+// Report returns the usage rows for period ("" for the current month), sorted
+// by email.
+func (s *Store) Report(period string) []UserReport {
+	users := s.Users
+	if period != "" && period != s.Period {
+		users = s.History[period]
+	}
+
+	emails := make(map[string]struct{}, len(users))
+	for email := range users {
+		emails[email] = struct{}{}
+	}
+	if period == "" || period == s.Period {
+		for email := range s.Quotas {
+			emails[email] = struct{}{}
+		}
+		for email := range s.Suspended {
+			emails[email] = struct{}{}
+		}
+	}
+
+	rows := make([]UserReport, 0, len(emails))
+	for email := range emails {
+		_, suspended := s.Suspended[email]
+		rows = append(rows, UserReport{
+			Email:     email,
+			Usage:     users[email],
+			Quota:     s.Quotas[email],
+			Suspended: suspended,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Email < rows[j].Email })
+	return rows
+}
+
+// Periods lists the months with data, newest first.
+func (s *Store) Periods() []string {
+	periods := make([]string, 0, len(s.History)+1)
+	if s.Period != "" {
+		periods = append(periods, s.Period)
+	}
+	for period := range s.History {
+		periods = append(periods, period)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(periods)))
+	return periods
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
+	qrcode "github.com/skip2/go-qrcode"
 	"golang.org/x/term"
 )
 
@@ -85,10 +86,14 @@ func (p *Printer) PrintSeparator(char string, length int) {
 
 // NodeInfo summarises the connection parameters of a node.
 type NodeInfo struct {
-	Domain string
-	Port   string
-	UUID   string
-	Path   string
+	Domain    string
+	Port      string
+	UUID      string
+	Path      string
+	DoHPaths  []string
+	User      string
+	Protocol  string
+	ShareLink string
 }
 
 // PrintNodeInfo renders node metadata in a user friendly way.
@@ -102,9 +107,11 @@ func (p *Printer) PrintNodeInfo(info NodeInfo) {
 		domainWithPort = fmt.Sprintf("%s:%s", info.Domain, info.Port)
 	}
 
-	fmt.Printf("%s       %s\n",
-		p.info.Sprint("DoH:"),
-		p.warn.Sprintf("%s/dq", domainWithPort))
+	for _, path := range info.DoHPaths {
+		fmt.Printf("%s       %s\n",
+			p.info.Sprint("DoH:"),
+			p.warn.Sprintf("https://%s%s", domainWithPort, path))
+	}
 	fmt.Printf("%s   %s\n",
 		p.info.Sprint("Address:"),
 		p.warn.Sprint(domainWithPort))
@@ -114,10 +121,37 @@ func (p *Printer) PrintNodeInfo(info NodeInfo) {
 	fmt.Printf("%s      %s\n",
 		p.info.Sprint("Path:"),
 		p.warn.Sprint(info.Path))
+	if info.User != "" {
+		fmt.Printf("%s      %s\n",
+			p.info.Sprint("User:"),
+			p.warn.Sprint(info.User))
+	}
+	if info.Protocol != "" {
+		fmt.Printf("%s  %s\n",
+			p.info.Sprint("Protocol:"),
+			p.warn.Sprint(info.Protocol))
+	}
+
+	if info.ShareLink != "" {
+		fmt.Println()
+		fmt.Printf("%s\n%s\n", p.info.Sprint("Share link:"), info.ShareLink)
+		fmt.Println()
+		p.PrintQRCode(info.ShareLink)
+	}
 
 	p.PrintSeparator("-", 50)
 }
 
+// PrintQRCode renders content as a QR code using Unicode half blocks.
+func (p *Printer) PrintQRCode(content string) {
+	code, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		p.error.Printf("Failed to render QR code: %v\n", err)
+		return
+	}
+	fmt.Print(code.ToSmallString(false))
+}
+
 // PrintServiceStatus renders the service status indicator line.
 func (p *Printer) PrintServiceStatus(service string, status ServiceStatus) {
 	var (